@@ -0,0 +1,182 @@
+package jsonstate
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// read access to subtrees of a shared tree: tokens have roles, and a role may read the subtrees of the source paths that match its globs (see MatchPath), e.g. {"roles": {"db-team": ["db", "shared/*"], "ops": ["**"]}, "tokens": {"s3cr3t": ["db-team"]}}
+// note: the parents of a readable subtree are kept (with only their source, and the worst level of what is readable), so that paths stay the same
+type AccessPolicy struct {
+	Roles map[string][]string    `json:"roles"` // role to source path globs
+	Tokens map[string][]string   `json:"tokens"` // bearer token to roles
+}
+
+type accessKey struct{}
+
+// constructor: read an access policy from JSON (see AccessPolicy)
+// note: a token with a role that is not defined is rejected, so that a typo does not silently deny access
+func LoadAccessPolicy(r io.Reader) (*AccessPolicy, error) {
+	
+	p := &AccessPolicy{}
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	
+	for _, roles := range p.Tokens {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return nil, fmt.Errorf("jsonstate: access policy: undefined role: %s", role)
+			}
+		}
+	}
+	
+	return p, nil
+}
+// the source path globs that a token may read, or an error wrapping ErrUnauthorized for an unknown token
+func (p *AccessPolicy) Globs(token string) ([]string, error) {
+	
+	// compare every token, so that the time taken does not tell how much of a token is right
+	var roles []string
+	found := false
+	for t, t_roles := range p.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			roles = t_roles
+			found = true
+		}
+	}
+	if !found || token == "" {
+		return nil, fmt.Errorf("%w: unknown token", ErrUnauthorized)
+	}
+	
+	globs := []string{}
+	for _, role := range roles {
+		globs = append(globs, p.Roles[role]...)
+	}
+	
+	return globs, nil
+}
+// a context that restricts the read endpoints (Handler, StreamHandler, Watch and Proxy.Handler) to what the token may read, e.g. in a gRPC interceptor
+func (p *AccessPolicy) Context(ctx context.Context, token string) (context.Context, error) {
+	
+	globs, err := p.Globs(token)
+	if err != nil {
+		return nil, err
+	}
+	
+	return WithAccess(ctx, globs), nil
+}
+// wraps a read endpoint, to restrict each request to what its bearer token (Authorization: Bearer <token>) may read
+// note: a request without a known token fails with 401 Unauthorized
+func (p *AccessPolicy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		
+		ctx, err := p.Context(req.Context(), strings.TrimSpace(token))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="jsonstate"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// a context that restricts the read endpoints to the subtrees of the source paths that match globs (see Restrict)
+func WithAccess(ctx context.Context, globs []string) context.Context {
+	return context.WithValue(ctx, accessKey{}, globs)
+}
+// a copy of the tree with only the subtrees of the source paths that match one of the globs, and their parents (see AccessPolicy)
+func (s *State) Restrict(globs []string) *State {
+	
+	restricted := restrict(s, nil, globs)
+	if restricted == nil {
+		return New(s.Source)
+	}
+	
+	return restricted
+}
+
+// restrict s to what ctx may read (all of s without WithAccess)
+func restrictContext(ctx context.Context, s *State) *State {
+	
+	globs, ok := ctx.Value(accessKey{}).([]string)
+	if !ok {
+		return s
+	}
+	
+	return s.Restrict(globs)
+}
+// whether ctx may read the state with the given source path (joined with "/")
+func accessible(ctx context.Context, path string) bool {
+	
+	globs, ok := ctx.Value(accessKey{}).([]string)
+	if !ok {
+		return true
+	}
+	
+	// readable if it is in a readable subtree
+	source_path := SplitPath(path)
+	for i := 0; i <= len(source_path); i += 1 {
+		if matchAccess(globs, source_path[:i]) {
+			return true
+		}
+	}
+	
+	return false
+}
+// whether one of the globs matches the source path, an empty glob matches nothing (the whole tree is "**")
+func matchAccess(globs []string, source_path []string) bool {
+	
+	for _, glob := range globs {
+		if pattern := SplitPath(glob); len(pattern) > 0 && matchPath(pattern, source_path) {
+			return true
+		}
+	}
+	
+	return false
+}
+func restrict(rs *State, source_path []string, globs []string) *State {
+	
+	if matchAccess(globs, source_path) {
+		return rs.Clone()
+	}
+	
+	if len(source_path) >= MaxDepth {
+		return nil
+	}
+	
+	parent := &State{
+		Level: StateUnknown,
+		Source: rs.Source,
+	}
+	for _, rs_it := range rs.Tree {
+		
+		if rs_it == nil {
+			continue
+		}
+		
+		rs_it = restrict(rs_it, append(source_path[:len(source_path):len(source_path)], rs_it.Source), globs)
+		if rs_it == nil {
+			continue
+		}
+		
+		parent.Tree = append(parent.Tree, rs_it)
+		if rs_it.Level > parent.Level {
+			parent.Level = rs_it.Level
+		}
+	}
+	
+	if len(parent.Tree) == 0 {
+		return nil
+	}
+	
+	return parent
+}
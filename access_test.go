@@ -0,0 +1,92 @@
+package jsonstate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRestrict(t *testing.T) {
+	
+	s := FromMap(map[string]int{"db/primary": StateError, "web/1": StateWarning, "shared/cache": StateOk})
+	s.Source = "root"
+	s.Message = "secret"
+	s.AggregateLevels()
+	
+	db := s.Restrict([]string{"db"})
+	if len(db.Tree) != 1 || db.Tree[0].Source != "db" || db.Level != StateError || db.Message != "" {
+		t.Errorf("restricted to db: %s", db)
+	}
+	
+	// the parents of a readable subtree only have their source, and the worst level of what is readable
+	cache := s.Restrict([]string{"shared/*"})
+	shared, err := cache.Lookup("shared")
+	if err != nil || shared.Level != StateOk || len(shared.Tree) != 1 || cache.Level != StateOk {
+		t.Errorf("restricted to shared/*: %s", cache)
+	}
+	if _, err := cache.Lookup("web"); err == nil {
+		t.Errorf("restricted to shared/* has web: %s", cache)
+	}
+	
+	if all := s.Restrict([]string{"**"}); all.String() != s.String() {
+		t.Errorf("restricted to **: %s", all)
+	}
+	if none := s.Restrict([]string{"", "other"}); none.Source != "root" || len(none.Tree) != 0 || none.Level != StateUnknown {
+		t.Errorf("restricted to nothing: %s", none)
+	}
+}
+func TestAccessible(t *testing.T) {
+	
+	ctx := WithAccess(context.Background(), []string{"db", "shared/*"})
+	for path, want := range map[string]bool{
+		"db": true,
+		"db/primary": true,
+		"shared/cache": true,
+		"shared": false,
+		"web/1": false,
+		"": false,
+	} {
+		if got := accessible(ctx, path); got != want {
+			t.Errorf("accessible(%q) = %v, want %v", path, got, want)
+		}
+	}
+	
+	if !accessible(context.Background(), "web/1") {
+		t.Error("not accessible without WithAccess")
+	}
+}
+func TestAccessPolicyHandler(t *testing.T) {
+	
+	if _, err := LoadAccessPolicy(strings.NewReader(`{"roles": {"ops": ["**"]}, "tokens": {"t": ["typo"]}}`)); err == nil {
+		t.Error("loaded a policy with an undefined role")
+	}
+	
+	p, err := LoadAccessPolicy(strings.NewReader(`{"roles": {"db-team": ["db"]}, "tokens": {"s3cr3t": ["db-team"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	s := FromMap(map[string]int{"db": StateError, "web": StateOk})
+	handler := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(restrictContext(req.Context(), s).String()))
+	}))
+	
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "s3cr3t": http.StatusOK} {
+		
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer " + token)
+		}
+		
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("token %q: %d, want %d", token, rec.Code, want)
+		}
+		if rec.Code == http.StatusOK && (strings.Contains(rec.Body.String(), "web") || !strings.Contains(rec.Body.String(), "db")) {
+			t.Errorf("token %q read:\n%s", token, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package jsonstate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// what to do with notifications of a Route outside of its Calendar (Fault and Panic are always notified)
+const (
+	QuietSuppress string = "suppress" // do not notify
+	QuietDowngrade string = "downgrade" // notify, with the level downgraded by one (e.g. Error to Warning)
+)
+
+// a transition that is sent to a Notifier by a Route
+type Notification struct {
+	Transition
+	Route string          `json:"route,omitempty"` // name of the route
+	Level int             `json:"level"` // level to notify with, which is the level of the transition, unless it was downgraded
+	RunbookURL string     `json:"runbook_url,omitempty"` // registered for the source path (see RegisterRunbook)
+	Downgraded bool       `json:"downgraded,omitempty"`
+	Escalation int        `json:"escalation,omitempty"` // 0 for the initial notification, or the number of the escalation step (1 for the first step of Route.Escalation)
+	Renotify bool         `json:"renotify,omitempty"` // repeated notification of an unacknowledged incident
+	Test bool             `json:"test,omitempty"` // simulated with TestNotifyHandler
+}
+// delivers notifications (chat, mail, pager, ...)
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+// adapter to use a plain function as Notifier
+type NotifierFunc func(ctx context.Context, n Notification) error
+
+// a routing rule: transitions of matching sources to or from MinLevel (or worse) are sent to the notifiers
+type Route struct {
+	Name string                     `json:"name,omitempty"`
+	Pattern string                  `json:"pattern,omitempty"` // glob pattern of the source path (see MatchPath), all sources if empty
+	When string                     `json:"when,omitempty"` // condition over the transition (see ParseExpression with ExprTransition), e.g. "from >= Error || message ~ timeout", all transitions if empty
+	MinLevel int                    `json:"min_level"`
+	Calendar *Calendar              `json:"calendar,omitempty"` // always active if nil
+	Quiet string                    `json:"quiet,omitempty"` // QuietSuppress (default) or QuietDowngrade
+	Notifiers []Notifier            `json:"-"`
+	Escalation []EscalationStep     `json:"escalation,omitempty"` // notify more notifiers as long as the incident is not acknowledged
+	Renotify map[int]time.Duration  `json:"renotify,omitempty"` // repeat unacknowledged notifications at an interval per (built-in) level, e.g. {StateError: time.Hour, StateFault: 15 * time.Minute}
+	Dedup time.Duration             `json:"dedup,omitempty"` // do not notify a source again with the same level within this time (e.g. when flapping between Error and Fault)
+}
+// routes transitions of a Registry to notifiers, attach it with r.Alert(a)
+type Alerter struct {
+	mu sync.RWMutex
+	ctx context.Context // parent of the context of every notification
+	routes []*Route
+	queue chan queuedNotification
+	closed bool
+	incidents map[incidentKey]*incident
+	silences map[string]time.Time // source path glob pattern to the end of the silence
+	notified map[dedupKey]time.Time // time of the last notification per route, source path and level (only for routes with Dedup)
+	observed map[string]int // level per source path of the last tree passed to Observe
+	suppressions []*Expression // see Suppress
+	errors []error // reported to OnError once the lock is released, see fail
+	OnError func(error) // called for errors of notifiers and calendars (logged with slog by default)
+}
+
+type dedupKey struct {
+	route *Route
+	path string
+	level int
+}
+type queuedNotification struct {
+	notifier Notifier
+	n Notification
+}
+
+// maximum number of notifications waiting to be delivered, any more are dropped (and reported to OnError)
+var AlertQueueSize = 1024
+
+func (fn NotifierFunc) Notify(ctx context.Context, n Notification) error {
+	return fn(ctx, n)
+}
+
+// constructor: notifications are delivered in order by a single goroutine, until ctx is done or Close() is called
+// note: every notification gets a context derived from ctx with NotifyTimeout, so that cancelling ctx also aborts a delivery in progress
+func NewAlerter(ctx context.Context) *Alerter {
+	
+	a := &Alerter{
+		ctx: ctx,
+		queue: make(chan queuedNotification, AlertQueueSize),
+		incidents: map[incidentKey]*incident{},
+		silences: map[string]time.Time{},
+		notified: map[dedupKey]time.Time{},
+		observed: map[string]int{},
+	}
+	go a.run()
+	context.AfterFunc(ctx, a.Close)
+	
+	return a
+}
+// stop delivering notifications, the ones already queued are still delivered (unless the context passed to NewAlerter is done)
+func (a *Alerter) Close() {
+	
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+		
+		for key, inc := range a.incidents {
+			inc.stop()
+			delete(a.incidents, key)
+		}
+	}
+}
+// add a routing rule, every matching route is notified (in the order they were added)
+func (a *Alerter) AddRoute(route *Route) *Alerter {
+	
+	a.mu.Lock()
+	defer a.unlock()
+	
+	// report invalid conditions right away, rather than on the first transition
+	if _, err := transitionCondition(route.When); err != nil {
+		a.fail(fmt.Errorf("jsonstate: route %s: %w", route.Name, err))
+	}
+	for _, step := range route.Escalation {
+		if _, err := transitionCondition(step.When); err != nil {
+			a.fail(fmt.Errorf("jsonstate: route %s: escalation: %w", route.Name, err))
+		}
+	}
+	
+	a.routes = append(a.routes, route)
+	
+	return a
+}
+// suppress the notifications of all routes for transitions matching the condition (see ParseExpression with ExprTransition), e.g. "path ~ 'batch/**' && to < Fault"
+func (a *Alerter) Suppress(condition string) error {
+	
+	e, err := ParseExpression(ExprTransition, condition)
+	if err != nil {
+		return err
+	}
+	
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	
+	a.suppressions = append(a.suppressions, e)
+	
+	return nil
+}
+// shorthand for a route that notifies when a source matching the glob pattern (see MatchPath) reaches level (or worse), and when it recovers
+func (a *Alerter) OnLevelAtLeast(level int, pattern string, notifiers ...Notifier) *Alerter {
+	return a.AddRoute(&Route{
+		Pattern: pattern,
+		MinLevel: level,
+		Notifiers: notifiers,
+	})
+}
+// route a transition (the signature matches Registry.OnTransition), notifiers are called asynchronously
+func (a *Alerter) Handle(t Transition) {
+	
+	a.mu.Lock()
+	defer a.unlock()
+	
+	if a.closed {
+		return
+	}
+	
+	for _, route := range a.routes {
+		
+		n, ok := a.route(route, t)
+		if !ok {
+			continue
+		}
+		
+		if route.Dedup > 0 {
+			a.notified[dedupKey{route: route, path: t.Path, level: t.To}] = t.Time
+		}
+		
+		if len(route.Escalation) > 0 || len(route.Renotify) > 0 {
+			a.escalate(route, n)
+			continue
+		}
+		
+		for _, notifier := range route.Notifiers {
+			a.enqueue(notifier, n)
+		}
+	}
+}
+// route the changes of level in a (typically aggregated) tree since the last call, for trees that are not kept in a Registry
+// note: the first time a source is observed, its level is compared to Unknown, so that a source that is already at Fault is notified
+func (a *Alerter) Observe(s *State) {
+	
+	now := time.Now()
+	
+	a.mu.Lock()
+	
+	transitions := []Transition{}
+	observed := map[string]int{}
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		path := strings.Join(source_path, "/")
+		observed[path] = s_it.Level
+		
+		from, ok := a.observed[path]
+		if !ok {
+			from = StateUnknown
+		}
+		if from != s_it.Level {
+			transitions = append(transitions, Transition{
+				Path: path,
+				From: from,
+				To: s_it.Level,
+				Message: s_it.Message,
+				Time: now,
+			})
+		}
+		
+		return true
+	})
+	a.observed = observed
+	
+	a.mu.Unlock()
+	
+	for _, t := range transitions {
+		a.Handle(t)
+	}
+}
+// option: send all transitions of the registry to the alerter
+func (r *Registry) Alert(a *Alerter) *Registry {
+	return r.OnTransition(a.Handle)
+}
+
+// decide if (and how) the route notifies the transition
+func (a *Alerter) route(route *Route, t Transition) (Notification, bool) {
+	n, reason := a.routeReason(route, t)
+	return n, reason == ""
+}
+// same as route, but returns why the route does not notify the transition (or an empty string if it does)
+func (a *Alerter) routeReason(route *Route, t Transition) (Notification, string) {
+	
+	if route.Pattern != "" && !MatchPath(route.Pattern, t.Path) {
+		return Notification{}, "pattern does not match"
+	}
+	
+	if !a.matchCondition(route.When, t) {
+		return Notification{}, "condition does not match"
+	}
+	
+	if a.silenced(t.Path, t.Time) {
+		return Notification{}, "silenced"
+	}
+	
+	for _, e := range a.suppressions {
+		if ok, _ := e.MatchTransition(t); ok {
+			return Notification{}, "suppressed by " + e.String()
+		}
+	}
+	
+	if route.Dedup > 0 {
+		key := dedupKey{route: route, path: t.Path, level: t.To}
+		if last, ok := a.notified[key]; ok {
+			if t.Time.Sub(last) < route.Dedup {
+				return Notification{}, "duplicate"
+			}
+			delete(a.notified, key) // expired
+		}
+	}
+	
+	// both escalations to MinLevel and recoveries from it are notified
+	if t.To < route.MinLevel && t.From < route.MinLevel {
+		return Notification{}, "below min_level"
+	}
+	
+	n := Notification{
+		Transition: t,
+		Route: route.Name,
+		Level: t.To,
+		RunbookURL: RunbookURL(t.Path),
+	}
+	
+	// Fault and Panic (and recoveries from them) require manual intervention, so they are always notified
+	if t.To >= StateFault || t.From >= StateFault {
+		return n, ""
+	}
+	
+	active, err := route.Calendar.IsActive(t.Time)
+	if err != nil {
+		a.fail(err)
+		return n, "" // better a notification too many with a broken calendar
+	}
+	if active {
+		return n, ""
+	}
+	
+	if route.Quiet != QuietDowngrade {
+		return Notification{}, "quiet hours"
+	}
+	if t.To < route.MinLevel {
+		return n, "" // recoveries are not downgraded
+	}
+	
+	n.Level = builtinLevel(n.Level) - 100
+	if n.Level < StateUnknown {
+		n.Level = StateUnknown
+	}
+	n.Downgraded = true
+	
+	return n, ""
+}
+// suppress all notifications for sources matching the glob pattern (see MatchPath) until the given time (a zero time lifts the silence)
+func (a *Alerter) Silence(pattern string, until time.Time) {
+	
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	
+	if until.IsZero() {
+		delete(a.silences, pattern)
+		return
+	}
+	
+	a.silences[pattern] = until
+}
+// note: must be called while holding the lock
+func (a *Alerter) silenced(path string, now time.Time) bool {
+	_, ok := a.silencedUntil(path, now)
+	return ok
+}
+// the end of the (latest ending) silence that applies to the path
+// note: must be called while holding the lock
+func (a *Alerter) silencedUntil(path string, now time.Time) (time.Time, bool) {
+	
+	end := time.Time{}
+	for pattern, until := range a.silences {
+		
+		if !now.Before(until) {
+			delete(a.silences, pattern) // expired
+			continue
+		}
+		if MatchPath(pattern, path) && until.After(end) {
+			end = until
+		}
+	}
+	
+	return end, !end.IsZero()
+}
+// true if the transition matches the condition (or the condition is empty or invalid, better a notification too many)
+// note: must be called while holding the lock
+func (a *Alerter) matchCondition(condition string, t Transition) bool {
+	
+	e, err := transitionCondition(condition)
+	if err != nil {
+		a.fail(err)
+		return true
+	}
+	if e == nil {
+		return true
+	}
+	
+	ok, err := e.MatchTransition(t)
+	if err != nil {
+		a.fail(err)
+		return true
+	}
+	
+	return ok
+}
+// note: must be called while holding the lock
+func (a *Alerter) enqueue(notifier Notifier, n Notification) {
+	
+	select {
+	case a.queue <- queuedNotification{notifier: notifier, n: n}:
+	default:
+		a.fail(fmt.Errorf("jsonstate: alert queue is full, dropped notification for %s", n.Path))
+	}
+}
+func (a *Alerter) run() {
+	for q := range a.queue {
+		
+		if a.ctx.Err() != nil {
+			continue // drop the rest of the queue
+		}
+		
+		if err := a.notify(q); err != nil {
+			a.error(err)
+		}
+	}
+}
+func (a *Alerter) notify(q queuedNotification) error {
+	
+	ctx, cancel := context.WithTimeout(a.ctx, NotifyTimeout)
+	defer cancel()
+	
+	return q.notifier.Notify(ctx, q.n)
+}
+// report err to OnError after the lock is released (see unlock), so that OnError may call into the Alerter
+// note: must be called while holding the lock
+func (a *Alerter) fail(err error) {
+	a.errors = append(a.errors, err)
+}
+// release the lock, and report the errors of fail
+func (a *Alerter) unlock() {
+	
+	errs := a.errors
+	a.errors = nil
+	a.mu.Unlock()
+	
+	for _, err := range errs {
+		a.error(err)
+	}
+}
+func (a *Alerter) error(err error) {
+	
+	if a.OnError != nil {
+		a.OnError(err)
+		return
+	}
+	
+	slog.Error("jsonstate: alert", slog.String("error", err.Error()))
+}
@@ -0,0 +1,39 @@
+package jsonstate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAlerterOnErrorCallsBack(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	a := NewAlerter(ctx)
+	errs := 0
+	a.OnError = func(err error) {
+		errs += 1
+		a.Acknowledge("db") // needs the lock
+	}
+	
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		
+		a.AddRoute(&Route{Name: "broken", When: "level >>> Error", MinLevel: StateError})
+		a.Handle(Transition{Path: "db", From: StateOk, To: StateError, Time: time.Now()})
+		a.Trace(Transition{Path: "db", From: StateOk, To: StateError, Time: time.Now()})
+	}()
+	
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock, OnError was called while holding the lock")
+	}
+	
+	if errs != 3 {
+		t.Errorf("%d errors reported, want 3", errs)
+	}
+}
@@ -0,0 +1,63 @@
+package jsonstate
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// publishes a message to an AMQP exchange, implement it with the AMQP client of choice, e.g. for github.com/rabbitmq/amqp091-go:
+//   func (c channel) Publish(ctx context.Context, exchange, key, content_type string, body []byte) error {
+//     return c.ch.PublishWithContext(ctx, exchange, key, false, false, amqp.Publishing{ContentType: content_type, Body: body})
+//   }
+type AMQPChannel interface {
+	Publish(ctx context.Context, exchange string, routing_key string, content_type string, body []byte) error
+}
+// sends transitions as JSON to an exchange (typically a topic exchange), attach it to a Route of an Alerter to publish asynchronously and in order
+type AMQPNotifier struct {
+	Channel AMQPChannel
+	Exchange string
+	Prefix string // first word of every routing key, e.g. "jsonstate"
+}
+
+// constructor: publish to the given exchange with routing keys prefixed with "jsonstate"
+func NewAMQPNotifier(channel AMQPChannel, exchange string) *AMQPNotifier {
+	return &AMQPNotifier{
+		Channel: channel,
+		Exchange: exchange,
+		Prefix: "jsonstate",
+	}
+}
+func (p *AMQPNotifier) Notify(ctx context.Context, n Notification) error {
+	
+	body, err := json.Marshal(n.Transition)
+	if err != nil {
+		return err
+	}
+	
+	if err := p.Channel.Publish(ctx, p.Exchange, p.RoutingKey(n.Transition), "application/json", body); err != nil {
+		return transportError("amqp", p.Exchange, err)
+	}
+	
+	return nil
+}
+func (p *AMQPNotifier) String() string {
+	return "amqp " + p.Exchange
+}
+// routing key of a transition: the prefix, the level band it transitioned to (the lowercase name of the built-in level), and the words of the source path
+// e.g. "jsonstate.error.db.replica1", so that queues may bind to "jsonstate.error.#" or "jsonstate.*.db.#"
+// note: dots within a source are replaced with underscores, as they separate the words of a routing key
+func (p *AMQPNotifier) RoutingKey(t Transition) string {
+	
+	words := []string{}
+	if p.Prefix != "" {
+		words = append(words, p.Prefix)
+	}
+	
+	words = append(words, strings.ToLower(builtinLevelString(t.To)))
+	for _, source := range SplitPath(t.Path) {
+		words = append(words, strings.ReplaceAll(source, ".", "_"))
+	}
+	
+	return strings.Join(words, ".")
+}
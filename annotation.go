@@ -0,0 +1,96 @@
+package jsonstate
+
+import (
+	"strings"
+	"time"
+)
+
+// a timestamped free-text note on a state, e.g. "restarted primary", "opened ticket #123"
+type Annotation struct {
+	Time time.Time       `json:"time"`
+	Author string        `json:"author,omitempty"`
+	Text string          `json:"text"`
+}
+// an annotation with the source path it belongs to, as stored in History
+type PathAnnotation struct {
+	Annotation
+	Path string          `json:"path"`
+}
+
+// maximum number of annotations kept on a single state, older ones are dropped (History keeps them all, within its retention)
+var MaxAnnotations = 20
+
+// add an annotation (Time is set to now if zero)
+func (s *State) Annotate(a Annotation) *State {
+	
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	
+	s.Annotations = append(s.Annotations, a)
+	if MaxAnnotations > 0 && len(s.Annotations) > MaxAnnotations {
+		s.Annotations = append(s.Annotations[:0:0], s.Annotations[len(s.Annotations) - MaxAnnotations:]...)
+	}
+	
+	return s
+}
+// add an annotation to the state with the given source path, and to every History the registry records to
+func (r *Registry) Annotate(path string, author string, text string) {
+	
+	a := Annotation{
+		Time: time.Now(),
+		Author: author,
+		Text: text,
+	}
+	
+	source_path := SplitPath(path)
+	r.Update(source_path, func(s *State) {
+		s.Annotate(a)
+	})
+	
+	r.mu.RLock()
+	histories := r.histories
+	r.mu.RUnlock()
+	
+	for _, h := range histories {
+		h.RecordAnnotation(PathAnnotation{
+			Annotation: a,
+			Path: strings.Join(source_path, "/"),
+		})
+	}
+}
+// same as Registry.Annotate, but for this component
+func (c *Component) Annotate(author string, text string) *Component {
+	c.registry.Annotate(c.Path(), author, text)
+	return c
+}
+// add an annotation to the history
+func (h *History) RecordAnnotation(a PathAnnotation) {
+	
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	
+	h.annotations = append(h.annotations, a)
+	
+	// typically already in order
+	for i := len(h.annotations) - 1; i > 0 && h.annotations[i].Time.Before(h.annotations[i - 1].Time); i -= 1 {
+		h.annotations[i], h.annotations[i - 1] = h.annotations[i - 1], h.annotations[i]
+	}
+	
+	h.prune(time.Now())
+}
+// the recorded annotations (ordered by time) from since (inclusive), for the given source path (or all paths if empty)
+func (h *History) Annotations(path string, since time.Time) []PathAnnotation {
+	
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	
+	list := []PathAnnotation{}
+	for _, a := range h.annotations {
+		if !a.Time.Before(since) && (path == "" || a.Path == path) {
+			list = append(list, a)
+		}
+	}
+	
+	return list
+}
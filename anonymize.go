@@ -0,0 +1,54 @@
+package jsonstate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// a copy of the tree to share outside of the organization: every source is replaced by a pseudonym (see Pseudonym), and messages, runbook URLs, annotations and SLA tiers are removed, while the structure, levels, datetimes, counts and SLA targets are kept
+// note: the same source gets the same pseudonym anywhere in the tree and in every tree anonymized with the same key, so that trees can be compared over time (and CausedBy keeps pointing to the same state)
+func (s *State) Anonymize(key []byte) *State {
+	
+	a := s.Clone()
+	a.Walk(func(source_path []string, s_it *State) bool {
+		
+		s_it.Source = Pseudonym(key, s_it.Source)
+		s_it.Message = ""
+		s_it.RunbookURL = ""
+		s_it.Annotations = nil
+		
+		if s_it.CausedBy != "" {
+			caused_by := SplitPath(s_it.CausedBy)
+			for i, source := range caused_by {
+				caused_by[i] = Pseudonym(key, source)
+			}
+			s_it.CausedBy = strings.Join(caused_by, "/")
+		}
+		
+		if s_it.SLA != nil {
+			s_it.SLA.Tier = ""
+			if s_it.SLA.Target == 0 {
+				s_it.SLA = nil
+			}
+		}
+		
+		return true
+	})
+	
+	return a
+}
+// stable pseudonym of a source: the first 12 hexadecimal digits of its HMAC-SHA256 with key (an empty source stays empty)
+// note: without a (secret) key, the pseudonyms of common sources (e.g. "db" or "cpu") are easily guessed
+func Pseudonym(key []byte, source string) string {
+	
+	if source == "" {
+		return ""
+	}
+	
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(source))
+	
+	return hex.EncodeToString(mac.Sum(nil))[:12]
+}
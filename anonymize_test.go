@@ -0,0 +1,39 @@
+package jsonstate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	
+	s := FromMap(map[string]int{"db/primary": StateError, "web": StateOk})
+	s.Source = "acme"
+	s.AggregateLevels()
+	s.Tree[0].Message = "disk full on db1.acme.internal"
+	s.Tree[0].SLA = &SLA{Tier: "gold", Target: 99.9}
+	
+	a := s.Anonymize([]byte("key"))
+	
+	text := a.String()
+	for _, secret := range []string{"acme", "primary", "disk full", "gold"} {
+		if strings.Contains(text, secret) {
+			t.Errorf("anonymized tree contains %q:\n%s", secret, text)
+		}
+	}
+	
+	db := a.FindBySource(Pseudonym([]byte("key"), "db"))
+	if db == nil || db.Level != StateError || db.SLA == nil || db.SLA.Target != 99.9 {
+		t.Fatalf("anonymized db: %v", db)
+	}
+	if want := Pseudonym([]byte("key"), "db") + "/" + Pseudonym([]byte("key"), "primary"); a.CausedBy != want {
+		t.Errorf("caused by %q, want %q", a.CausedBy, want)
+	}
+	
+	if Pseudonym([]byte("key"), "db") == Pseudonym([]byte("other"), "db") || Pseudonym([]byte("key"), "") != "" {
+		t.Error("pseudonyms do not depend on the key")
+	}
+	if s.Tree[0].Message == "" {
+		t.Error("Anonymize changed the original tree")
+	}
+}
@@ -0,0 +1,304 @@
+package jsonstate
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a remediation action of a rule with RequireApproval, awaiting approval
+type ActionProposal struct {
+	ID uint64                `json:"id"`
+	Rule string              `json:"rule"`
+	Path string              `json:"path"`
+	Level int                `json:"level"`
+	Message string           `json:"message,omitempty"`
+	Time time.Time           `json:"time"` // when the action was proposed
+}
+type proposal struct {
+	ActionProposal
+	key remediationKey
+	t Transition
+}
+
+// an approval request of the admin API
+type approvalRequest struct {
+	ID uint64                `json:"id"`
+	Action string            `json:"action"` // "approve" or "reject"
+	Actor string             `json:"actor"`
+}
+
+// the actions awaiting approval, oldest first
+func (rem *Remediator) Proposals() []ActionProposal {
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	list := []ActionProposal{}
+	for _, p := range rem.proposals {
+		list = append(list, p.ActionProposal)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	
+	return list
+}
+// run a proposed action on behalf of actor, unless the cooldown or rate limit of the rule does not allow it (anymore), e.g. because another proposal of the rule was approved first, then the proposal is dropped (and proposed again after another After of the rule if the source does not recover)
+func (rem *Remediator) Approve(id uint64, actor string) error {
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	p, err := rem.decide(id)
+	if err != nil {
+		return err
+	}
+	
+	if reason := rem.limited(p.key, time.Now()); reason != "" {
+		rem.log(AuditEntry{
+			Actor: actor,
+			Action: "approve",
+			Path: p.Path,
+			Message: fmt.Sprintf("%s: dropped proposal %d: %s", p.Rule, p.ID, reason),
+		})
+		return fmt.Errorf("%w: proposal %d: %s", ErrRateLimited, p.ID, reason)
+	}
+	
+	rem.log(AuditEntry{
+		Actor: actor,
+		Action: "approve",
+		Path: p.Path,
+		Message: fmt.Sprintf("%s: approved proposal %d", p.Rule, p.ID),
+	})
+	
+	// run with the last transition, in case the level changed since the proposal
+	t := p.t
+	if pending := rem.pending[p.key]; pending != nil {
+		t = pending.t
+	}
+	rem.start(p.key, t, actor)
+	
+	return nil
+}
+// drop a proposed action on behalf of actor, it is proposed again after another After of the rule if the source does not recover
+func (rem *Remediator) Reject(id uint64, actor string) error {
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	p, err := rem.decide(id)
+	if err != nil {
+		return err
+	}
+	
+	rem.log(AuditEntry{
+		Actor: actor,
+		Action: "reject",
+		Path: p.Path,
+		Message: fmt.Sprintf("%s: rejected proposal %d", p.Rule, p.ID),
+	})
+	
+	return nil
+}
+// admin endpoint (e.g. /admin/remediation): GET lists the proposals, POST decides on one, with basic authentication of the users (name to password)
+// note: the request is a JSON object {"id": 3, "action": "approve"} (or "reject"), of which the actor is the authenticated user (an "actor" in the request is rejected if it is another user)
+// note: fails without users, or with a user without password, so that the endpoint cannot be used without authentication
+func (rem *Remediator) ApprovalHandler(users map[string]string) (http.Handler, error) {
+	
+	if len(users) == 0 {
+		return nil, errors.New("jsonstate: approval handler: no users")
+	}
+	for name, password := range users {
+		if name == "" || password == "" {
+			return nil, fmt.Errorf("jsonstate: approval handler: user %q without name or password", name)
+		}
+	}
+	
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		name, password, ok := req.BasicAuth()
+		if !ok || !checkPassword(users, name, password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="jsonstate"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		
+		switch req.Method {
+		case http.MethodGet, http.MethodHead:
+			
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rem.Proposals())
+			
+		case http.MethodPost:
+			
+			decision := approvalRequest{}
+			if err := json.NewDecoder(io.LimitReader(req.Body, 1 << 20)).Decode(&decision); err != nil {
+				http.Error(w, "invalid request: " + err.Error(), http.StatusBadRequest)
+				return
+			}
+			if decision.Actor != "" && decision.Actor != name {
+				http.Error(w, "actor is not the authenticated user", http.StatusForbidden)
+				return
+			}
+			decision.Actor = name
+			
+			var err error
+			switch decision.Action {
+			case ChatApprove:
+				err = rem.Approve(decision.ID, decision.Actor)
+			case ChatReject:
+				err = rem.Reject(decision.ID, decision.Actor)
+			default:
+				http.Error(w, "unknown action: " + decision.Action, http.StatusBadRequest)
+				return
+			}
+			switch {
+			case errors.Is(err, ErrProposalNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case errors.Is(err, ErrRateLimited):
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case errors.Is(err, ErrClosed):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			
+			w.WriteHeader(http.StatusNoContent)
+			
+		default:
+			
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}), nil
+}
+// endpoint for Slack interactive components (see Alerter.SlackHandler), with action_id "approve" or "reject", and the proposal ID as value
+func (rem *Remediator) SlackHandler(signing_secret string) (http.Handler, error) {
+	return slackHandler(signing_secret, rem.chatAction)
+}
+// endpoint for a Microsoft Teams outgoing webhook (see Alerter.TeamsHandler), the message text is "approve <id>" or "reject <id>"
+func (rem *Remediator) TeamsHandler(security_token string) (http.Handler, error) {
+	return teamsHandler(security_token, rem.chatAction)
+}
+
+// whether the password is the one of the user, in constant time (for the users that exist)
+func checkPassword(users map[string]string, name string, password string) bool {
+	
+	want, ok := users[name]
+	if !ok {
+		return false
+	}
+	
+	return subtle.ConstantTimeCompare([]byte(want), []byte(password)) == 1
+}
+func (rem *Remediator) chatAction(actor string, action string, value string) (string, error) {
+	
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(value), "#"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid proposal: %s", value)
+	}
+	
+	switch action {
+	
+	case ChatApprove:
+		
+		if err := rem.Approve(id, actor); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("proposal %d approved by %s", id, actor), nil
+		
+	case ChatReject:
+		
+		if err := rem.Reject(id, actor); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("proposal %d rejected by %s", id, actor), nil
+		
+	}
+	
+	return "", fmt.Errorf("unknown action: %s", action)
+}
+// take a proposal for a decision
+// note: must be called while holding the lock
+func (rem *Remediator) decide(id uint64) (*proposal, error) {
+	
+	if rem.closed {
+		return nil, fmt.Errorf("%w: remediator", ErrClosed)
+	}
+	
+	p := rem.proposals[id]
+	if p == nil {
+		return nil, fmt.Errorf("%w: %d", ErrProposalNotFound, id)
+	}
+	delete(rem.proposals, id)
+	
+	return p, nil
+}
+// note: must be called while holding the lock
+func (rem *Remediator) propose(key remediationKey, t Transition) {
+	
+	rem.proposal_seq++
+	p := &proposal{
+		ActionProposal: ActionProposal{
+			ID: rem.proposal_seq,
+			Rule: remediationName(key.rule),
+			Path: t.Path,
+			Level: t.To,
+			Message: t.Message,
+			Time: time.Now(),
+		},
+		key: key,
+		t: t,
+	}
+	rem.proposals[p.ID] = p
+	
+	rem.record(key, t, fmt.Sprintf("proposed as %d, awaiting approval", p.ID))
+	
+	if rem.OnProposal != nil {
+		
+		on_proposal := rem.OnProposal
+		action := p.ActionProposal
+		notify := func() {
+			on_proposal(action)
+		}
+		
+		select {
+		case rem.queue <- notify:
+		default:
+			rem.error(fmt.Errorf("jsonstate: remediation queue is full, dropped proposal %d", p.ID))
+		}
+	}
+}
+// the proposal of the rule and source path, or nil
+// note: must be called while holding the lock
+func (rem *Remediator) proposed(key remediationKey) *proposal {
+	
+	for _, p := range rem.proposals {
+		if p.key == key {
+			return p
+		}
+	}
+	
+	return nil
+}
+// drop the proposal of the rule and source path (if any)
+// note: must be called while holding the lock
+func (rem *Remediator) withdraw(key remediationKey, reason string) {
+	
+	if p := rem.proposed(key); p != nil {
+		delete(rem.proposals, p.ID)
+		rem.record(key, p.t, fmt.Sprintf("withdrew proposal %d: %s", p.ID, reason))
+	}
+}
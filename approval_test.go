@@ -0,0 +1,155 @@
+package jsonstate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a remediator with a rule that requires approval, and a proposal (or more) for each of the sources
+func newProposals(t *testing.T, audit *AuditLog, sources ...string) *Remediator {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	
+	r := NewRegistry("app")
+	rem := NewRemediator(ctx, r, audit)
+	err := rem.AddRule(&RemediationRule{
+		Name: "restart",
+		Pattern: "web/*",
+		MinLevel: StateError,
+		After: 10 * time.Millisecond,
+		MaxRuns: 1,
+		Per: time.Hour,
+		RequireApproval: true,
+		Action: ActionFunc(func(ctx context.Context, t Transition) error {
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	for _, source := range sources {
+		r.Component("web/" + source).Set(StateFault, "down")
+	}
+	
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rem.Proposals()) < len(sources) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d proposals", len(rem.Proposals()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	
+	return rem
+}
+func TestApprovalHandlerActor(t *testing.T) {
+	
+	audit := NewAuditLog(0)
+	rem := newProposals(t, audit, "1")
+	id := rem.Proposals()[0].ID
+	handler, err := rem.ApprovalHandler(map[string]string{"alice": "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	decide := func(body string, user string, password string) int {
+		
+		req := httptest.NewRequest(http.MethodPost, "/admin/remediation", strings.NewReader(body))
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		
+		return rec.Code
+	}
+	
+	if code := decide(fmt.Sprintf(`{"id": %d, "action": "approve", "actor": "mallory"}`, id), "", ""); code != http.StatusUnauthorized {
+		t.Errorf("without authentication: %d", code)
+	}
+	if code := decide(fmt.Sprintf(`{"id": %d, "action": "approve"}`, id), "alice", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("with a wrong password: %d", code)
+	}
+	if code := decide(fmt.Sprintf(`{"id": %d, "action": "approve", "actor": "bob"}`, id), "alice", "s3cr3t"); code != http.StatusForbidden {
+		t.Errorf("with another actor: %d", code)
+	}
+	if code := decide(fmt.Sprintf(`{"id": %d, "action": "approve"}`, id), "alice", "s3cr3t"); code != http.StatusNoContent {
+		t.Fatalf("approve: %d", code)
+	}
+	
+	approved := false
+	for _, entry := range audit.Entries() {
+		if entry.Action == "approve" {
+			approved = true
+			if entry.Actor != "alice" {
+				t.Errorf("approved by %q", entry.Actor)
+			}
+		}
+	}
+	if !approved {
+		t.Errorf("no approval in the audit log: %+v", audit.Entries())
+	}
+}
+func TestApprovalHandlerWithoutUsers(t *testing.T) {
+	
+	rem := newProposals(t, nil, "1")
+	for _, users := range []map[string]string{nil, {}, {"alice": ""}, {"": "s3cr3t"}} {
+		if _, err := rem.ApprovalHandler(users); err == nil {
+			t.Errorf("ApprovalHandler(%v) without authentication", users)
+		}
+	}
+}
+func TestApproveRateLimit(t *testing.T) {
+	
+	rem := newProposals(t, nil, "1", "2")
+	proposals := rem.Proposals()
+	
+	if err := rem.Approve(proposals[0].ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rem.Approve(proposals[1].ID, "alice"); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("approved beyond the rate limit: %v", err)
+	}
+}
+func TestApprovalHandlerStatus(t *testing.T) {
+	
+	rem := newProposals(t, nil, "1", "2")
+	proposals := rem.Proposals()
+	handler, err := rem.ApprovalHandler(map[string]string{"alice": "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	decide := func(id uint64) int {
+		
+		req := httptest.NewRequest(http.MethodPost, "/admin/remediation", strings.NewReader(fmt.Sprintf(`{"id": %d, "action": "approve"}`, id)))
+		req.SetBasicAuth("alice", "s3cr3t")
+		
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		
+		return rec.Code
+	}
+	
+	if code := decide(proposals[0].ID); code != http.StatusNoContent {
+		t.Errorf("approve: %d", code)
+	}
+	if code := decide(proposals[1].ID); code != http.StatusConflict {
+		t.Errorf("approve beyond the rate limit: %d", code)
+	}
+	if code := decide(1000); code != http.StatusNotFound {
+		t.Errorf("approve of an unknown proposal: %d", code)
+	}
+	
+	rem.Close()
+	if code := decide(proposals[1].ID); code != http.StatusServiceUnavailable {
+		t.Errorf("approve with a closed remediator: %d", code)
+	}
+}
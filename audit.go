@@ -0,0 +1,51 @@
+package jsonstate
+
+import (
+	"sync"
+	"time"
+)
+
+// who did what to which source path, and when
+type AuditEntry struct {
+	Time time.Time       `json:"time"`
+	Actor string         `json:"actor,omitempty"` // user name or ID, as reported by the integration
+	Action string        `json:"action"`
+	Path string          `json:"path,omitempty"`
+	Message string       `json:"message,omitempty"`
+}
+// in-memory log of manual actions (acknowledgements, silences, ...)
+type AuditLog struct {
+	mu sync.RWMutex
+	max int
+	entries []AuditEntry
+}
+
+// constructor: keep at most max entries (zero keeps everything)
+func NewAuditLog(max int) *AuditLog {
+	return &AuditLog{
+		max: max,
+	}
+}
+// add an entry (Time is set to now if zero)
+func (l *AuditLog) Record(e AuditEntry) {
+	
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	
+	l.entries = append(l.entries, e)
+	if l.max > 0 && len(l.entries) > l.max {
+		l.entries = append(l.entries[:0:0], l.entries[len(l.entries) - l.max:]...)
+	}
+}
+// a copy of all entries, oldest first
+func (l *AuditLog) Entries() []AuditEntry {
+	
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	
+	return append([]AuditEntry{}, l.entries...)
+}
@@ -0,0 +1,135 @@
+package jsonstate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// when notifications are active: within any of the Active windows (always, if there are none), but not within any of the Quiet windows
+type Calendar struct {
+	Timezone string       `json:"timezone,omitempty"` // IANA time zone name, local time if empty
+	Active []Window       `json:"active,omitempty"`
+	Quiet []Window        `json:"quiet,omitempty"`
+}
+// a recurring time window, e.g. {"days": ["sat", "sun"], "start": "00:00", "end": "24:00"}, or {"start": "22:00", "end": "07:00"} (which wraps past midnight, and then belongs to the day it starts on)
+type Window struct {
+	Days []string         `json:"days,omitempty"` // "mon", "tue", ... (or full names), every day if empty
+	Start string          `json:"start"` // "HH:MM"
+	End string            `json:"end"` // "HH:MM", up to "24:00"
+}
+
+// true if notifications are active at the given time
+func (c *Calendar) IsActive(t time.Time) (bool, error) {
+	
+	if c == nil {
+		return true, nil
+	}
+	
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return false, err
+		}
+		t = t.In(loc)
+	}
+	
+	active := len(c.Active) == 0
+	for _, w := range c.Active {
+		
+		in, err := w.Contains(t)
+		if err != nil {
+			return false, err
+		}
+		if in {
+			active = true
+			break
+		}
+	}
+	
+	for _, w := range c.Quiet {
+		
+		in, err := w.Contains(t)
+		if err != nil {
+			return false, err
+		}
+		if in {
+			active = false
+			break
+		}
+	}
+	
+	return active, nil
+}
+// true if the (local) time is within the window
+func (w *Window) Contains(t time.Time) (bool, error) {
+	
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false, err
+	}
+	
+	clock := t.Hour() * 60 + t.Minute()
+	
+	if start <= end {
+		if clock < start || clock >= end {
+			return false, nil
+		}
+		return w.hasDay(t.Weekday())
+	}
+	
+	// wraps past midnight: the part after midnight belongs to the previous day
+	if clock >= start {
+		return w.hasDay(t.Weekday())
+	}
+	if clock < end {
+		return w.hasDay((t.Weekday() + 6) % 7)
+	}
+	
+	return false, nil
+}
+
+func (w *Window) hasDay(day time.Weekday) (bool, error) {
+	
+	if len(w.Days) == 0 {
+		return true, nil
+	}
+	
+	for _, name := range w.Days {
+		
+		d, err := parseWeekday(name)
+		if err != nil {
+			return false, err
+		}
+		if d == day {
+			return true, nil
+		}
+	}
+	
+	return false, nil
+}
+// minutes since midnight of "HH:MM"
+func parseClock(clock string) (int, error) {
+	
+	var hour, minute int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute); err != nil || hour < 0 || minute < 0 || minute > 59 || hour * 60 + minute > 24 * 60 {
+		return 0, fmt.Errorf("jsonstate: invalid time of day: %q", clock)
+	}
+	
+	return hour * 60 + minute, nil
+}
+func parseWeekday(name string) (time.Weekday, error) {
+	
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d += 1 {
+		if full := strings.ToLower(d.String()); name == full || name == full[:3] {
+			return d, nil
+		}
+	}
+	
+	return 0, fmt.Errorf("jsonstate: invalid day: %q", name)
+}
@@ -0,0 +1,69 @@
+package jsonstate
+
+import (
+	"encoding/json"
+)
+
+// a State in the shape that charting libraries expect for hierarchical data (d3.hierarchy, ECharts sunburst/treemap)
+type HierarchyNode struct {
+	Name string                   `json:"name"`
+	Path string                   `json:"path,omitempty"`
+	Value int                     `json:"value"` // number of leaves, so that every leaf gets the same area
+	Level int                     `json:"level"`
+	LevelName string              `json:"level_name"`
+	Message string                `json:"message,omitempty"`
+	Color string                  `json:"color"` // d3
+	ItemStyle HierarchyItemStyle  `json:"itemStyle"` // ECharts
+	Children []*HierarchyNode     `json:"children,omitempty"`
+}
+type HierarchyItemStyle struct {
+	Color string  `json:"color"`
+}
+
+// convert the tree for charting libraries (one should probably call AggregateLevels() first)
+func (s *State) ToHierarchy() *HierarchyNode {
+	return rhierarchy(s, "", 0)
+}
+// same as ToHierarchy(), but encoded as JSON
+func (s *State) MarshalHierarchy() ([]byte, error) {
+	return json.Marshal(s.ToHierarchy())
+}
+
+func rhierarchy(rs *State, path string, depth int) *HierarchyNode {
+	
+	color := levelHexColor(rs.Level)
+	
+	node := &HierarchyNode{
+		Name: rs.Source,
+		Path: path,
+		Level: rs.Level,
+		LevelName: LevelString(rs.Level),
+		Message: rs.Message,
+		Color: color,
+		ItemStyle: HierarchyItemStyle{
+			Color: color,
+		},
+	}
+	
+	for _, rs_it := range rs.Tree {
+		
+		if rs_it == nil || depth >= MaxDepth {
+			continue
+		}
+		
+		rs_it_path := rs_it.Source
+		if path != "" {
+			rs_it_path = path + "/" + rs_it.Source
+		}
+		
+		child := rhierarchy(rs_it, rs_it_path, depth + 1)
+		node.Value += child.Value
+		node.Children = append(node.Children, child)
+	}
+	
+	if len(node.Children) == 0 {
+		node.Value = 1
+	}
+	
+	return node
+}
@@ -0,0 +1,301 @@
+package jsonstate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chat actions, as used in the action_id of Slack buttons, or as the first word of a Teams message
+const (
+	ChatAcknowledge string = "acknowledge"
+	ChatSilence string = "silence"
+	ChatApprove string = "approve" // see Remediator.SlackHandler
+	ChatReject string = "reject"
+)
+
+// maximum age of a signed Slack request, older requests are rejected to prevent replays
+var ChatMaxRequestAge = 5 * time.Minute
+
+// silence duration if a chat action does not specify one
+var ChatDefaultSilence = time.Hour
+
+// maximum size of a chat webhook request body
+const maxChatRequestSize = 1 << 20
+
+// endpoint for Slack interactive components (block_actions), verified with the signing secret of the Slack app, or an error if the signing secret is empty
+// note: a button has action_id "acknowledge" or "silence", and the source path as value (optionally followed by a space and a duration for silence, e.g. "db/replica1 30m")
+func (a *Alerter) SlackHandler(signing_secret string, audit *AuditLog) (http.Handler, error) {
+	return slackHandler(signing_secret, func(actor string, action string, value string) (string, error) {
+		return a.chatAction(actor, action, value, audit)
+	})
+}
+// endpoint for a Microsoft Teams outgoing webhook, verified with its (base64) security token, or an error if the security token is empty or not base64
+// note: the message text is "acknowledge <path>" or "silence <path> [duration]" (the mention of the webhook itself is ignored)
+func (a *Alerter) TeamsHandler(security_token string, audit *AuditLog) (http.Handler, error) {
+	return teamsHandler(security_token, func(actor string, action string, value string) (string, error) {
+		return a.chatAction(actor, action, value, audit)
+	})
+}
+
+// performs a chat action of actor, and returns the reply
+type chatActionFunc func(actor string, action string, value string) (string, error)
+
+// note: without a secret anyone could sign requests, so the handler is not built
+func slackHandler(signing_secret string, chat_action chatActionFunc) (http.Handler, error) {
+	
+	if signing_secret == "" {
+		return nil, fmt.Errorf("jsonstate: slack handler: empty signing secret")
+	}
+	
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		body, ok := readChatRequest(w, req)
+		if !ok {
+			return
+		}
+		
+		if err := verifySlackSignature(signing_secret, req.Header, body, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		var payload struct {
+			Type string `json:"type"`
+			User struct {
+				ID string `json:"id"`
+				Username string `json:"username"`
+			} `json:"user"`
+			Actions []struct {
+				ActionID string `json:"action_id"`
+				Value string `json:"value"`
+			} `json:"actions"`
+		}
+		if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+			http.Error(w, "invalid payload: " + err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		actor := payload.User.Username
+		if actor == "" {
+			actor = payload.User.ID
+		}
+		
+		replies := []string{}
+		for _, action := range payload.Actions {
+			
+			reply, err := chat_action(actor, action.ActionID, action.Value)
+			if err != nil {
+				reply = err.Error()
+			}
+			replies = append(replies, reply)
+		}
+		
+		// slack shows the response as an ephemeral message to the user
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"response_type": "ephemeral",
+			"replace_original": false,
+			"text": strings.Join(replies, "\n"),
+		})
+	}), nil
+}
+func teamsHandler(security_token string, chat_action chatActionFunc) (http.Handler, error) {
+	
+	if key, err := base64.StdEncoding.DecodeString(security_token); err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("jsonstate: teams handler: empty or invalid (base64) security token")
+	}
+	
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		body, ok := readChatRequest(w, req)
+		if !ok {
+			return
+		}
+		
+		if err := verifyTeamsSignature(security_token, req.Header, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		
+		var activity struct {
+			Text string `json:"text"`
+			From struct {
+				ID string `json:"id"`
+				Name string `json:"name"`
+			} `json:"from"`
+		}
+		if err := json.Unmarshal(body, &activity); err != nil {
+			http.Error(w, "invalid activity: " + err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		actor := activity.From.Name
+		if actor == "" {
+			actor = activity.From.ID
+		}
+		
+		// strip the <at>mention</at> of the webhook
+		text := activity.Text
+		if i := strings.Index(text, "</at>"); i >= 0 {
+			text = text[i + len("</at>"):]
+		}
+		
+		action, value, _ := strings.Cut(strings.TrimSpace(text), " ")
+		
+		reply, err := chat_action(actor, strings.ToLower(action), value)
+		if err != nil {
+			reply = err.Error()
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"type": "message",
+			"text": reply,
+		})
+	}), nil
+}
+
+// perform an acknowledge or silence action, and record it in the audit log (if any)
+func (a *Alerter) chatAction(actor string, action string, value string, audit *AuditLog) (string, error) {
+	
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("missing source path")
+	}
+	path := strings.Join(SplitPath(fields[0]), "/")
+	
+	entry := AuditEntry{
+		Actor: actor,
+		Action: action,
+		Path: path,
+	}
+	reply := ""
+	
+	switch action {
+	
+	case ChatAcknowledge:
+		
+		if !a.Acknowledge(path) {
+			reply = fmt.Sprintf("%s has no open incident", path)
+		} else {
+			reply = fmt.Sprintf("%s acknowledged by %s", path, actor)
+		}
+		entry.Message = reply
+		
+	case ChatSilence:
+		
+		d := ChatDefaultSilence
+		if len(fields) > 1 {
+			parsed, err := time.ParseDuration(fields[1])
+			if err != nil || parsed <= 0 {
+				return "", fmt.Errorf("invalid duration: %s", fields[1])
+			}
+			d = parsed
+		}
+		
+		until := time.Now().Add(d)
+		a.Silence(path, until)
+		
+		reply = fmt.Sprintf("%s silenced by %s until %s", path, actor, until.Format(time.RFC3339))
+		entry.Message = reply
+		
+	default:
+		
+		return "", fmt.Errorf("unknown action: %s", action)
+		
+	}
+	
+	if audit != nil {
+		audit.Record(entry)
+	}
+	
+	return reply, nil
+}
+
+func readChatRequest(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxChatRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	
+	return body, true
+}
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(signing_secret string, header http.Header, body []byte, now time.Time) error {
+	
+	if signing_secret == "" {
+		return fmt.Errorf("missing signing secret")
+	}
+	
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("missing signature")
+	}
+	
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > ChatMaxRequestAge || age < -ChatMaxRequestAge {
+		return fmt.Errorf("request too old")
+	}
+	
+	mac := hmac.New(sha256.New, []byte(signing_secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	
+	return nil
+}
+// https://learn.microsoft.com/en-us/microsoftteams/platform/webhooks-and-connectors/how-to/add-outgoing-webhook
+func verifyTeamsSignature(security_token string, header http.Header, body []byte) error {
+	
+	key, err := base64.StdEncoding.DecodeString(security_token)
+	if err != nil || len(key) == 0 {
+		return fmt.Errorf("invalid security token")
+	}
+	
+	signature, ok := strings.CutPrefix(header.Get("Authorization"), "HMAC ")
+	if !ok {
+		return fmt.Errorf("missing signature")
+	}
+	
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+	
+	return nil
+}
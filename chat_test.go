@@ -0,0 +1,142 @@
+package jsonstate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func slackSignature(signing_secret string, timestamp string, body string) string {
+	
+	mac := hmac.New(sha256.New, []byte(signing_secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+func teamsSignature(key []byte, body string) string {
+	
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	
+	return "HMAC " + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestChatHandlerRequiresSecret(t *testing.T) {
+	
+	chat_action := func(actor string, action string, value string) (string, error) {
+		return "", nil
+	}
+	
+	if _, err := slackHandler("", chat_action); err == nil {
+		t.Error("slack handler with an empty signing secret")
+	}
+	for _, security_token := range []string{"", "not base64!"} {
+		if _, err := teamsHandler(security_token, chat_action); err == nil {
+			t.Errorf("teams handler with security token %q", security_token)
+		}
+	}
+}
+func TestVerifySlackSignature(t *testing.T) {
+	
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := "payload=%7B%7D"
+	
+	header := func(signature string, timestamp string) http.Header {
+		h := http.Header{}
+		h.Set("X-Slack-Request-Timestamp", timestamp)
+		h.Set("X-Slack-Signature", signature)
+		return h
+	}
+	
+	if err := verifySlackSignature("s3cr3t", header(slackSignature("s3cr3t", timestamp, body), timestamp), []byte(body), now); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := verifySlackSignature("s3cr3t", header(slackSignature("guess", timestamp, body), timestamp), []byte(body), now); err == nil {
+		t.Error("signature with the wrong secret")
+	}
+	if err := verifySlackSignature("", header(slackSignature("", timestamp, body), timestamp), []byte(body), now); err == nil {
+		t.Error("signature with an empty secret")
+	}
+	
+	old := strconv.FormatInt(now.Add(-2 * ChatMaxRequestAge).Unix(), 10)
+	if err := verifySlackSignature("s3cr3t", header(slackSignature("s3cr3t", old, body), old), []byte(body), now); err == nil {
+		t.Error("replayed request")
+	}
+}
+func TestTeamsHandler(t *testing.T) {
+	
+	key := []byte("0123456789abcdef")
+	
+	actions := []string{}
+	handler, err := teamsHandler(base64.StdEncoding.EncodeToString(key), func(actor string, action string, value string) (string, error) {
+		actions = append(actions, actor + " " + action + " " + value)
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	body := `{"text": "<at>jsonstate</at> acknowledge db", "from": {"name": "alice"}}`
+	for signature, status := range map[string]int{
+		teamsSignature(key, body): http.StatusOK,
+		teamsSignature(nil, body): http.StatusUnauthorized,
+		"": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Authorization", signature)
+		
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		
+		if w.Code != status {
+			t.Errorf("signature %q: status %d, want %d", signature, w.Code, status)
+		}
+	}
+	
+	if len(actions) != 1 || actions[0] != "alice acknowledge db" {
+		t.Errorf("actions %q", actions)
+	}
+}
+func TestSlackHandler(t *testing.T) {
+	
+	actions := []string{}
+	handler, err := slackHandler("s3cr3t", func(actor string, action string, value string) (string, error) {
+		actions = append(actions, actor + " " + action + " " + value)
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	body := "payload=" + url.QueryEscape(`{"type": "block_actions", "user": {"username": "alice"}, "actions": [{"action_id": "silence", "value": "db 30m"}]}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	
+	for signing_secret, status := range map[string]int{
+		"s3cr3t": http.StatusOK,
+		"": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", slackSignature(signing_secret, timestamp, body))
+		
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		
+		if w.Code != status {
+			t.Errorf("signed with %q: status %d, want %d", signing_secret, w.Code, status)
+		}
+	}
+	
+	if len(actions) != 1 || actions[0] != "alice silence db 30m" {
+		t.Errorf("actions %q", actions)
+	}
+}
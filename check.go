@@ -0,0 +1,70 @@
+package jsonstate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maximum depth of a tree: Parse and FromProto reject deeper trees, and the recursive tree operations do not descend any deeper (which also ends them on self-referential trees)
+var MaxDepth = 256
+
+// check the structure of the recursive tree: no nil states, no state that appears twice (e.g. a tree that contains itself), and at most MaxDepth deep
+// note: the returned error joins an error per problem, each wrapping ErrMalformedTree
+func (s *State) CheckTree() error {
+	
+	if s == nil {
+		return fmt.Errorf("%w: nil state", ErrMalformedTree)
+	}
+	
+	errs := []error{}
+	rcheck(s, nil, map[*State]bool{s: true}, false, &errs)
+	
+	return errors.Join(errs...)
+}
+// remove what CheckTree reports from the recursive tree (nil states, states that appear again, and states deeper than MaxDepth), and return what was removed like CheckTree
+func (s *State) Repair() error {
+	
+	if s == nil {
+		return fmt.Errorf("%w: nil state", ErrMalformedTree)
+	}
+	
+	errs := []error{}
+	rcheck(s, nil, map[*State]bool{s: true}, true, &errs)
+	
+	return errors.Join(errs...)
+}
+func rcheck(rs *State, source_path []string, seen map[*State]bool, repair bool, errs *[]error) {
+	
+	tree := rs.Tree[:0:0]
+	for i, rs_it := range rs.Tree {
+		
+		if rs_it == nil {
+			*errs = append(*errs, fmt.Errorf("%w: nil state %d in /%s", ErrMalformedTree, i, strings.Join(source_path, "/")))
+			continue
+		}
+		
+		rs_it_path := append(source_path[:len(source_path):len(source_path)], rs_it.Source)
+		
+		if seen[rs_it] {
+			*errs = append(*errs, fmt.Errorf("%w: /%s appears more than once", ErrMalformedTree, strings.Join(rs_it_path, "/")))
+			continue
+		}
+		if len(rs_it_path) > MaxDepth {
+			*errs = append(*errs, fmt.Errorf("%w: /%s is deeper than %d", ErrMalformedTree, strings.Join(rs_it_path, "/"), MaxDepth))
+			continue
+		}
+		seen[rs_it] = true
+		
+		rcheck(rs_it, rs_it_path, seen, repair, errs)
+		tree = append(tree, rs_it)
+	}
+	
+	if repair && len(tree) != len(rs.Tree) {
+		
+		rs.Tree = tree
+		if len(tree) == 0 {
+			rs.Tree = nil // a leaf again
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package jsonstate
+
+import (
+	"strings"
+	"time"
+)
+
+// derived metrics about the stability of the monitored system over a time window
+type Churn struct {
+	Window time.Duration                `json:"window"`
+	TransitionsPerMinute map[string]float64 `json:"transitions_per_minute"` // per subtree (source path, "" is the whole tree)
+	MeanTimeInLevel map[string]float64  `json:"mean_time_in_level"` // seconds, per level name, of the time spent in the level before transitions in the window
+	NonOK int                           `json:"non_ok"` // number of leaf states worse than OK
+}
+
+// churn over the window that ends at end (NonOK is left zero, see Registry.Churn)
+func (h *History) Churn(end time.Time, window time.Duration) *Churn {
+	
+	churn := &Churn{
+		Window: window,
+		TransitionsPerMinute: map[string]float64{},
+		MeanTimeInLevel: map[string]float64{},
+	}
+	
+	counts := map[string]int{}
+	durations := map[string]time.Duration{}
+	samples := map[string]int{}
+	
+	for _, t := range h.Transitions("", end.Add(-window)) {
+		
+		if t.Time.After(end) {
+			break
+		}
+		
+		// a transition counts for the source and every subtree it is in
+		source_path := SplitPath(t.Path)
+		for i := 0; i <= len(source_path); i += 1 {
+			counts[strings.Join(source_path[:i], "/")] += 1
+		}
+		
+		if t.Duration > 0 {
+			level := LevelString(t.From)
+			durations[level] += t.Duration
+			samples[level] += 1
+		}
+	}
+	
+	if minutes := window.Minutes(); minutes > 0 {
+		for path, count := range counts {
+			churn.TransitionsPerMinute[path] = float64(count) / minutes
+		}
+	}
+	for level, duration := range durations {
+		churn.MeanTimeInLevel[level] = (duration / time.Duration(samples[level])).Seconds()
+	}
+	
+	return churn
+}
+// churn of the history over the window until now, with the current number of leaf states worse than OK in the registry
+func (r *Registry) Churn(h *History, window time.Duration) *Churn {
+	
+	churn := h.Churn(time.Now(), window)
+	churn.NonOK = r.Snapshot().CountNonOK()
+	
+	return churn
+}
+// number of leaf states (states without a tree) worse than OK (Attention or worse)
+func (s *State) CountNonOK() int {
+	
+	count := 0
+	s.Walk(func(source_path []string, s_it *State) bool {
+		if len(s_it.Tree) == 0 && s_it.Level >= StateAttention {
+			count += 1
+		}
+		return true
+	})
+	
+	return count
+}
@@ -0,0 +1,37 @@
+package jsonstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountNonOK(t *testing.T) {
+	
+	s := FromMap(map[string]int{
+		"db/replica1": StateOk,
+		"db/replica2": 250, // still in the OK band
+		"db/replica3": StateAttention,
+		"web": StateFault,
+		"cache": StateUnknown,
+	})
+	
+	if n := s.CountNonOK(); n != 2 {
+		t.Errorf("CountNonOK() = %d, want 2", n)
+	}
+}
+func TestChurn(t *testing.T) {
+	
+	end := time.Now()
+	h := NewHistory(0)
+	h.Record(Transition{Path: "db/replica1", From: StateOk, To: StateError, Time: end.Add(-50 * time.Minute), Duration: time.Hour})
+	h.Record(Transition{Path: "db/replica1", From: StateError, To: StateOk, Time: end.Add(-20 * time.Minute), Duration: 30 * time.Minute})
+	h.Record(Transition{Path: "web", From: StateOk, To: StateWarning, Time: end.Add(-2 * time.Hour), Duration: time.Hour})
+	
+	churn := h.Churn(end, time.Hour)
+	if churn.TransitionsPerMinute[""] != 2.0 / 60 || churn.TransitionsPerMinute["db"] != 2.0 / 60 || churn.TransitionsPerMinute["web"] != 0 {
+		t.Errorf("transitions per minute %v", churn.TransitionsPerMinute)
+	}
+	if churn.MeanTimeInLevel[LevelString(StateError)] != 1800 || churn.MeanTimeInLevel[LevelString(StateOk)] != 3600 {
+		t.Errorf("mean time in level %v", churn.MeanTimeInLevel)
+	}
+}
@@ -0,0 +1,87 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CloudEvents type of transition events
+const CloudEventTransition string = "io.github.jetibest.jsonstate.transition"
+
+// CloudEvents source of transition events (a URI-reference that identifies the process), e.g. "//example.com/myservice"
+var CloudEventSource = "/jsonstate"
+
+// CloudEvents 1.0 envelope (structured mode, JSON event format)
+type CloudEvent struct {
+	SpecVersion string         `json:"specversion"`
+	ID string                  `json:"id"`
+	Source string              `json:"source"`
+	Type string                `json:"type"`
+	Subject string             `json:"subject,omitempty"`
+	Time string                `json:"time,omitempty"`
+	DataContentType string     `json:"datacontenttype,omitempty"`
+	Data json.RawMessage       `json:"data,omitempty"`
+}
+
+// the transition as CloudEvent, with the source path as subject
+func (t Transition) ToCloudEvent() (*CloudEvent, error) {
+	
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	
+	// transitions that are not from a Registry (see Alerter.Observe) have no ID
+	id := strconv.FormatUint(t.ID, 10)
+	if t.ID == 0 {
+		id = t.Path + "@" + t.Time.UTC().Format(time.RFC3339Nano)
+	}
+	
+	e := &CloudEvent{
+		SpecVersion: "1.0",
+		ID: id,
+		Source: CloudEventSource,
+		Type: CloudEventTransition,
+		Subject: t.Path,
+		DataContentType: "application/json",
+		Data: data,
+	}
+	if !t.Time.IsZero() {
+		e.Time = t.Time.UTC().Format(time.RFC3339Nano)
+	}
+	
+	return e, nil
+}
+// decode a transition from a CloudEvent in the JSON event format
+func FromCloudEvent(data []byte) (Transition, error) {
+	
+	e := &CloudEvent{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return Transition{}, err
+	}
+	
+	return e.Transition()
+}
+// the transition in the data of the event
+func (e *CloudEvent) Transition() (Transition, error) {
+	
+	if e.SpecVersion != "1.0" {
+		return Transition{}, fmt.Errorf("jsonstate: unsupported CloudEvents specversion %q", e.SpecVersion)
+	}
+	if e.Type != CloudEventTransition {
+		return Transition{}, fmt.Errorf("jsonstate: unexpected CloudEvents type %q", e.Type)
+	}
+	if len(e.Data) == 0 {
+		return Transition{}, errors.New("jsonstate: CloudEvent without data")
+	}
+	
+	t := Transition{}
+	if err := json.Unmarshal(e.Data, &t); err != nil {
+		return Transition{}, err
+	}
+	
+	return t, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	
+	"github.com/jetibest/jsonstate"
+)
+
+// configuration of the agent
+// note: the configuration is YAML (see jsonstate.YAMLToJSON) or JSON, e.g.
+//   source: myhost
+//   interval: 30s
+//   reporter: {type: http, url: "https://status.example.com/state/myhost"}
+//   probes:
+//   - {path: web, type: http, url: "http://localhost:8080/health"}
+//   - {path: db, type: tcp, address: "localhost:5432", interval: 10s}
+//   - path: disk
+//     type: exec
+//     command: [/usr/local/bin/check-disk]
+//     interval: 5m
+//   - path: queue
+//     type: gauge
+//     name: queue depth
+//     command: [/usr/local/bin/queue-depth]
+//     rates: [{rate: 100, for: 5m, level: warning}]
+type agentConfig struct {
+	Source string                      `json:"source,omitempty"` // source of the root state, the hostname if empty
+	Interval string                    `json:"interval,omitempty"` // time between reports, and the default interval of probes (30s if empty)
+	Reporter jsonstate.ReporterConfig  `json:"reporter"`
+	Probes []jsonstate.ProbeConfig     `json:"probes"`
+}
+
+// run the probes of the configuration, and report the tree until interrupted
+func agent(args []string) int {
+	
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	config_path := flags.String("config", "agent.yaml", "configuration file (YAML or JSON)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s agent [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	
+	config, err := loadAgentConfig(*config_path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+		return 1
+	}
+	
+	interval := 30 * time.Second
+	if config.Interval != "" {
+		if interval, err = time.ParseDuration(config.Interval); err != nil || interval <= 0 {
+			fmt.Fprintf(os.Stderr, "jsonstate: %s: invalid interval: %s\n", *config_path, config.Interval)
+			return 1
+		}
+	}
+	
+	reporter, err := jsonstate.NewReporter(config.Reporter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonstate: %s: %v\n", *config_path, err)
+		return 1
+	}
+	
+	source := config.Source
+	if source == "" {
+		source, _ = os.Hostname()
+	}
+	registry := jsonstate.NewRegistry(source)
+	
+	scheduler := jsonstate.NewScheduler(registry, interval)
+	for _, probe := range config.Probes {
+		if err := scheduler.AddConfig(probe); err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %s: %v\n", *config_path, err)
+			return 1
+		}
+	}
+	
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	
+	go scheduler.Run(ctx)
+	
+	// give the probes a moment for their first check, so that the first report is not all Unknown
+	select {
+	case <-ctx.Done():
+		return 0
+	case <-time.After(time.Second):
+	}
+	
+	jsonstate.NewPeriodicReporter(registry.Snapshot, reporter, interval).Run(ctx, func(err error) {
+		fmt.Fprintf(os.Stderr, "jsonstate: report: %v\n", err)
+	})
+	
+	return 0
+}
+
+func loadAgentConfig(path string) (*agentConfig, error) {
+	
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	
+	if !json.Valid(data) {
+		if data, err = jsonstate.YAMLToJSON(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	
+	config := &agentConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	
+	return config, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	
+	"github.com/jetibest/jsonstate"
+)
+
+// evaluate an expression (see jsonstate.ParseExpression), e.g.
+//   jsonstate eval -var region=eu 'worst(db/*) if region=eu else ok' state.json
+//   jsonstate eval -context state "level >= Warning && path ~ 'db/**'" https://example.com/state/
+//   jsonstate eval -context transition -transition '{"path": "db/replica1", "from": 200, "to": 500}' 'to >= Error && path ~ db/*'
+func eval(args []string) int {
+	
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	context := flags.String("context", string(jsonstate.ExprSynthetic), "where the expression is used: synthetic (prints the level), state (prints the matching states) or transition (prints whether it matches)")
+	input_format := flags.String("input", "", "input format (by default detected from the file extension or Content-Type, or else json)")
+	timeout := flags.Duration("timeout", 30 * time.Second, "maximum time to fetch a URL")
+	transition := flags.String("transition", "", "the transition for -context transition, as JSON (e.g. {\"path\": \"db/replica1\", \"from\": 200, \"to\": 500})")
+	flags.Func("var", "set a variable (name=value, may be repeated)", func(value string) error {
+		
+		name, value, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("expected name=value")
+		}
+		jsonstate.RegisterVariable(name, value)
+		
+		return nil
+	})
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s eval [flags] expression [file|url|-]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+	
+	// type errors are reported before loading anything
+	e, err := jsonstate.ParseExpression(jsonstate.ExprContext(*context), flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+		return 1
+	}
+	
+	if e.Context() == jsonstate.ExprTransition {
+		
+		t := jsonstate.Transition{}
+		if err := json.Unmarshal([]byte(*transition), &t); err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: -transition: %v\n", err)
+			return 1
+		}
+		
+		ok, err := e.MatchTransition(t)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+			return 1
+		}
+		
+		fmt.Println(ok)
+		return 0
+	}
+	
+	input := "-"
+	if flags.NArg() > 1 {
+		input = flags.Arg(1)
+	}
+	
+	ctx, cancel := fetchContext(*timeout)
+	s, err := load(ctx, input, *input_format)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+		return 1
+	}
+	s.AggregateLevels()
+	
+	if e.Context() == jsonstate.ExprState {
+		
+		data, err := renderQuery(s, flags.Arg(0), "text")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+			return 1
+		}
+		
+		os.Stdout.Write(data)
+		return 0
+	}
+	
+	level, err := e.Level(s, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+		return 1
+	}
+	
+	fmt.Printf("%d %s\n", level, jsonstate.LevelString(level))
+	return 0
+}
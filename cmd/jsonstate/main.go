@@ -0,0 +1,330 @@
+// command jsonstate renders a state document (a file, "-" for stdin, or the URL of a /state/ endpoint) in one of the supported formats
+// with "jsonstate agent", it runs probes and reports the resulting tree instead (see agent.go)
+// with "jsonstate eval", it evaluates an expression against a state document, for testing rules (see eval.go)
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	
+	"github.com/jetibest/jsonstate"
+)
+
+func main() {
+	
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		os.Exit(agent(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(eval(os.Args[2:]))
+	}
+	
+	format := flag.String("format", "text", "output format: " + strings.Join(jsonstate.Codecs(), ", "))
+	input_format := flag.String("input", "", "input format (by default detected from the file extension or Content-Type, or else json)")
+	aggregate := flag.Bool("aggregate", true, "aggregate levels before rendering")
+	sorted := flag.Bool("sort", false, "sort children by level, worst first")
+	synthetics := flag.String("synthetics", "", "tree config with synthetic nodes computed from expressions (JSON, see jsonstate.LoadSynthetics), applied after aggregating")
+	explain := flag.Bool("explain", false, "print why every computed level is what it is, instead of the tree")
+	timeout := flag.Duration("timeout", 30 * time.Second, "maximum time to fetch a URL")
+	locale := flag.String("locale", "", "language of durations and numbers in text, table and html output, e.g. nb or de-DE (default en)")
+	width := flag.Int("width", 0, "wrap the bars of the bars and colorbars formats after this many children (0 for no wrapping)")
+	anonymize := flag.String("anonymize", "", "file with a secret key, to replace the sources by pseudonyms and remove messages, e.g. to share the tree with a vendor (see jsonstate.State.Anonymize)")
+	watch := flag.Duration("watch", 0, "fetch and redraw the screen at this interval until interrupted, e.g. 5s with -format colorbars")
+	query := flag.String("query", "", "only print the states matching a query, e.g. \"level >= Warning && source ~ 'db/*'\" (formats: text, json, flat, ndjson)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file|url|-]\n       %s agent [-config agent.yaml]\n       %s eval [flags] expression [file|url|-]\n", os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	
+	if *locale != "" {
+		if err := jsonstate.SetLocale(*locale); err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	
+	var anonymize_key []byte
+	if *anonymize != "" {
+		
+		key, err := os.ReadFile(*anonymize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+			os.Exit(2)
+		}
+		anonymize_key = bytes.TrimSpace(key)
+	}
+	
+	input := "-"
+	if flag.NArg() > 0 {
+		input = flag.Arg(0)
+	}
+	if *watch > 0 && input == "-" {
+		fmt.Fprintln(os.Stderr, "jsonstate: -watch needs a file or url")
+		os.Exit(2)
+	}
+	
+	ctx, cancel := fetchContext(*timeout)
+	s, err := load(ctx, input, *input_format)
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+		os.Exit(1)
+	}
+	
+	if *synthetics != "" {
+		if err := loadSynthetics(*synthetics); err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	if *explain {
+		for _, e := range s.Explain() {
+			fmt.Printf("/%s: %d %s by %s: %s", e.Path, e.Level, jsonstate.LevelString(e.Level), e.Rule, e.Reason)
+			if e.CausedBy != "" {
+				fmt.Printf(" (caused by %s)", e.CausedBy)
+			}
+			fmt.Println()
+			for _, decision := range e.Trace {
+				fmt.Printf("    %s\n", decision)
+			}
+		}
+		os.Exit(0)
+	}
+	
+	show := func(s *jsonstate.State) ([]byte, error) {
+		
+		if *aggregate {
+			s.AggregateLevels().ApplySynthetics()
+		}
+		if *sorted {
+			s.SortByLevel()
+		}
+		if anonymize_key != nil {
+			s = s.Anonymize(anonymize_key)
+		}
+		
+		if *query != "" {
+			return renderQuery(s, *query, *format)
+		}
+		return render(s, *format, *width)
+	}
+	
+	if *watch <= 0 {
+		
+		data, err := show(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jsonstate: %v\n", err)
+			os.Exit(1)
+		}
+		
+		os.Stdout.Write(data)
+		return
+	}
+	
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	
+	// a failed fetch is shown above the last tree that was fetched
+	var fetch_err error
+	for {
+		
+		data, err := show(s)
+		if err != nil {
+			data = []byte(fmt.Sprintf("jsonstate: %v\n", err))
+		}
+		if fetch_err != nil {
+			data = append([]byte(fmt.Sprintf("jsonstate: %v\n", fetch_err)), data...)
+		}
+		
+		os.Stdout.WriteString("\x1b[H\x1b[2J") // clear the screen
+		os.Stdout.Write(data)
+		
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*watch):
+		}
+		
+		fetch_ctx, cancel := context.WithTimeout(ctx, *timeout)
+		s_it, err := load(fetch_ctx, input, *input_format)
+		cancel()
+		
+		fetch_err = err
+		if err == nil {
+			s = s_it
+		}
+	}
+}
+
+// interrupted by SIGINT or SIGTERM, or after timeout
+func fetchContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+func load(ctx context.Context, input string, format string) (*jsonstate.State, error) {
+	
+	var r io.Reader
+	content_type := ""
+	
+	if input == "-" {
+		
+		r = os.Stdin
+		
+	} else if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+		
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, input, nil)
+		if err != nil {
+			return nil, err
+		}
+		
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: %s", input, resp.Status)
+		}
+		r = resp.Body
+		content_type = resp.Header.Get("Content-Type")
+		
+	} else {
+		
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		
+		r = f
+	}
+	
+	codec, err := inputCodec(input, format, content_type)
+	if err != nil {
+		return nil, err
+	}
+	
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input, err)
+	}
+	
+	s, err := codec.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input, err)
+	}
+	
+	return s, nil
+}
+
+func inputCodec(input string, format string, content_type string) (jsonstate.Codec, error) {
+	
+	if format != "" {
+		codec, ok := jsonstate.CodecByName(format)
+		if !ok {
+			return nil, fmt.Errorf("unknown input format: %s", format)
+		}
+		return codec, nil
+	}
+	
+	if _, codec, ok := jsonstate.DecoderByContentType(content_type); ok {
+		return codec, nil
+	}
+	if _, codec, ok := jsonstate.CodecForFile(input); ok && input != "-" {
+		return codec, nil
+	}
+	
+	codec, _ := jsonstate.CodecByName("json")
+	return codec, nil
+}
+
+func render(s *jsonstate.State, format string, width int) ([]byte, error) {
+	
+	// indented for humans
+	switch format {
+	case "json":
+		return json.MarshalIndent(s, "", "  ")
+	case "flat":
+		return json.MarshalIndent(s.Flatten(), "", "  ")
+	case "bars":
+		return []byte(s.Bars(width)), nil
+	case "colorbars":
+		return []byte(s.ColorBars(width)), nil
+	}
+	
+	codec, ok := jsonstate.CodecByName(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	
+	return codec.Marshal(s)
+}
+
+func renderQuery(s *jsonstate.State, query string, format string) ([]byte, error) {
+	
+	list, err := s.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	
+	switch format {
+	case "text":
+		var sb strings.Builder
+		for _, item := range list {
+			sb.WriteString(fmt.Sprintf("/%s: %d %s", item.Path, item.Level, jsonstate.LevelString(item.Level)))
+			if item.Message != "" {
+				sb.WriteString(": " + item.Message)
+			}
+			sb.WriteString("\n")
+		}
+		return []byte(sb.String()), nil
+	case "json", "flat":
+		return json.MarshalIndent(list, "", "  ")
+	case "ndjson":
+		var sb strings.Builder
+		for _, item := range list {
+			line, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			sb.Write(line)
+			sb.WriteString("\n")
+		}
+		return []byte(sb.String()), nil
+	}
+	
+	return nil, fmt.Errorf("format not supported with -query: %s", format)
+}
+func loadSynthetics(path string) error {
+	
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	
+	if err := jsonstate.LoadSynthetics(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	
+	return nil
+}
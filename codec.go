@@ -0,0 +1,271 @@
+package jsonstate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// a wire format of a tree, registered by name with RegisterCodec, and used by Handler (?format=<name> or the Accept header), SaveFile/LoadFile (by file extension) and the CLI
+type Codec interface {
+	Marshal(s *State) ([]byte, error)
+	Unmarshal(data []byte) (*State, error) // returns an error wrapping errors.ErrUnsupported for formats that are output-only
+	ContentType() string
+}
+
+// adapter to use plain functions as Codec (unmarshal may be nil for output-only formats)
+type CodecFuncs struct {
+	Type string
+	MarshalFunc func(s *State) ([]byte, error)
+	UnmarshalFunc func(data []byte) (*State, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs = map[string]Codec{}
+)
+
+func init() {
+	
+	RegisterCodec("json", CodecFuncs{
+		Type: "application/json",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return json.Marshal(s)
+		},
+		UnmarshalFunc: Parse, // also older schema versions (see Migrate)
+	})
+	RegisterCodec("flat", CodecFuncs{
+		Type: "application/json",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return json.Marshal(s.Flatten())
+		},
+		UnmarshalFunc: Parse,
+	})
+	RegisterCodec("ndjson", CodecFuncs{
+		Type: "application/x-ndjson",
+		MarshalFunc: (*State).MarshalNDJSON,
+		UnmarshalFunc: unmarshalNDJSON,
+	})
+	RegisterCodec("proto", CodecFuncs{
+		Type: "application/x-protobuf",
+		MarshalFunc: (*State).ToProto,
+		UnmarshalFunc: FromProto,
+	})
+	RegisterCodec("text", CodecFuncs{
+		Type: "text/plain; charset=utf-8",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return []byte(s.String()), nil
+		},
+	})
+	RegisterCodec("color", CodecFuncs{
+		Type: "text/plain; charset=utf-8",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return []byte(s.ColorString()), nil
+		},
+	})
+	RegisterCodec("table", CodecFuncs{
+		Type: "text/plain; charset=utf-8",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return []byte(s.Table()), nil
+		},
+	})
+	RegisterCodec("bars", CodecFuncs{
+		Type: "text/plain; charset=utf-8",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return []byte(s.Bars(0)), nil
+		},
+	})
+	RegisterCodec("colorbars", CodecFuncs{
+		Type: "text/plain; charset=utf-8",
+		MarshalFunc: func(s *State) ([]byte, error) {
+			return []byte(s.ColorBars(0)), nil
+		},
+	})
+	RegisterCodec("csv", CodecFuncs{
+		Type: "text/csv; charset=utf-8",
+		MarshalFunc: (*State).MarshalCSV,
+	})
+	RegisterCodec("tsv", CodecFuncs{
+		Type: "text/tab-separated-values; charset=utf-8",
+		MarshalFunc: (*State).MarshalTSV,
+	})
+	RegisterCodec("yaml", CodecFuncs{
+		Type: "application/yaml",
+		MarshalFunc: (*State).ToYAML,
+		UnmarshalFunc: ParseYAML,
+	})
+	RegisterCodec("html", CodecFuncs{
+		Type: "text/html; charset=utf-8",
+		MarshalFunc: (*State).ToHTML,
+	})
+	RegisterCodec("dot", CodecFuncs{
+		Type: "text/vnd.graphviz",
+		MarshalFunc: (*State).MarshalDOT,
+	})
+	RegisterCodec("mermaid", CodecFuncs{
+		Type: "text/vnd.mermaid",
+		MarshalFunc: (*State).MarshalMermaid,
+	})
+	RegisterCodec("compact", CodecFuncs{
+		Type: "application/json",
+		MarshalFunc: (*State).MarshalCompact,
+		UnmarshalFunc: ParseCompact,
+	})
+	RegisterCodec("legacy", CodecFuncs{
+		Type: "application/json",
+		MarshalFunc: (*State).MarshalLegacy,
+		UnmarshalFunc: Parse,
+	})
+}
+
+// register a codec (replacing any codec with the same name), the name is also the file extension and the value of ?format= in Handler
+func RegisterCodec(name string, c Codec) {
+	
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	
+	codecs[strings.ToLower(name)] = c
+}
+// get a registered codec by name (case-insensitive)
+func CodecByName(name string) (Codec, bool) {
+	
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	
+	c, ok := codecs[strings.ToLower(name)]
+	return c, ok
+}
+// get the registered codec for a media type (parameters are ignored), e.g. from an Accept header ("json" is preferred if several codecs share a media type)
+func CodecByContentType(content_type string) (string, Codec, bool) {
+	return codecByContentType(content_type, false)
+}
+// like CodecByContentType, but skips output-only codecs, to decode e.g. a request body by its Content-Type header (none is found for "text/plain")
+func DecoderByContentType(content_type string) (string, Codec, bool) {
+	return codecByContentType(content_type, true)
+}
+func codecByContentType(content_type string, decode bool) (string, Codec, bool) {
+	
+	media_type, _, err := mime.ParseMediaType(content_type)
+	if err != nil {
+		return "", nil, false
+	}
+	
+	for _, name := range Codecs() {
+		
+		c, _ := CodecByName(name)
+		if decode && !decodable(c) {
+			continue
+		}
+		if codec_type, _, err := mime.ParseMediaType(c.ContentType()); err == nil && codec_type == media_type {
+			return name, c, true
+		}
+	}
+	
+	return "", nil, false
+}
+// whether Unmarshal may succeed, false for a CodecFuncs without UnmarshalFunc (other codecs cannot tell)
+func decodable(c Codec) bool {
+	
+	switch c := c.(type) {
+	case CodecFuncs:
+		return c.UnmarshalFunc != nil
+	case *CodecFuncs:
+		return c.UnmarshalFunc != nil
+	}
+	
+	return true
+}
+// get the registered codec for a file name by its extension (ignoring a trailing ".gz"), e.g. "state.yaml.gz" is "yaml"
+func CodecForFile(path string) (string, Codec, bool) {
+	
+	name := strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(path, ".gz")), ".")
+	if name == "" {
+		return "", nil, false
+	}
+	
+	c, ok := CodecByName(name)
+	return strings.ToLower(name), c, ok
+}
+// names of the registered codecs (sorted, with "json" first)
+func Codecs() []string {
+	
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	
+	names := []string{}
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "json" || names[j] == "json" {
+			return names[i] == "json"
+		}
+		return names[i] < names[j]
+	})
+	
+	return names
+}
+
+func (c CodecFuncs) Marshal(s *State) ([]byte, error) {
+	return c.MarshalFunc(s)
+}
+func (c CodecFuncs) Unmarshal(data []byte) (*State, error) {
+	
+	if c.UnmarshalFunc == nil {
+		return nil, fmt.Errorf("jsonstate: decoding %s: %w", c.Type, errors.ErrUnsupported)
+	}
+	
+	return c.UnmarshalFunc(data)
+}
+func (c CodecFuncs) ContentType() string {
+	return c.Type
+}
+
+func unmarshalNDJSON(data []byte) (*State, error) {
+	
+	// collected as one flat list, so that Parse migrates older schema versions
+	list := []json.RawMessage{}
+	
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data) + 1)
+	for scanner.Scan() {
+		
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("jsonstate: invalid JSON line: %.40s", line)
+		}
+		list = append(list, json.RawMessage(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("jsonstate: empty list of states")
+	}
+	
+	doc, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	
+	return Parse(doc)
+}
+func fromFlatList(list []*FlatState) (*State, error) {
+	
+	if len(list) == 0 {
+		return nil, errors.New("jsonstate: empty list of states")
+	}
+	
+	return ReverseFlatten(list), nil
+}
@@ -0,0 +1,38 @@
+package jsonstate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecoderByContentType(t *testing.T) {
+	
+	// text/plain is output-only, the body is then parsed as JSON
+	if name, _, ok := DecoderByContentType("text/plain; charset=utf-8"); ok {
+		t.Errorf("decoder for text/plain: %s", name)
+	}
+	if _, _, ok := CodecByContentType("text/plain"); !ok {
+		t.Error("no codec for text/plain")
+	}
+	
+	for content_type, want := range map[string]string{"application/json": "json", "application/yaml": "yaml", "application/x-ndjson": "ndjson"} {
+		if name, _, ok := DecoderByContentType(content_type); !ok || name != want {
+			t.Errorf("decoder for %s: %q, want %q", content_type, name, want)
+		}
+	}
+	
+	r := NewRegistry("app")
+	req := httptest.NewRequest(http.MethodPost, "/db", strings.NewReader(`{"level": 500}`))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	NewReceiver(r, Quota{}).Handler().ServeHTTP(rec, req)
+	
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("push as text/plain: %d %s", rec.Code, rec.Body)
+	}
+	if db, err := r.Lookup("db"); err != nil || db.Level != StateError {
+		t.Errorf("pushed state: %v, %v", db, err)
+	}
+}
@@ -0,0 +1,148 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// the tree as JSON in which identical sibling subtrees that are entirely OK are collapsed into the first of them, with the sources of all of them in "instances", e.g. {"source": "web1", "level": 200, "instances": ["web1", "web2", "web3"]}, which shrinks the roll-up of a fleet to the instances that are not OK
+// note: siblings are identical if they only differ in source and datetimes, so only the datetimes of OK states are lost (see ParseCompact)
+func (s *State) MarshalCompact() ([]byte, error) {
+	return json.Marshal(toCompact(s, 0))
+}
+// constructor: read the JSON of MarshalCompact, with every collapsed subtree repeated for each of its instances (right after each other, at the position of the first)
+func ParseCompact(data []byte) (*State, error) {
+	
+	cs := &compactState{}
+	if err := json.Unmarshal(data, cs); err != nil {
+		return nil, err
+	}
+	
+	s, err := fromCompact(cs, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.CheckTree(); err != nil {
+		return nil, err
+	}
+	
+	return s, nil
+}
+
+// a State with a tree of compactState (the Tree of State is shadowed)
+type compactState struct {
+	*State
+	Tree []*compactState  `json:"tree,omitempty"`
+	Instances []string    `json:"instances,omitempty"` // sources of the identical siblings, including this one
+}
+
+func toCompact(s *State, depth int) *compactState {
+	
+	cs := &compactState{
+		State: s.leaf(),
+	}
+	if depth >= MaxDepth {
+		return cs
+	}
+	
+	// the first of the identical siblings, by key
+	first := map[string]*compactState{}
+	for _, s_it := range s.Tree {
+		
+		if s_it == nil {
+			continue
+		}
+		
+		key, ok := compactKey(s_it)
+		if !ok {
+			cs.Tree = append(cs.Tree, toCompact(s_it, depth + 1))
+			continue
+		}
+		
+		if cs_first, ok := first[key]; ok {
+			if len(cs_first.Instances) == 0 {
+				cs_first.Instances = []string{cs_first.Source}
+			}
+			cs_first.Instances = append(cs_first.Instances, s_it.Source)
+			continue
+		}
+		
+		cs_it := toCompact(s_it, depth + 1)
+		first[key] = cs_it
+		cs.Tree = append(cs.Tree, cs_it)
+	}
+	
+	return cs
+}
+func fromCompact(cs *compactState, depth int) (*State, error) {
+	
+	if cs.State == nil {
+		return nil, fmt.Errorf("%w: null state", ErrMalformedTree)
+	}
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("%w: deeper than %d", ErrMalformedTree, MaxDepth)
+	}
+	
+	s := cs.State.leaf()
+	for _, cs_it := range cs.Tree {
+		
+		if cs_it == nil {
+			return nil, fmt.Errorf("%w: null state in the tree of %s", ErrMalformedTree, s.Source)
+		}
+		
+		s_it, err := fromCompact(cs_it, depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		
+		if len(cs_it.Instances) == 0 {
+			s.Tree = append(s.Tree, s_it)
+			continue
+		}
+		for _, source := range cs_it.Instances {
+			
+			instance := s_it.Clone()
+			instance.Source = source
+			s.Tree = append(s.Tree, instance)
+		}
+	}
+	
+	return s, nil
+}
+// a copy of s without its tree
+func (s *State) leaf() *State {
+	
+	leaf := *s
+	leaf.Tree = nil
+	
+	return &leaf
+}
+// the JSON of a subtree without its source and datetimes, if it may be collapsed with identical siblings: all of its states are OK
+func compactKey(s *State) (string, bool) {
+	
+	ok := true
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if s_it.Level < StateOk || s_it.Level >= StateAttention {
+			ok = false
+		}
+		return ok
+	})
+	if !ok {
+		return "", false
+	}
+	
+	key := s.Clone()
+	key.Source = ""
+	key.Walk(func(source_path []string, s_it *State) bool {
+		s_it.Datetime = ""
+		return true
+	})
+	
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", false
+	}
+	
+	return string(data), true
+}
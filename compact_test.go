@@ -0,0 +1,76 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	
+	s := New("fleet")
+	for _, source := range []string{"web1", "web2", "web3", "web4"} {
+		
+		web := New(source)
+		web.Level = StateOk
+		web.Datetime = "2024-01-02T03:04:05Z"
+		web.Tree = []*State{{Source: "http", Level: StateOk}}
+		s.Add(web)
+	}
+	s.Tree[2].Tree[0].Level = StateError
+	s.Tree[2].Tree[0].Message = "503"
+	s.AggregateLevels()
+	
+	data, err := s.MarshalCompact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), `"source":"http"`); got != 2 {
+		t.Errorf("compact JSON has %d http states, want 2 (the collapsed OK ones and web3): %s", got, data)
+	}
+	if !strings.Contains(string(data), `"instances":["web1","web2","web4"]`) {
+		t.Errorf("compact JSON without instances: %s", data)
+	}
+	
+	parsed, err := ParseCompact(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	// only the datetimes of the collapsed OK states are lost, and the instances follow each other at the position of the first
+	sources := []string{}
+	for _, s_it := range parsed.Tree {
+		sources = append(sources, s_it.Source)
+		if s_it.Source != "web3" {
+			s_it.Datetime = ""
+		}
+	}
+	if strings.Join(sources, ",") != "web1,web2,web4,web3" {
+		t.Errorf("sources after the round trip: %v", sources)
+	}
+	
+	for _, s_it := range s.Tree {
+		
+		want := s_it.Clone()
+		if s_it.Source != "web3" {
+			want.Datetime = ""
+		}
+		
+		want_json, _ := json.Marshal(want)
+		got_json, _ := json.Marshal(parsed.FindBySource(s_it.Source))
+		if string(got_json) != string(want_json) {
+			t.Errorf("round trip of %s:\ngot  %s\nwant %s", s_it.Source, got_json, want_json)
+		}
+	}
+	if parsed.Level != s.Level || parsed.CausedBy != s.CausedBy {
+		t.Errorf("root after the round trip: %s", parsed)
+	}
+}
+func TestParseCompactRejectsMalformed(t *testing.T) {
+	
+	for _, data := range []string{`{"source": "a", "tree": [null]}`, `null`, `{"tree": [{"source": "a", "instances": ["b", "b"]}]}`} {
+		if _, err := ParseCompact([]byte(data)); err == nil {
+			t.Errorf("ParseCompact(%s) accepted", data)
+		}
+	}
+}
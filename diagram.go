@@ -0,0 +1,121 @@
+package jsonstate
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fill color of a level in diagrams (the same palette as the HTML report)
+func levelHexColor(level int) string {
+	
+	switch builtinLevel(level) {
+	case StateOk:
+		return "#22aa22"
+	case StateAttention:
+		return "#ccbb00"
+	case StateWarning:
+		return "#ee8800"
+	case StateError:
+		return "#dd3333"
+	case StateFault:
+		return "#aa0000"
+	case StatePanic:
+		return "#000000"
+	}
+	
+	return "#888888"
+}
+// label of a state in diagrams: source (or "/" for an unnamed root) and level name
+func diagramLabel(s *State, source_path []string) string {
+	
+	source := s.Source
+	if source == "" && len(source_path) == 0 {
+		source = "/"
+	}
+	
+	return fmt.Sprintf("%s\n%d %s", source, s.Level, LevelString(s.Level))
+}
+
+// the tree as a Graphviz DOT digraph, with nodes filled by level color
+func (s *State) MarshalDOT() ([]byte, error) {
+	
+	var buf bytes.Buffer
+	
+	buf.WriteString("digraph state {\n")
+	buf.WriteString("\tnode [shape=box, style=\"rounded,filled\", fontcolor=white, fontname=sans];\n")
+	
+	// first all nodes, then all edges
+	ids := map[*State]string{}
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		id := "n" + strconv.Itoa(len(ids))
+		ids[s_it] = id
+		
+		fmt.Fprintf(&buf, "\t%s [label=%s, fillcolor=%q];\n", id, strconv.Quote(diagramLabel(s_it, source_path)), levelHexColor(s_it.Level))
+		
+		return true
+	})
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		for _, s_child := range s_it.Tree {
+			
+			// not a node if nil or below MaxDepth
+			child_id, ok := ids[s_child]
+			if !ok {
+				continue
+			}
+			
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", ids[s_it], child_id)
+		}
+		
+		return true
+	})
+	
+	buf.WriteString("}\n")
+	
+	return buf.Bytes(), nil
+}
+// the tree as a Mermaid flowchart, with nodes styled by level color
+func (s *State) MarshalMermaid() ([]byte, error) {
+	
+	var buf bytes.Buffer
+	
+	buf.WriteString("flowchart TD\n")
+	
+	// first all nodes, then all edges
+	ids := map[*State]string{}
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		id := "n" + strconv.Itoa(len(ids))
+		ids[s_it] = id
+		
+		// mermaid has no escaping in labels, but accepts HTML entities
+		label := strings.NewReplacer("\"", "#quot;", "\n", "<br>").Replace(diagramLabel(s_it, source_path))
+		
+		fmt.Fprintf(&buf, "\t%s[\"%s\"]\n", id, label)
+		fmt.Fprintf(&buf, "\tstyle %s fill:%s,color:#fff\n", id, levelHexColor(s_it.Level))
+		
+		return true
+	})
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		for _, s_child := range s_it.Tree {
+			
+			// not a node if nil or below MaxDepth
+			child_id, ok := ids[s_child]
+			if !ok {
+				continue
+			}
+			
+			fmt.Fprintf(&buf, "\t%s --> %s\n", ids[s_it], child_id)
+		}
+		
+		return true
+	})
+	
+	return buf.Bytes(), nil
+}
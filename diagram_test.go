@@ -0,0 +1,41 @@
+package jsonstate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagramSkipsMissingChildren(t *testing.T) {
+	
+	defer func(max_depth int) { MaxDepth = max_depth }(MaxDepth)
+	MaxDepth = 2
+	
+	s := New("root")
+	s.Tree = []*State{nil, New("a")}
+	s.Tree[1].Tree = []*State{New("b")}
+	s.Tree[1].Tree[0].Tree = []*State{New("below-max-depth")}
+	
+	dot, err := s.MarshalDOT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(dot), "-> ;") || strings.Contains(string(dot), "below-max-depth") {
+		t.Errorf("invalid DOT:\n%s", dot)
+	}
+	if got := strings.Count(string(dot), "->"); got != 2 {
+		t.Errorf("DOT has %d edges, want 2:\n%s", got, dot)
+	}
+	
+	mermaid, err := s.MarshalMermaid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(mermaid), "\n") {
+		if strings.HasSuffix(line, "--> ") {
+			t.Errorf("invalid Mermaid edge %q", line)
+		}
+	}
+	if got := strings.Count(string(mermaid), "-->"); got != 2 {
+		t.Errorf("Mermaid has %d edges, want 2:\n%s", got, mermaid)
+	}
+}
@@ -0,0 +1,83 @@
+package jsonstate
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// custom error types may carry their own severity by implementing this interface (found anywhere in the wrap chain with errors.As)
+type LevelError interface {
+	error
+	StateLevel() int
+}
+
+type errorRule struct {
+	target error
+	level int
+}
+
+var (
+	errorRulesMu sync.RWMutex
+	errorRules []errorRule
+)
+
+// register a level for a sentinel error (matched with errors.Is), rules registered later take precedence over earlier ones
+func RegisterErrorLevel(target error, level int) {
+	
+	errorRulesMu.Lock()
+	defer errorRulesMu.Unlock()
+	
+	errorRules = append(errorRules, errorRule{
+		target: target,
+		level: level,
+	})
+}
+
+// map an error to a level: nil is OK, a LevelError decides for itself, then registered rules, then timeouts and temporary errors are a Warning, anything else is an Error
+func ErrorLevel(err error) int {
+	
+	if err == nil {
+		return StateOk
+	}
+	
+	var level_err LevelError
+	if errors.As(err, &level_err) {
+		return level_err.StateLevel()
+	}
+	
+	errorRulesMu.RLock()
+	for i := len(errorRules) - 1; i >= 0; i -= 1 {
+		if errors.Is(err, errorRules[i].target) {
+			errorRulesMu.RUnlock()
+			return errorRules[i].level
+		}
+	}
+	errorRulesMu.RUnlock()
+	
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StateWarning
+	}
+	
+	// net.Error and friends (deprecated, but still widely implemented)
+	var temporary_err interface{ Temporary() bool }
+	if errors.As(err, &temporary_err) && temporary_err.Temporary() {
+		return StateWarning
+	}
+	
+	return StateError
+}
+
+// constructor: create a State for the given source from the result of an operation
+func FromError(source string, err error) *State {
+	return New(source).SetError(err)
+}
+// set level and message from an error (nil clears the message, and sets the level to OK)
+func (s *State) SetError(err error) *State {
+	
+	if err == nil {
+		return s.Set(StateOk, "")
+	}
+	
+	return s.Set(ErrorLevel(err), err.Error())
+}
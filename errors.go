@@ -0,0 +1,122 @@
+package jsonstate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+)
+
+// errors of the package are returned wrapped with details, match them with errors.Is
+var (
+	ErrSourceNotFound = errors.New("jsonstate: source not found")
+	ErrDuplicateSource = errors.New("jsonstate: duplicate source")
+	ErrEmptySource = errors.New("jsonstate: empty source")
+	ErrInvalidLevel = errors.New("jsonstate: invalid level")
+	ErrStale = errors.New("jsonstate: stale state")
+	ErrOverrideRejected = errors.New("jsonstate: override rejected")
+	ErrMalformedTree = errors.New("jsonstate: malformed tree") // see CheckTree
+	ErrUnauthorized = errors.New("jsonstate: unauthorized") // see AccessPolicy
+	ErrProposalNotFound = errors.New("jsonstate: proposal not found") // see Remediator.Approve
+	ErrRateLimited = errors.New("jsonstate: rate limited") // by the cooldown or rate limit of a remediation rule
+	ErrClosed = errors.New("jsonstate: closed") // see Remediator.Close
+)
+
+// a failure to read or write a document in storage (a snapshot, a report file), match it with errors.As, and the cause with errors.Is (e.g. fs.ErrNotExist)
+type StorageError struct {
+	Op string // "load", "save" or "rotate"
+	Path string
+	Err error
+}
+// a failure to deliver to or fetch from a remote endpoint (a webhook, tracker, broker or report URL), match it with errors.As, and the cause with errors.Is (e.g. context.DeadlineExceeded)
+type TransportError struct {
+	Op string // e.g. "webhook", "report to", "fetch" (see Proxy), "mqtt", "kafka", or the HTTP method of a tracker call
+	Endpoint string // URL, or the topic or exchange of a broker
+	StatusCode int // of an unexpected HTTP response, 0 for other failures
+	Status string
+	Err error // nil for an unexpected HTTP response without further details
+}
+
+// an error with its own message that matches several of the errors above
+type sentinelsError struct {
+	message string
+	sentinels []error
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("jsonstate: %s %s: %v", e.Op, e.Path, e.Err)
+}
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+func (e *TransportError) Error() string {
+	
+	var sb strings.Builder
+	
+	sb.WriteString("jsonstate: " + e.Op)
+	if e.Endpoint != "" {
+		sb.WriteString(" " + e.Endpoint)
+	}
+	if e.Status != "" {
+		sb.WriteString(": " + e.Status)
+	}
+	if e.Err != nil {
+		sb.WriteString(": " + strings.TrimPrefix(e.Err.Error(), "jsonstate: "))
+	}
+	
+	return sb.String()
+}
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+func (e *sentinelsError) Error() string {
+	return e.message
+}
+func (e *sentinelsError) Unwrap() []error {
+	return e.sentinels
+}
+
+func storageError(op string, path string, err error) error {
+	
+	// the path is already part of the StorageError
+	var path_err *fs.PathError
+	if errors.As(err, &path_err) {
+		err = path_err.Err
+	}
+	
+	return &StorageError{
+		Op: op,
+		Path: path,
+		Err: err,
+	}
+}
+func transportError(op string, endpoint string, err error) error {
+	
+	// the URL is already part of the TransportError
+	var url_err *url.Error
+	if errors.As(err, &url_err) {
+		err = url_err.Err
+	}
+	
+	return &TransportError{
+		Op: op,
+		Endpoint: endpoint,
+		Err: err,
+	}
+}
+// note: the body of the response (if any) is included as the cause
+func statusError(op string, endpoint string, status_code int, status string, body []byte) error {
+	
+	e := &TransportError{
+		Op: op,
+		Endpoint: endpoint,
+		StatusCode: status_code,
+		Status: status,
+	}
+	if text := strings.TrimSpace(string(body)); text != "" {
+		e.Err = errors.New(text)
+	}
+	
+	return e
+}
@@ -0,0 +1,181 @@
+package jsonstate
+
+import (
+	"time"
+)
+
+// notify more notifiers when an incident is still not acknowledged After some time since it started
+type EscalationStep struct {
+	After time.Duration   `json:"after"`
+	When string           `json:"when,omitempty"` // condition over the last transition of the incident (see Route.When), the step is skipped if it does not match
+	Notifiers []Notifier  `json:"-"`
+}
+
+// note: an incident is the time a source is at the MinLevel of a route (or worse), from the first transition to it, until the recovery
+type incidentKey struct {
+	route *Route
+	path string
+}
+type incident struct {
+	n Notification // the last notification
+	started time.Time
+	notified time.Time // time of the last (re)notification
+	step int // number of escalation steps done
+	acknowledged bool
+	timer *time.Timer
+}
+
+// acknowledge the incidents of the given source path (on every route), which stops escalation and re-notification until the next incident, returns false if there was no open incident
+func (a *Alerter) Acknowledge(path string) bool {
+	
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	
+	acknowledged := false
+	for key, inc := range a.incidents {
+		if key.path == path && !inc.acknowledged {
+			inc.acknowledged = true
+			inc.stop()
+			acknowledged = true
+		}
+	}
+	
+	return acknowledged
+}
+
+// handle a notification for a route with escalation or re-notification
+// note: must be called while holding the lock
+func (a *Alerter) escalate(route *Route, n Notification) {
+	
+	key := incidentKey{
+		route: route,
+		path: n.Path,
+	}
+	inc := a.incidents[key]
+	
+	if n.To < route.MinLevel {
+		
+		// recovery: tell everyone that was told about the incident
+		if inc != nil {
+			inc.stop()
+			delete(a.incidents, key)
+			n.Escalation = inc.step
+		}
+		a.notifyReached(route, n, n.Escalation)
+		return
+	}
+	
+	if inc == nil {
+		inc = &incident{
+			started: n.Time,
+		}
+		a.incidents[key] = inc
+	}
+	
+	// a change of level within the incident is notified to everyone that was told about it (but does not reset the acknowledgement, or the escalation)
+	n.Escalation = inc.step
+	inc.n = n
+	inc.notified = n.Time
+	a.notifyReached(route, n, inc.step)
+	
+	if !inc.acknowledged {
+		a.schedule(key, inc)
+	}
+}
+// notify the initial notifiers of the route and those of the first steps of its escalation
+// note: must be called while holding the lock
+func (a *Alerter) notifyReached(route *Route, n Notification, steps int) {
+	
+	for _, notifier := range route.Notifiers {
+		a.enqueue(notifier, n)
+	}
+	
+	for i := 0; i < steps && i < len(route.Escalation); i += 1 {
+		
+		if !a.matchCondition(route.Escalation[i].When, n.Transition) {
+			continue
+		}
+		for _, notifier := range route.Escalation[i].Notifiers {
+			a.enqueue(notifier, n)
+		}
+	}
+}
+// set the timer for the next escalation step or re-notification, whichever comes first
+// note: must be called while holding the lock
+func (a *Alerter) schedule(key incidentKey, inc *incident) {
+	
+	inc.stop()
+	
+	next := time.Time{}
+	
+	if inc.step < len(key.route.Escalation) {
+		next = inc.started.Add(key.route.Escalation[inc.step].After)
+	}
+	
+	if interval, ok := key.route.Renotify[builtinLevel(inc.n.To)]; ok && interval > 0 {
+		if renotify := inc.notified.Add(interval); next.IsZero() || renotify.Before(next) {
+			next = renotify
+		}
+	}
+	
+	if next.IsZero() {
+		return
+	}
+	
+	inc.timer = time.AfterFunc(time.Until(next), func() {
+		a.fire(key, inc)
+	})
+}
+// the timer of an incident expired
+func (a *Alerter) fire(key incidentKey, inc *incident) {
+	
+	a.mu.Lock()
+	defer a.unlock()
+	
+	// the incident may have been closed or acknowledged in the meantime
+	if a.closed || a.incidents[key] != inc || inc.acknowledged {
+		return
+	}
+	
+	now := time.Now()
+	
+	// keep the incident open while it is silenced, and continue where it left off once the silence ends
+	if until, ok := a.silencedUntil(key.path, now); ok {
+		inc.timer = time.AfterFunc(until.Sub(now), func() {
+			a.fire(key, inc)
+		})
+		return
+	}
+	
+	if inc.step < len(key.route.Escalation) && !now.Before(inc.started.Add(key.route.Escalation[inc.step].After)) {
+		
+		n := inc.n
+		n.Escalation = inc.step + 1
+		
+		step := key.route.Escalation[inc.step]
+		if a.matchCondition(step.When, n.Transition) {
+			for _, notifier := range step.Notifiers {
+				a.enqueue(notifier, n)
+			}
+		}
+		inc.step += 1
+		
+	} else {
+		
+		n := inc.n
+		n.Escalation = inc.step
+		n.Renotify = true
+		
+		a.notifyReached(key.route, n, inc.step)
+		inc.notified = now
+	}
+	
+	a.schedule(key, inc)
+}
+
+func (inc *incident) stop() {
+	if inc.timer != nil {
+		inc.timer.Stop()
+		inc.timer = nil
+	}
+}
@@ -0,0 +1,105 @@
+package jsonstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// why a computed level is what it is (see Explain)
+type Explanation struct {
+	Path string            `json:"path"` // source path relative to the explained State
+	Level int              `json:"level"`
+	Rule string            `json:"rule"` // "aggregate" for the worst level of the tree, or "synthetic" for the expression of a synthetic node
+	CausedBy string        `json:"caused_by,omitempty"` // source path of the state that determined the level (see State.CausedBy)
+	Reason string          `json:"reason"`
+	Trace []string         `json:"trace,omitempty"` // decisions of the expression of a synthetic node, in order of evaluation
+}
+
+// collects the explanations of one aggregation, by source path (the last decision for a path wins, as synthetic nodes re-aggregate the tree)
+type explainer struct {
+	explanations map[string]*Explanation
+}
+
+// aggregate the tree of s and compute its synthetic nodes (like AggregateLevels().ApplySynthetics()), and explain every computed level, in Flatten() order
+func (s *State) Explain() []Explanation {
+	
+	x := &explainer{
+		explanations: map[string]*Explanation{},
+	}
+	s.aggregateLevels(nil, x).applySynthetics(x)
+	
+	list := []Explanation{}
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if e, ok := x.explanations[strings.Join(source_path, "/")]; ok {
+			list = append(list, *e)
+		}
+		
+		return true
+	})
+	
+	return list
+}
+// a snapshot (see Snapshot) with the explanation of every computed level (see State.Explain)
+func (r *Registry) Explain() (*State, []Explanation) {
+	
+	r.mu.RLock()
+	snapshot := r.root.Clone()
+	r.mu.RUnlock()
+	
+	explanations := snapshot.Explain()
+	snapshot.ApplyRunbooks().ApplySLAs()
+	
+	return snapshot, explanations
+}
+
+// note: x may be nil, so that AggregateLevels() needs no checks
+func (x *explainer) aggregated(source_path []string, s *State) {
+	
+	if x == nil {
+		return
+	}
+	
+	children := []string{}
+	for _, s_it := range s.Tree {
+		if s_it == nil {
+			continue
+		}
+		children = append(children, fmt.Sprintf("%s: %d %s", s_it.Source, s_it.Level, LevelString(s_it.Level)))
+	}
+	
+	reason := fmt.Sprintf("worst of %d children (%s)", len(s.Tree), strings.Join(children, ", "))
+	if s.Level == StateUnknown {
+		reason += ", Unknown is the lowest level, so a tree without known levels is Unknown"
+	}
+	
+	path := strings.Join(source_path, "/")
+	x.explanations[path] = &Explanation{
+		Path: path,
+		Level: s.Level,
+		Rule: "aggregate",
+		CausedBy: s.CausedBy,
+		Reason: reason,
+	}
+}
+func (x *explainer) synthetic(node synthetic, level int, trace *[]string, err error) {
+	
+	if x == nil {
+		return
+	}
+	
+	e := &Explanation{
+		Path: strings.Join(node.path, "/"),
+		Level: level,
+		Rule: "synthetic",
+		Reason: node.expression.String(),
+	}
+	if trace != nil {
+		e.Trace = *trace
+	}
+	if err != nil {
+		e.Reason += ": " + strings.TrimPrefix(err.Error(), "jsonstate: ")
+	}
+	
+	x.explanations[e.Path] = e
+}
@@ -0,0 +1,74 @@
+package jsonstate
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// flattened tree as CSV, with a header row: depth, path, level, level_name, message, since (the Datetime of each state), sla_target, sla_tier
+func (s *State) MarshalCSV() ([]byte, error) {
+	return s.marshalDelimited(',')
+}
+// same as MarshalCSV(), but tab-separated
+func (s *State) MarshalTSV() ([]byte, error) {
+	return s.marshalDelimited('\t')
+}
+
+func (s *State) marshalDelimited(comma rune) ([]byte, error) {
+	
+	var buf bytes.Buffer
+	
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+	
+	w.Write([]string{"depth", "path", "level", "level_name", "message", "since", "sla_target", "sla_tier"})
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		sla_target := ""
+		sla_tier := ""
+		if s_it.SLA != nil {
+			if s_it.SLA.Target > 0 {
+				sla_target = strconv.FormatFloat(s_it.SLA.Target, 'f', -1, 64)
+			}
+			sla_tier = s_it.SLA.Tier
+		}
+		
+		w.Write([]string{
+			strconv.Itoa(len(source_path)),
+			strings.Join(source_path, "/"),
+			strconv.Itoa(s_it.Level),
+			LevelString(s_it.Level),
+			s_it.Message,
+			s_it.Datetime,
+			sla_target,
+			sla_tier,
+		})
+		
+		return true
+	})
+	
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	
+	return buf.Bytes(), nil
+}
+// flattened tree as JSON Lines (application/x-ndjson), one FlatState per line
+func (s *State) MarshalNDJSON() ([]byte, error) {
+	
+	var buf bytes.Buffer
+	
+	enc := json.NewEncoder(&buf)
+	for _, item := range s.Flatten() {
+		if err := enc.Encode(item); err != nil {
+			return nil, err
+		}
+	}
+	
+	return buf.Bytes(), nil
+}
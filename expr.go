@@ -0,0 +1,964 @@
+package jsonstate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// where an expression is used, which determines the fields and functions it may refer to, and the type of its result (see ParseExpression)
+type ExprContext string
+
+const (
+	ExprSynthetic ExprContext = "synthetic" // a level computed from the tree, with the functions worst, best, level and count (synthetic nodes)
+	ExprState ExprContext = "state" // a condition over a state, with the fields level, depth, count, source, path, message and datetime (queries)
+	ExprTransition ExprContext = "transition" // a condition over a transition, with the fields path, source, from, to (or level) and message (routes, escalation steps and suppressions)
+)
+
+// a parsed and type checked expression (see ParseExpression)
+type Expression struct {
+	text string
+	context ExprContext
+	root exprValue
+}
+
+// static type of a (sub)expression
+type exprType int
+
+const (
+	exprNumber exprType = iota // numbers and levels
+	exprString
+	exprBool
+)
+
+// what an expression is evaluated against
+type exprEnv struct {
+	root *State // aggregated tree, paths are relative to it (ExprSynthetic)
+	item *FlatState // ExprState
+	t *Transition // ExprTransition
+	vars map[string]string
+	trace *[]string // the decisions of the evaluation, if not nil (see Explain)
+}
+type exprNode func(env *exprEnv) (any, error)
+type exprValue struct {
+	eval exprNode
+	typ exprType
+}
+
+type exprField struct {
+	typ exprType
+	get func(env *exprEnv) any
+	path bool // ~ matches a glob against the source path (see MatchPath) instead of finding a substring
+}
+type exprFunction struct {
+	args []exprType // the last one repeats if variadic
+	variadic bool
+	fn func(env *exprEnv, args []any) any
+}
+
+type exprToken struct {
+	text string
+	quoted bool
+	pos int
+	end int // position after the token
+}
+type exprParser struct {
+	context ExprContext
+	text []rune
+	tokens []exprToken
+	pos int
+	depth int // of nested sub-expressions, at most MaxDepth
+}
+
+var (
+	exprVariablesMu sync.RWMutex
+	exprVariables = map[string]string{}
+	transitionConditions sync.Map // text to *Expression, see transitionCondition
+)
+
+// fields per context, names are case-insensitive
+var exprFields = map[ExprContext]map[string]exprField{
+	ExprState: {
+		"level": {typ: exprNumber, get: func(env *exprEnv) any { return env.item.Level }},
+		"depth": {typ: exprNumber, get: func(env *exprEnv) any { return env.item.Depth }},
+		"count": {typ: exprNumber, get: func(env *exprEnv) any { return env.item.Count }},
+		"source": {typ: exprString, get: func(env *exprEnv) any { return env.item.Source }, path: true},
+		"path": {typ: exprString, get: func(env *exprEnv) any { return env.item.Path }, path: true},
+		"message": {typ: exprString, get: func(env *exprEnv) any { return env.item.Message }},
+		"datetime": {typ: exprString, get: func(env *exprEnv) any { return env.item.Datetime }},
+	},
+	ExprTransition: {
+		"path": {typ: exprString, get: func(env *exprEnv) any { return env.t.Path }, path: true},
+		"source": {typ: exprString, get: func(env *exprEnv) any { return pathSource(env.t.Path) }, path: true},
+		"from": {typ: exprNumber, get: func(env *exprEnv) any { return env.t.From }},
+		"to": {typ: exprNumber, get: func(env *exprEnv) any { return env.t.To }},
+		"level": {typ: exprNumber, get: func(env *exprEnv) any { return env.t.To }},
+		"message": {typ: exprString, get: func(env *exprEnv) any { return env.t.Message }},
+	},
+}
+
+// functions over the tree (only for ExprSynthetic), patterns are globs over the source paths relative to the root (see MatchPath)
+var exprFunctions = map[string]exprFunction{
+	"worst": {args: []exprType{exprString}, variadic: true, fn: exprWorst},
+	"best": {args: []exprType{exprString}, variadic: true, fn: exprBest},
+	"level": {args: []exprType{exprString}, fn: exprLevel},
+	"count": {args: []exprType{exprString, exprNumber}, fn: exprCount},
+}
+
+// set a variable for expressions (e.g. "region" to "eu")
+func RegisterVariable(name string, value string) {
+	
+	exprVariablesMu.Lock()
+	defer exprVariablesMu.Unlock()
+	
+	exprVariables[name] = value
+}
+
+// parse an expression that computes a level from other states for a synthetic node, e.g. "worst(db/*) if region=eu else ok" (see ParseExpression)
+func CompileExpression(text string) (*Expression, error) {
+	return ParseExpression(ExprSynthetic, text)
+}
+// parse an expression, and check that it only refers to what is available in the context, and that its types agree
+// note: the language is small, and the same for every context:
+//  - values: numbers, level names (e.g. Warning, including custom levels), 'single' or "double" quoted strings, the fields of the context (see ExprContext), and variables (see RegisterVariable), any other word is a string (so that patterns need no quotes)
+//  - functions (synthetic nodes only): worst(pattern, ...) and best(pattern, ...) are the worst and best level of the matching states (Unknown if none), level(path) is the level of one state, and count(pattern, level) is the number of matching states at level or worse
+//  - comparisons: == (or =), !=, <, <=, >, >= of two numbers or two strings, and ~, which matches a glob against the source path for source and path (see MatchPath), and finds a substring for other strings
+//  - conditions: && (or and), || (or or), ! (or not), and "a if condition else b" chooses a value, with parentheses for grouping
+//  - the result is a level for ExprSynthetic, and a condition for the other contexts
+func ParseExpression(context ExprContext, text string) (*Expression, error) {
+	
+	if context != ExprSynthetic && exprFields[context] == nil {
+		return nil, fmt.Errorf("jsonstate: expression: unknown context: %q", context)
+	}
+	
+	tokens, err := tokenizeExpression(text)
+	if err != nil {
+		return nil, err
+	}
+	
+	p := &exprParser{
+		context: context,
+		text: []rune(text),
+		tokens: tokens,
+	}
+	
+	root, err := p.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("jsonstate: expression: unexpected %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+	
+	expected := exprBool
+	if context == ExprSynthetic {
+		expected = exprNumber
+	}
+	if root.typ != expected {
+		return nil, fmt.Errorf("jsonstate: expression: expected %s, got %s", expected, root.typ)
+	}
+	
+	return &Expression{
+		text: text,
+		context: context,
+		root: root,
+	}, nil
+}
+// the level computed from the aggregated tree of root (see AggregateLevels), with the given variables (in addition to the registered ones)
+func (e *Expression) Level(root *State, vars map[string]string) (int, error) {
+	return e.level(root, vars, nil)
+}
+// see Level, and record the decisions in trace (if not nil)
+func (e *Expression) level(root *State, vars map[string]string, trace *[]string) (int, error) {
+	
+	if e.context != ExprSynthetic {
+		return StateUnknown, fmt.Errorf("jsonstate: expression %q: not a synthetic expression", e.text)
+	}
+	
+	v, err := e.eval(&exprEnv{
+		root: root,
+		vars: vars,
+		trace: trace,
+	})
+	if err != nil {
+		return StateUnknown, err
+	}
+	
+	return v.(int), nil
+}
+// true if the state matches an ExprState condition
+func (e *Expression) MatchState(item *FlatState) (bool, error) {
+	
+	if e.context != ExprState {
+		return false, fmt.Errorf("jsonstate: expression %q: not a state condition", e.text)
+	}
+	
+	v, err := e.eval(&exprEnv{
+		item: item,
+	})
+	if err != nil {
+		return false, err
+	}
+	
+	return v.(bool), nil
+}
+// true if the transition matches an ExprTransition condition
+func (e *Expression) MatchTransition(t Transition) (bool, error) {
+	
+	if e.context != ExprTransition {
+		return false, fmt.Errorf("jsonstate: expression %q: not a transition condition", e.text)
+	}
+	
+	v, err := e.eval(&exprEnv{
+		t: &t,
+	})
+	if err != nil {
+		return false, err
+	}
+	
+	return v.(bool), nil
+}
+func (e *Expression) Context() ExprContext {
+	return e.context
+}
+func (e *Expression) String() string {
+	return e.text
+}
+
+func (e *Expression) eval(env *exprEnv) (any, error) {
+	
+	// registered variables, unless overridden
+	exprVariablesMu.RLock()
+	if len(exprVariables) > 0 {
+		vars := make(map[string]string, len(exprVariables) + len(env.vars))
+		for name, value := range exprVariables {
+			vars[name] = value
+		}
+		for name, value := range env.vars {
+			vars[name] = value
+		}
+		env.vars = vars
+	}
+	exprVariablesMu.RUnlock()
+	
+	v, err := e.root.eval(env)
+	if err != nil {
+		return nil, fmt.Errorf("jsonstate: expression %q: %w", e.text, err)
+	}
+	
+	return v, nil
+}
+
+// the compiled ExprTransition condition, or nil if it is empty (conditions of routes are compiled once, and then cached)
+func transitionCondition(text string) (*Expression, error) {
+	
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	if e, ok := transitionConditions.Load(text); ok {
+		return e.(*Expression), nil
+	}
+	
+	e, err := ParseExpression(ExprTransition, text)
+	if err != nil {
+		return nil, err
+	}
+	transitionConditions.Store(text, e)
+	
+	return e, nil
+}
+
+func (t exprType) String() string {
+	
+	switch t {
+	case exprNumber:
+		return "a number"
+	case exprString:
+		return "a string"
+	}
+	
+	return "a condition"
+}
+
+func tokenizeExpression(text string) ([]exprToken, error) {
+	
+	tokens := []exprToken{}
+	
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		
+		r := runes[i]
+		
+		if unicode.IsSpace(r) {
+			
+			i += 1
+			
+		} else if r == '\'' || r == '"' {
+			
+			// quoted string, a backslash escapes the next character
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j += 1 {
+				if runes[j] == '\\' && j + 1 < len(runes) {
+					j += 1
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("jsonstate: expression: unterminated string at position %d", i)
+			}
+			
+			tokens = append(tokens, exprToken{text: sb.String(), quoted: true, pos: i, end: j + 1})
+			i = j + 1
+			
+		} else if strings.ContainsRune("(),!=<>~&|", r) {
+			
+			// operators of one or two characters
+			op := string(r)
+			if i + 1 < len(runes) {
+				switch op + string(runes[i + 1]) {
+				case "&&", "||", "==", "!=", "<=", ">=":
+					op += string(runes[i + 1])
+				}
+			}
+			if op == "&" || op == "|" {
+				return nil, fmt.Errorf("jsonstate: expression: unexpected %q at position %d", op, i)
+			}
+			
+			tokens = append(tokens, exprToken{text: op, pos: i, end: i + len(op)})
+			i += len(op)
+			
+		} else {
+			
+			// word: number, level name, field, variable, keyword or pattern
+			j := i
+			for ; j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("(),!=<>~&|'\"", runes[j]); j += 1 {
+			}
+			
+			tokens = append(tokens, exprToken{text: string(runes[i:j]), pos: i, end: j})
+			i = j
+		}
+	}
+	
+	return tokens, nil
+}
+
+// the next token if it is an operator or a word (not a quoted string)
+func (p *exprParser) peek() string {
+	
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return ""
+	}
+	
+	return p.tokens[p.pos].text
+}
+func (p *exprParser) next() (exprToken, error) {
+	
+	if p.pos >= len(p.tokens) {
+		return exprToken{}, fmt.Errorf("jsonstate: expression: unexpected end")
+	}
+	
+	p.pos += 1
+	return p.tokens[p.pos - 1], nil
+}
+func (p *exprParser) expect(text string) error {
+	
+	if p.peek() != text {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("jsonstate: expression: missing %s", text)
+		}
+		return fmt.Errorf("jsonstate: expression: expected %s at position %d, got %q", text, p.tokens[p.pos].pos, p.tokens[p.pos].text)
+	}
+	
+	p.pos += 1
+	return nil
+}
+// position of the next token (or the end) for errors
+func (p *exprParser) position() int {
+	
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].pos
+	}
+	if len(p.tokens) == 0 {
+		return 0
+	}
+	
+	return p.tokens[len(p.tokens) - 1].end
+}
+// enter a sub-expression, so that deeply nested input is an error rather than exhausting the stack
+func (p *exprParser) nest() error {
+	
+	p.depth += 1
+	if p.depth > MaxDepth {
+		return fmt.Errorf("jsonstate: expression: nested deeper than %d at position %d", MaxDepth, p.position())
+	}
+	
+	return nil
+}
+func (p *exprParser) unnest() {
+	p.depth -= 1
+}
+// the text of the tokens from index start up to the current position
+func (p *exprParser) source(start int) string {
+	
+	if start >= p.pos {
+		return ""
+	}
+	
+	return string(p.text[p.tokens[start].pos:p.tokens[p.pos - 1].end])
+}
+// a if condition else b
+func (p *exprParser) parseTernary() (exprValue, error) {
+	
+	if err := p.nest(); err != nil {
+		return exprValue{}, err
+	}
+	defer p.unnest()
+	
+	value, err := p.parseOr()
+	if err != nil {
+		return exprValue{}, err
+	}
+	
+	if p.peek() != "if" {
+		return value, nil
+	}
+	p.pos += 1
+	
+	pos := p.position()
+	start := p.pos
+	condition, err := p.parseOr()
+	if err != nil {
+		return exprValue{}, err
+	}
+	condition_text := p.source(start)
+	if condition.typ != exprBool {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: expected a condition after if at position %d, got %s", pos, condition.typ)
+	}
+	if err := p.expect("else"); err != nil {
+		return exprValue{}, err
+	}
+	
+	pos = p.position()
+	other, err := p.parseTernary()
+	if err != nil {
+		return exprValue{}, err
+	}
+	if other.typ != value.typ {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: expected %s after else at position %d, got %s", value.typ, pos, other.typ)
+	}
+	
+	return exprValue{
+		typ: value.typ,
+		eval: func(env *exprEnv) (any, error) {
+			
+			ok, err := condition.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			env.record(fmt.Sprintf("%s is %v", condition_text, ok))
+			if ok.(bool) {
+				return value.eval(env)
+			}
+			
+			return other.eval(env)
+		},
+	}, nil
+}
+func (p *exprParser) parseOr() (exprValue, error) {
+	
+	left, err := p.parseAnd()
+	if err != nil {
+		return exprValue{}, err
+	}
+	
+	for p.peek() == "||" || p.peek() == "or" {
+		
+		op := p.tokens[p.pos]
+		p.pos += 1
+		
+		right, err := p.parseAnd()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return exprValue{}, fmt.Errorf("jsonstate: expression: %s at position %d combines conditions, got %s and %s", op.text, op.pos, left.typ, right.typ)
+		}
+		
+		l, r := left.eval, right.eval
+		left.eval = func(env *exprEnv) (any, error) {
+			
+			ok, err := l(env)
+			if err != nil || ok.(bool) {
+				return ok, err
+			}
+			
+			return r(env)
+		}
+	}
+	
+	return left, nil
+}
+func (p *exprParser) parseAnd() (exprValue, error) {
+	
+	left, err := p.parseNot()
+	if err != nil {
+		return exprValue{}, err
+	}
+	
+	for p.peek() == "&&" || p.peek() == "and" {
+		
+		op := p.tokens[p.pos]
+		p.pos += 1
+		
+		right, err := p.parseNot()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return exprValue{}, fmt.Errorf("jsonstate: expression: %s at position %d combines conditions, got %s and %s", op.text, op.pos, left.typ, right.typ)
+		}
+		
+		l, r := left.eval, right.eval
+		left.eval = func(env *exprEnv) (any, error) {
+			
+			ok, err := l(env)
+			if err != nil || !ok.(bool) {
+				return ok, err
+			}
+			
+			return r(env)
+		}
+	}
+	
+	return left, nil
+}
+func (p *exprParser) parseNot() (exprValue, error) {
+	
+	if p.peek() != "!" && p.peek() != "not" {
+		return p.parseComparison()
+	}
+	
+	op := p.tokens[p.pos]
+	p.pos += 1
+	
+	if err := p.nest(); err != nil {
+		return exprValue{}, err
+	}
+	defer p.unnest()
+	
+	inner, err := p.parseNot()
+	if err != nil {
+		return exprValue{}, err
+	}
+	if inner.typ != exprBool {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: %s at position %d negates a condition, got %s", op.text, op.pos, inner.typ)
+	}
+	
+	return exprValue{
+		typ: exprBool,
+		eval: func(env *exprEnv) (any, error) {
+			
+			ok, err := inner.eval(env)
+			if err != nil {
+				return nil, err
+			}
+			
+			return !ok.(bool), nil
+		},
+	}, nil
+}
+func (p *exprParser) parseComparison() (exprValue, error) {
+	
+	field := p.field()
+	left, err := p.parseOperand()
+	if err != nil {
+		return exprValue{}, err
+	}
+	
+	op := p.peek()
+	switch op {
+	case "==", "=", "!=", "<", "<=", ">", ">=", "~":
+	default:
+		return left, nil
+	}
+	pos := p.tokens[p.pos].pos
+	p.pos += 1
+	
+	right, err := p.parseOperand()
+	if err != nil {
+		return exprValue{}, err
+	}
+	
+	if left.typ != right.typ {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: %s at position %d compares %s with %s", op, pos, left.typ, right.typ)
+	}
+	
+	switch op {
+	
+	case "~":
+		
+		if left.typ != exprString {
+			return exprValue{}, fmt.Errorf("jsonstate: expression: ~ at position %d applies to strings, got %s", pos, left.typ)
+		}
+		
+		// a glob against the source path for path fields, or else a substring
+		if field != nil && field.path {
+			return exprValue{
+				typ: exprBool,
+				eval: func(env *exprEnv) (any, error) {
+					
+					pattern, err := right.eval(env)
+					if err != nil {
+						return nil, err
+					}
+					
+					return MatchPath(pattern.(string), exprPath(env)), nil
+				},
+			}, nil
+		}
+		
+		return exprValue{
+			typ: exprBool,
+			eval: func(env *exprEnv) (any, error) {
+				
+				a, b, err := evalBoth(left, right, env)
+				if err != nil {
+					return nil, err
+				}
+				
+				return strings.Contains(a.(string), b.(string)), nil
+			},
+		}, nil
+		
+	case "<", "<=", ">", ">=":
+		
+		if left.typ == exprBool {
+			return exprValue{}, fmt.Errorf("jsonstate: expression: %s at position %d does not apply to conditions", op, pos)
+		}
+		
+	case "=":
+		
+		op = "=="
+		
+	}
+	
+	return exprValue{
+		typ: exprBool,
+		eval: func(env *exprEnv) (any, error) {
+			
+			a, b, err := evalBoth(left, right, env)
+			if err != nil {
+				return nil, err
+			}
+			
+			switch x := a.(type) {
+			case int:
+				return compareQuery(op, x, b.(int)), nil
+			case string:
+				return compareQuery(op, strings.Compare(x, b.(string)), 0), nil
+			}
+			
+			return (a == b) == (op == "=="), nil
+		},
+	}, nil
+}
+func (p *exprParser) parseOperand() (exprValue, error) {
+	
+	token, err := p.next()
+	if err != nil {
+		return exprValue{}, err
+	}
+	
+	if token.quoted {
+		return exprValue{
+			typ: exprString,
+			eval: func(env *exprEnv) (any, error) {
+				return token.text, nil
+			},
+		}, nil
+	}
+	
+	switch token.text {
+	
+	case "(":
+		
+		inner, err := p.parseTernary()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return exprValue{}, err
+		}
+		return inner, nil
+		
+	case ")", ",", "!", "==", "=", "!=", "<", "<=", ">", ">=", "~", "&&", "||", "if", "else", "and", "or", "not":
+		
+		return exprValue{}, fmt.Errorf("jsonstate: expression: unexpected %q at position %d", token.text, token.pos)
+		
+	}
+	
+	// function call
+	if p.peek() == "(" {
+		return p.parseCall(token)
+	}
+	
+	if field, ok := exprFields[p.context][strings.ToLower(token.text)]; ok {
+		return exprValue{
+			typ: field.typ,
+			eval: func(env *exprEnv) (any, error) {
+				return field.get(env), nil
+			},
+		}, nil
+	}
+	
+	if n, err := strconv.Atoi(token.text); err == nil {
+		return exprValue{
+			typ: exprNumber,
+			eval: func(env *exprEnv) (any, error) {
+				return n, nil
+			},
+		}, nil
+	}
+	if level, ok := LevelByName(token.text); ok {
+		return exprValue{
+			typ: exprNumber,
+			eval: func(env *exprEnv) (any, error) {
+				return level, nil
+			},
+		}, nil
+	}
+	
+	// a variable, or else the word itself
+	return exprValue{
+		typ: exprString,
+		eval: func(env *exprEnv) (any, error) {
+			
+			if value, ok := env.vars[token.text]; ok {
+				return value, nil
+			}
+			
+			return token.text, nil
+		},
+	}, nil
+}
+func (p *exprParser) parseCall(name exprToken) (exprValue, error) {
+	
+	function, ok := exprFunctions[strings.ToLower(name.text)]
+	if !ok {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: unknown function %q at position %d", name.text, name.pos)
+	}
+	if p.context != ExprSynthetic {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: %s() at position %d is only available for synthetic nodes", name.text, name.pos)
+	}
+	p.pos += 1
+	
+	args := []exprValue{}
+	for p.peek() != ")" {
+		
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return exprValue{}, err
+			}
+		}
+		
+		pos := p.position()
+		arg, err := p.parseTernary()
+		if err != nil {
+			return exprValue{}, err
+		}
+		
+		i := len(args)
+		if i >= len(function.args) {
+			if !function.variadic {
+				return exprValue{}, fmt.Errorf("jsonstate: expression: too many arguments for %s() at position %d", name.text, pos)
+			}
+			i = len(function.args) - 1
+		}
+		if arg.typ != function.args[i] {
+			return exprValue{}, fmt.Errorf("jsonstate: expression: argument %d of %s() at position %d should be %s, got %s", len(args) + 1, name.text, pos, function.args[i], arg.typ)
+		}
+		
+		args = append(args, arg)
+	}
+	p.pos += 1
+	
+	if len(args) < len(function.args) {
+		return exprValue{}, fmt.Errorf("jsonstate: expression: not enough arguments for %s() at position %d", name.text, name.pos)
+	}
+	
+	return exprValue{
+		typ: exprNumber,
+		eval: func(env *exprEnv) (any, error) {
+			
+			values := make([]any, len(args))
+			for i, arg := range args {
+				v, err := arg.eval(env)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = v
+			}
+			
+			return function.fn(env, values), nil
+		},
+	}, nil
+}
+// the field at the current position, unless it is a function call
+func (p *exprParser) field() *exprField {
+	
+	if p.pos + 1 < len(p.tokens) && p.tokens[p.pos + 1].text == "(" && !p.tokens[p.pos + 1].quoted {
+		return nil
+	}
+	
+	if field, ok := exprFields[p.context][strings.ToLower(p.peek())]; ok {
+		return &field
+	}
+	
+	return nil
+}
+
+// add a decision to the trace (if any)
+func (env *exprEnv) record(decision string) {
+	if env.trace != nil {
+		*env.trace = append(*env.trace, decision)
+	}
+}
+
+func evalBoth(left exprValue, right exprValue, env *exprEnv) (any, any, error) {
+	
+	a, err := left.eval(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := right.eval(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	return a, b, nil
+}
+// the source path of what is evaluated, for ~ on a path field
+func exprPath(env *exprEnv) string {
+	
+	if env.item != nil {
+		return env.item.Path
+	}
+	if env.t != nil {
+		return env.t.Path
+	}
+	
+	return ""
+}
+// the last element of a source path
+func pathSource(path string) string {
+	
+	source_path := SplitPath(path)
+	if len(source_path) == 0 {
+		return ""
+	}
+	
+	return source_path[len(source_path) - 1]
+}
+
+// the paths and levels of the states matching any of the patterns
+func exprMatches(env *exprEnv, patterns []any) ([]string, []int) {
+	
+	paths := []string{}
+	levels := []int{}
+	env.root.Walk(func(source_path []string, s *State) bool {
+		
+		path := strings.Join(source_path, "/")
+		for _, pattern := range patterns {
+			if MatchPath(pattern.(string), path) {
+				paths = append(paths, path)
+				levels = append(levels, s.Level)
+				break
+			}
+		}
+		
+		return true
+	})
+	
+	return paths, levels
+}
+func exprWorst(env *exprEnv, args []any) any {
+	
+	paths, levels := exprMatches(env, args)
+	
+	worst := StateUnknown
+	worst_path := ""
+	for i, level := range levels {
+		if level > worst {
+			worst = level
+			worst_path = paths[i]
+		}
+	}
+	
+	env.record(fmt.Sprintf("worst%s is %s", exprArgs(args), exprFrom(worst, worst_path, len(paths))))
+	return worst
+}
+func exprBest(env *exprEnv, args []any) any {
+	
+	paths, levels := exprMatches(env, args)
+	
+	best := StateUnknown
+	best_path := ""
+	for i, level := range levels {
+		if i == 0 || level < best {
+			best = level
+			best_path = paths[i]
+		}
+	}
+	
+	env.record(fmt.Sprintf("best%s is %s", exprArgs(args), exprFrom(best, best_path, len(paths))))
+	return best
+}
+func exprLevel(env *exprEnv, args []any) any {
+	
+	level := StateUnknown
+	s := env.root
+	if source_path := SplitPath(args[0].(string)); len(source_path) > 0 {
+		s = env.root.FindBySource(source_path...)
+	}
+	if s != nil {
+		level = s.Level
+	}
+	
+	env.record(fmt.Sprintf("level%s is %d %s", exprArgs(args), level, LevelString(level)))
+	return level
+}
+func exprCount(env *exprEnv, args []any) any {
+	
+	paths, levels := exprMatches(env, args[:1])
+	
+	n := 0
+	for _, level := range levels {
+		if level >= args[1].(int) {
+			n += 1
+		}
+	}
+	
+	env.record(fmt.Sprintf("count%s is %d of %d", exprArgs(args), n, len(paths)))
+	return n
+}
+// the arguments of a call for the trace
+func exprArgs(args []any) string {
+	
+	list := []string{}
+	for _, arg := range args {
+		list = append(list, fmt.Sprint(arg))
+	}
+	
+	return "(" + strings.Join(list, ", ") + ")"
+}
+func exprFrom(level int, path string, matched int) string {
+	
+	if path == "" {
+		return fmt.Sprintf("%d %s (%d states matched)", level, LevelString(level), matched)
+	}
+	
+	return fmt.Sprintf("%d %s from %s (%d states matched)", level, LevelString(level), path, matched)
+}
@@ -0,0 +1,85 @@
+package jsonstate
+
+import (
+	"testing"
+)
+
+func TestExpressionLevel(t *testing.T) {
+	
+	root := FromMap(map[string]int{"db/primary": StateError, "db/replica": StateOk, "web/1": StateWarning, "web/2": StateOk})
+	root.AggregateLevels()
+	
+	for text, want := range map[string]int{
+		"worst(db/*)": StateError,
+		"best(db/*, web/*)": StateOk,
+		"level(web/1)": StateWarning,
+		"worst(missing/*)": StateUnknown,
+		"count(web/*, Warning)": 1,
+		"Fault if count(**, Warning) >= 2 else Ok": StateFault,
+		"worst(db/*) if region = eu else Ok": StateOk,
+		"(Warning if level(db) > Ok && !(level(web) < Warning) else Ok)": StateWarning,
+	} {
+		
+		e, err := CompileExpression(text)
+		if err != nil {
+			t.Errorf("CompileExpression(%q): %v", text, err)
+			continue
+		}
+		
+		got, err := e.Level(root, map[string]string{"region": "us"})
+		if err != nil || got != want {
+			t.Errorf("%q = %d, %v, want %d", text, got, err, want)
+		}
+	}
+}
+func TestExpressionErrors(t *testing.T) {
+	
+	for context, texts := range map[ExprContext][]string{
+		ExprSynthetic: {"worst(db/*) &&", "count(db/*)", "level(db) == 'x'", "level >= Warning", "nothing(db)"},
+		ExprState: {"level", "worst(db/*) > Ok", "level >= 'x'", "unknown_field == 1", "(level > 1"},
+		ExprTransition: {"depth > 1", "to"},
+	} {
+		for _, text := range texts {
+			if _, err := ParseExpression(context, text); err == nil {
+				t.Errorf("ParseExpression(%s, %q) accepted", context, text)
+			}
+		}
+	}
+	
+	if _, err := ParseExpression("other", "true"); err == nil {
+		t.Error("ParseExpression of an unknown context accepted")
+	}
+}
+func TestQuery(t *testing.T) {
+	
+	root := FromMap(map[string]int{"db/primary": StateError, "db/replica": StateOk, "web/1": StateWarning})
+	root.AggregateLevels()
+	
+	for query, want := range map[string]int{
+		"level >= Warning && path ~ 'db/*'": 1,
+		"level >= Warning": 5, // the root, db, db/primary, web and web/1
+		"source == 'replica' || source == \"1\"": 2,
+		"depth = 1 and not level >= Error": 1,
+	} {
+		
+		list, err := root.Query(query)
+		if err != nil {
+			t.Errorf("Query(%q): %v", query, err)
+			continue
+		}
+		if len(list) != want {
+			t.Errorf("Query(%q) matched %d states, want %d", query, len(list), want)
+		}
+	}
+	
+	e, err := ParseExpression(ExprTransition, "to >= Error && from < Error && message ~ 'disk'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := e.MatchTransition(Transition{Path: "db", From: StateOk, To: StateFault, Message: "disk full"}); !ok || err != nil {
+		t.Errorf("MatchTransition = %v, %v", ok, err)
+	}
+	if ok, _ := e.MatchTransition(Transition{Path: "db", From: StateError, To: StateFault, Message: "disk full"}); ok {
+		t.Error("MatchTransition matched a transition from Error")
+	}
+}
@@ -0,0 +1,26 @@
+package jsonstate
+
+import (
+	"expvar"
+	"time"
+)
+
+// publish the tree with expvar (under /debug/vars), the levels of a copy are aggregated on every read
+// note: like expvar.Publish, this panics if the name is already in use, and s must not be modified concurrently (publish a Registry instead)
+func Publish(name string, s *State) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return s.Clone().AggregateLevels()
+	}))
+}
+// publish a snapshot of the registry with expvar (under /debug/vars), taken on every read
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Snapshot()
+	}))
+}
+// publish the churn of the registry with expvar (under /debug/vars), computed from the history over the window on every read
+func (r *Registry) PublishChurn(name string, h *History, window time.Duration) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Churn(h, window)
+	}))
+}
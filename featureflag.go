@@ -0,0 +1,360 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a source of feature flags, e.g. an OpenFeature flag service (see OFREPProvider)
+type FlagProvider interface {
+	Enabled(ctx context.Context, key string) (bool, error)
+	Disable(ctx context.Context, key string) error // returns an error wrapping errors.ErrUnsupported for providers that only evaluate flags
+}
+
+// a feature flag in the tree (see FlagBridge), e.g. {"key": "new-checkout", "path": "features/new-checkout", "backing": "checkout", "auto_disable": true}
+type FeatureFlag struct {
+	Key string          `json:"key"`
+	Path string         `json:"path"` // source path of the state of the flag: OK when enabled, Disabled when not
+	Backing string      `json:"backing,omitempty"` // source path of the subtree that the feature depends on
+	AutoDisable bool    `json:"auto_disable,omitempty"` // disable the flag when Backing is at MinLevel (or worse)
+}
+
+// evaluates boolean flags with the OpenFeature Remote Evaluation Protocol (OFREP), which flag services like flagd implement
+// note: OFREP only evaluates flags, to disable them set DisableFunc to a call of the management API of the flag service
+type OFREPProvider struct {
+	BaseURL string // e.g. http://flagd:8016, without /ofrep/v1
+	Header http.Header // additional request headers, e.g. Authorization
+	Context map[string]any // evaluation context, e.g. {"targetingKey": "jsonstate"}
+	Client *http.Client // http.DefaultClient if nil
+	DisableFunc func(ctx context.Context, key string) error
+}
+
+// interval at which a FlagBridge evaluates its flags
+var FlagPollInterval = 30 * time.Second
+
+// shows feature flags as states of a registry, Disabled when they are off, and disables flags (that allow it) when the subtree that backs them is at MinLevel (or worse)
+// note: a flag is never enabled again automatically, and every flag that is disabled is recorded in the audit log, and as annotation of its state
+type FlagBridge struct {
+	MinLevel int // of the backing subtree at which a flag is disabled, Fault by default
+	OnError func(error) // called for errors of the provider (logged with slog by default)
+	mu sync.Mutex
+	ctx context.Context // parent of the context of every provider call
+	registry *Registry
+	provider FlagProvider
+	audit *AuditLog
+	flags []FeatureFlag
+	disabling map[string]bool // flags that are disabled (or being disabled) by the bridge, until they are seen enabled again
+	queue chan func() // provider calls, in order
+	done chan struct{} // closed by Close
+	closed bool
+}
+
+// constructor: e.g. NewFlagBridge(ctx, registry, &OFREPProvider{BaseURL: "http://flagd:8016"}, audit).AddFlag(FeatureFlag{...}), evaluates the flags every FlagPollInterval until ctx is done or Close() is called
+// note: every provider call gets a context derived from ctx with NotifyTimeout
+func NewFlagBridge(ctx context.Context, r *Registry, provider FlagProvider, audit *AuditLog) *FlagBridge {
+	
+	b := &FlagBridge{
+		MinLevel: StateFault,
+		ctx: ctx,
+		registry: r,
+		provider: provider,
+		audit: audit,
+		disabling: map[string]bool{},
+		queue: make(chan func(), AlertQueueSize),
+		done: make(chan struct{}),
+	}
+	go b.run()
+	go b.poll()
+	context.AfterFunc(ctx, b.Close)
+	
+	r.OnTransition(b.Handle)
+	r.purgeAuditLog(audit)
+	
+	return b
+}
+// read feature flags from a JSON array (see FeatureFlag), e.g. [{"key": "new-checkout", "path": "features/new-checkout", "backing": "checkout", "auto_disable": true}]
+func LoadFeatureFlags(r io.Reader) ([]FeatureFlag, error) {
+	
+	flags := []FeatureFlag{}
+	if err := json.NewDecoder(r).Decode(&flags); err != nil {
+		return nil, err
+	}
+	
+	for _, flag := range flags {
+		if flag.Key == "" || len(SplitPath(flag.Path)) == 0 {
+			return nil, fmt.Errorf("jsonstate: feature flag without key or path: %q %q", flag.Key, flag.Path)
+		}
+	}
+	
+	return flags, nil
+}
+// add a flag, evaluated from the next poll on
+func (b *FlagBridge) AddFlag(flag FeatureFlag) *FlagBridge {
+	
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	
+	b.flags = append(b.flags, flag)
+	
+	return b
+}
+// stop evaluating and disabling flags, the provider calls already queued are still done (unless the context passed to NewFlagBridge is done)
+func (b *FlagBridge) Close() {
+	
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+		close(b.done)
+	}
+}
+// handle a transition of the registry (called automatically by the registry passed to NewFlagBridge)
+func (b *FlagBridge) Handle(t Transition) {
+	
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	
+	if b.closed || t.To < b.MinLevel {
+		return
+	}
+	
+	for _, flag := range b.flags {
+		if flag.AutoDisable && inSubtree(flag.Backing, t.Path) {
+			b.disable(flag, disableReason(t.Path, t.To, t.Message))
+		}
+	}
+}
+
+func (b *FlagBridge) poll() {
+	
+	ticker := time.NewTicker(FlagPollInterval)
+	defer ticker.Stop()
+	
+	for {
+		
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return
+		}
+		b.enqueue(b.refresh)
+		b.mu.Unlock()
+		
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+// note: must be called on the queue goroutine
+func (b *FlagBridge) refresh() {
+	
+	b.mu.Lock()
+	flags := append([]FeatureFlag{}, b.flags...)
+	b.mu.Unlock()
+	
+	for _, flag := range flags {
+		
+		ctx, cancel := context.WithTimeout(b.ctx, NotifyTimeout)
+		enabled, err := b.provider.Enabled(ctx, flag.Key)
+		cancel()
+		
+		if err != nil {
+			b.set(flag, StateUnknown, strings.TrimPrefix(err.Error(), "jsonstate: "))
+			b.error(fmt.Errorf("jsonstate: feature flag %s: %w", flag.Key, err))
+			continue
+		}
+		if !enabled {
+			b.set(flag, StateDisabled, "feature flag " + flag.Key + " is off")
+			continue
+		}
+		b.set(flag, StateOk, "")
+		
+		b.mu.Lock()
+		delete(b.disabling, flag.Key)
+		
+		// also for a backing subtree that was already down before the bridge (or the flag) started
+		if flag.AutoDisable && flag.Backing != "" && !b.closed {
+			if backing, err := b.registry.Lookup(flag.Backing); err == nil && backing.Level >= b.MinLevel {
+				message := backing.Message
+				if backing.CausedBy != "" {
+					message = "caused by " + backing.CausedBy
+				}
+				b.disable(flag, disableReason(flag.Backing, backing.Level, message))
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+// note: must be called while holding the lock
+func (b *FlagBridge) disable(flag FeatureFlag, reason string) {
+	
+	if b.disabling[flag.Key] {
+		return
+	}
+	b.disabling[flag.Key] = true
+	
+	b.enqueue(func() {
+		
+		ctx, cancel := context.WithTimeout(b.ctx, NotifyTimeout)
+		defer cancel()
+		
+		if err := b.provider.Disable(ctx, flag.Key); err != nil {
+			b.log(AuditEntry{
+				Action: "disable flag",
+				Path: flag.Path,
+				Message: flag.Key + ": failed: " + err.Error(),
+			})
+			b.error(fmt.Errorf("jsonstate: disable feature flag %s: %w", flag.Key, err))
+			return
+		}
+		
+		b.log(AuditEntry{
+			Action: "disable flag",
+			Path: flag.Path,
+			Message: flag.Key + ": " + reason,
+		})
+		b.set(flag, StateDisabled, "feature flag " + flag.Key + " was disabled automatically")
+		b.registry.Annotate(flag.Path, "jsonstate", "disabled feature flag " + flag.Key + " because " + reason)
+	})
+}
+// set the state of a flag, without touching it (and its datetime) if it did not change
+func (b *FlagBridge) set(flag FeatureFlag, level int, message string) {
+	b.registry.Update(SplitPath(flag.Path), func(s *State) {
+		if s.Level != level || s.Message != message {
+			s.Set(level, message)
+		}
+	})
+}
+// note: must be called while holding the lock
+func (b *FlagBridge) enqueue(fn func()) {
+	
+	select {
+	case b.queue <- fn:
+	default:
+		b.error(errors.New("jsonstate: feature flag queue is full, dropped provider call"))
+	}
+}
+func (b *FlagBridge) run() {
+	for fn := range b.queue {
+		
+		if b.ctx.Err() != nil {
+			continue // drop the rest of the queue
+		}
+		
+		fn()
+	}
+}
+func (b *FlagBridge) log(entry AuditEntry) {
+	if b.audit != nil {
+		b.audit.Record(entry)
+	}
+}
+func (b *FlagBridge) error(err error) {
+	
+	if b.OnError != nil {
+		b.OnError(err)
+		return
+	}
+	
+	slog.Error("jsonstate: feature flag", slog.String("error", err.Error()))
+}
+
+// e.g. "checkout/db is Fault: disk full"
+func disableReason(path string, level int, message string) string {
+	
+	if message == "" {
+		return fmt.Sprintf("%s is %s", path, LevelString(level))
+	}
+	
+	return fmt.Sprintf("%s is %s: %s", path, LevelString(level), message)
+}
+// whether path is root (a source path) or in its subtree
+func inSubtree(root string, path string) bool {
+	
+	root_path := SplitPath(root)
+	source_path := SplitPath(path)
+	if len(root_path) == 0 || len(source_path) < len(root_path) {
+		return false
+	}
+	
+	for i, source := range root_path {
+		if source_path[i] != source {
+			return false
+		}
+	}
+	
+	return true
+}
+
+func (p *OFREPProvider) Enabled(ctx context.Context, key string) (bool, error) {
+	
+	body, err := json.Marshal(map[string]any{
+		"context": p.Context,
+	})
+	if err != nil {
+		return false, err
+	}
+	
+	endpoint := strings.TrimSuffix(p.BaseURL, "/") + "/ofrep/v1/evaluate/flags/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range p.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return false, transportError("ofrep", endpoint, err)
+	}
+	defer res.Body.Close()
+	
+	evaluation := struct {
+		Value any              `json:"value"`
+		ErrorCode string       `json:"errorCode"`
+		ErrorDetails string    `json:"errorDetails"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1 << 16)).Decode(&evaluation); err != nil && res.StatusCode == http.StatusOK {
+		return false, transportError("ofrep", endpoint, err)
+	}
+	
+	if res.StatusCode != http.StatusOK {
+		return false, statusError("ofrep", endpoint, res.StatusCode, res.Status, []byte(strings.TrimSpace(evaluation.ErrorCode + " " + evaluation.ErrorDetails)))
+	}
+	
+	enabled, ok := evaluation.Value.(bool)
+	if !ok {
+		return false, fmt.Errorf("jsonstate: feature flag %s is not a boolean: %v", key, evaluation.Value)
+	}
+	
+	return enabled, nil
+}
+func (p *OFREPProvider) Disable(ctx context.Context, key string) error {
+	
+	if p.DisableFunc == nil {
+		return fmt.Errorf("jsonstate: disabling flags with OFREP: %w", errors.ErrUnsupported)
+	}
+	
+	return p.DisableFunc(ctx, key)
+}
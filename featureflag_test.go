@@ -0,0 +1,76 @@
+package jsonstate
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testFlagProvider struct {
+	mu sync.Mutex
+	enabled map[string]bool
+}
+
+func (p *testFlagProvider) Enabled(ctx context.Context, key string) (bool, error) {
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	return p.enabled[key], nil
+}
+func (p *testFlagProvider) Disable(ctx context.Context, key string) error {
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	p.enabled[key] = false
+	
+	return nil
+}
+
+func TestFlagBridgeDisablesFlag(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	r := NewRegistry("app")
+	audit := NewAuditLog(0)
+	provider := &testFlagProvider{enabled: map[string]bool{"new-checkout": true}}
+	NewFlagBridge(ctx, r, provider, audit).AddFlag(FeatureFlag{Key: "new-checkout", Path: "features/new-checkout", Backing: "checkout", AutoDisable: true})
+	
+	r.Component("checkout/db").Set(StateFault, "down")
+	
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		
+		if flag, err := r.Lookup("features/new-checkout"); err == nil && flag.Level == StateDisabled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("flag not disabled:\n%s", r.Snapshot())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	
+	if enabled, _ := provider.Enabled(ctx, "new-checkout"); enabled {
+		t.Error("flag still enabled at the provider")
+	}
+	
+	entries := audit.Entries()
+	if len(entries) != 1 || entries[0].Action != "disable flag" || !strings.Contains(entries[0].Message, "checkout/db is Fault: down") {
+		t.Errorf("audit log: %+v", entries)
+	}
+}
+func TestLoadFeatureFlags(t *testing.T) {
+	
+	flags, err := LoadFeatureFlags(strings.NewReader(`[{"key": "a", "path": "features/a", "backing": "db", "auto_disable": true}]`))
+	if err != nil || len(flags) != 1 || !flags[0].AutoDisable || flags[0].Backing != "db" {
+		t.Errorf("LoadFeatureFlags = %+v, %v", flags, err)
+	}
+	
+	if _, err := LoadFeatureFlags(strings.NewReader(`[{"key": "a"}]`)); err == nil {
+		t.Error("loaded a flag without path")
+	}
+}
@@ -0,0 +1,64 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlatRoundTrip(t *testing.T) {
+	
+	s := New("root")
+	s.Tree = []*State{{Source: "", Level: StateOk}, {Source: "", Level: StateError, Message: "second"}, {Source: "x/y", Level: StateWarning}}
+	s.Tree[2].Tree = []*State{{Source: "z", Level: StateWarning}}
+	
+	want, _ := json.Marshal(s)
+	
+	flat, err := json.Marshal(s.Flatten())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(parsed); string(got) != string(want) {
+		t.Errorf("Parse of Flatten:\ngot  %s\nwant %s", got, want)
+	}
+	
+	for _, name := range []string{"flat", "ndjson"} {
+		
+		codec, _ := CodecByName(name)
+		data, err := codec.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		decoded, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, _ := json.Marshal(decoded); string(got) != string(want) {
+			t.Errorf("%s round trip:\ngot  %s\nwant %s", name, got, want)
+		}
+	}
+}
+func TestReverseFlattenFiltered(t *testing.T) {
+	
+	s := FromMap(map[string]int{"db/primary": StateError, "db/replica": StateOk, "web": StateOk})
+	
+	// without db and the entries at OK, the parents do not agree with the list, and the paths are used
+	list := []*FlatState{}
+	for _, item := range s.Flatten() {
+		if item.Level != StateOk && item.Path != "db" {
+			list = append(list, item)
+		}
+	}
+	
+	r := ReverseFlatten(list)
+	if primary, err := r.Lookup("db/primary"); err != nil || primary.Level != StateError {
+		t.Errorf("filtered list: %s", r)
+	}
+	if _, err := r.Lookup("web"); err == nil {
+		t.Errorf("filtered list has web: %s", r)
+	}
+}
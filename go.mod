@@ -1,3 +1,5 @@
 module github.com/jetibest/jsonstate
 
 go 1.22.4
+
+require golang.org/x/text v0.21.0
@@ -0,0 +1,190 @@
+package jsonstate
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// in-memory store of transitions (and annotations), record the transitions of a Registry with r.RecordHistory(h)
+type History struct {
+	mu sync.RWMutex
+	retention time.Duration
+	transitions []Transition // ordered by Time
+	annotations []PathAnnotation // ordered by Time
+}
+// level-over-time grid, with a row per source path and a column per bucket of Resolution, starting at Start
+type Heatmap struct {
+	Start time.Time          `json:"start"`
+	Resolution time.Duration `json:"resolution"`
+	Rows []*HeatmapRow       `json:"rows"`
+}
+type HeatmapRow struct {
+	Path string              `json:"path"`
+	Levels []int             `json:"levels"` // the worst level in each bucket
+}
+
+// maximum number of buckets in a row of a Heatmap, a finer resolution is coarsened to fit the window (zero or less for no limit)
+var MaxHeatmapBuckets = 10000
+
+// constructor: transitions older than retention are dropped (zero keeps everything)
+func NewHistory(retention time.Duration) *History {
+	return &History{
+		retention: retention,
+	}
+}
+// add a transition to the history (the signature matches Registry.OnTransition)
+func (h *History) Record(t Transition) {
+	
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	
+	// typically appended at the end, but keep the order if transitions are recorded out of order
+	i := sort.Search(len(h.transitions), func(i int) bool {
+		return h.transitions[i].Time.After(t.Time)
+	})
+	h.transitions = append(h.transitions, Transition{})
+	copy(h.transitions[i + 1:], h.transitions[i:])
+	h.transitions[i] = t
+	
+	h.prune(time.Now())
+}
+// the recorded transitions (ordered by time) from since (inclusive), for the given source path (or all paths if empty)
+func (h *History) Transitions(path string, since time.Time) []Transition {
+	
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	
+	list := []Transition{}
+	for _, t := range h.transitions {
+		if !t.Time.Before(since) && (path == "" || t.Path == path) {
+			list = append(list, t)
+		}
+	}
+	
+	return list
+}
+// level-over-time grid for the window that ends at end, e.g. h.Heatmap(time.Now(), 24 * time.Hour, 5 * time.Minute)
+// note: the resolution is coarsened if the window would have more than MaxHeatmapBuckets, see Resolution of the result
+// note: a bucket contains the level at its start (as of the last earlier transition, Unknown if there was none) and every level that was transitioned to within the bucket
+func (h *History) Heatmap(end time.Time, window time.Duration, resolution time.Duration) *Heatmap {
+	
+	if window <= 0 {
+		return &Heatmap{
+			Start: end,
+			Resolution: resolution,
+			Rows: []*HeatmapRow{},
+		}
+	}
+	if resolution <= 0 {
+		resolution = window
+	}
+	
+	buckets := int((window + resolution - 1) / resolution)
+	if buckets < 0 {
+		buckets = 0 // overflow
+	}
+	if MaxHeatmapBuckets > 0 && buckets > MaxHeatmapBuckets {
+		
+		// e.g. a resolution of a millisecond over a month, coarsened so that every row still fits in MaxHeatmapBuckets
+		resolution = (window + time.Duration(MaxHeatmapBuckets) - 1) / time.Duration(MaxHeatmapBuckets)
+		buckets = int((window + resolution - 1) / resolution)
+	}
+	start := end.Add(-time.Duration(buckets) * resolution)
+	
+	heatmap := &Heatmap{
+		Start: start,
+		Resolution: resolution,
+		Rows: []*HeatmapRow{},
+	}
+	
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	
+	rows := map[string]*HeatmapRow{}
+	current := map[string]int{} // level per path, as of the last transition processed
+	filled := map[string]int{} // per path, the last bucket that has been filled with the current level
+	
+	for _, t := range h.transitions {
+		
+		if !t.Time.Before(end) {
+			break
+		}
+		
+		row, ok := rows[t.Path]
+		if !ok {
+			row = &HeatmapRow{
+				Path: t.Path,
+				Levels: make([]int, buckets),
+			}
+			rows[t.Path] = row
+			heatmap.Rows = append(heatmap.Rows, row)
+			filled[t.Path] = -1
+		}
+		
+		if t.Time.Before(start) {
+			current[t.Path] = t.To
+			continue
+		}
+		
+		// the previous level lasts up to (and including) the bucket of this transition
+		i := int(t.Time.Sub(start) / resolution)
+		fillHeatmapRow(row, filled[t.Path] + 1, i, current[t.Path])
+		filled[t.Path] = i
+		
+		if t.To > row.Levels[i] {
+			row.Levels[i] = t.To
+		}
+		current[t.Path] = t.To
+	}
+	
+	for _, row := range heatmap.Rows {
+		fillHeatmapRow(row, filled[row.Path] + 1, buckets - 1, current[row.Path])
+	}
+	
+	sort.Slice(heatmap.Rows, func(i, j int) bool {
+		return heatmap.Rows[i].Path < heatmap.Rows[j].Path
+	})
+	
+	return heatmap
+}
+// option: record all transitions of the registry in the given history
+func (r *Registry) RecordHistory(h *History) *Registry {
+	
+	r.mu.Lock()
+	r.histories = append(r.histories, h)
+	r.mu.Unlock()
+	
+	return r.OnTransition(h.Record)
+}
+
+// raise the buckets from i up to and including j to at least level
+func fillHeatmapRow(row *HeatmapRow, i int, j int, level int) {
+	for ; i <= j; i += 1 {
+		if row.Levels[i] < level {
+			row.Levels[i] = level
+		}
+	}
+}
+// note: must be called while holding the lock
+func (h *History) prune(now time.Time) {
+	
+	if h.retention <= 0 {
+		return
+	}
+	
+	cutoff := now.Add(-h.retention)
+	i := sort.Search(len(h.transitions), func(i int) bool {
+		return !h.transitions[i].Time.Before(cutoff)
+	})
+	if i > 0 {
+		h.transitions = append(h.transitions[:0:0], h.transitions[i:]...)
+	}
+	
+	i = sort.Search(len(h.annotations), func(i int) bool {
+		return !h.annotations[i].Time.Before(cutoff)
+	})
+	if i > 0 {
+		h.annotations = append(h.annotations[:0:0], h.annotations[i:]...)
+	}
+}
@@ -0,0 +1,55 @@
+package jsonstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeatmap(t *testing.T) {
+	
+	end := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	
+	h := NewHistory(0)
+	h.Record(Transition{Path: "db", From: StateOk, To: StateError, Time: end.Add(-90 * time.Minute)})
+	h.Record(Transition{Path: "db", From: StateError, To: StateOk, Time: end.Add(-30 * time.Minute)})
+	
+	heatmap := h.Heatmap(end, 2 * time.Hour, time.Hour)
+	if len(heatmap.Rows) != 1 {
+		t.Fatalf("heatmap has %d rows, want 1", len(heatmap.Rows))
+	}
+	if levels := heatmap.Rows[0].Levels; len(levels) != 2 || levels[0] != StateError || levels[1] != StateError {
+		t.Errorf("levels %v, want [%d %d]", levels, StateError, StateError)
+	}
+}
+func TestHeatmapEmptyWindow(t *testing.T) {
+	
+	h := NewHistory(0)
+	h.Record(Transition{Path: "db", From: StateOk, To: StateError, Time: time.Now().Add(-time.Minute)})
+	
+	for _, window := range []time.Duration{0, -time.Hour} {
+		if heatmap := h.Heatmap(time.Now(), window, time.Minute); len(heatmap.Rows) != 0 {
+			t.Errorf("heatmap of window %s has %d rows, want none", window, len(heatmap.Rows))
+		}
+	}
+}
+func TestHeatmapMaxBuckets(t *testing.T) {
+	
+	end := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	
+	h := NewHistory(0)
+	h.Record(Transition{Path: "db", From: StateOk, To: StateError, Time: end.Add(-time.Hour)})
+	
+	heatmap := h.Heatmap(end, 30 * 24 * time.Hour, time.Nanosecond)
+	if len(heatmap.Rows) != 1 {
+		t.Fatalf("heatmap has %d rows, want 1", len(heatmap.Rows))
+	}
+	if n := len(heatmap.Rows[0].Levels); n > MaxHeatmapBuckets || n < MaxHeatmapBuckets / 2 {
+		t.Errorf("heatmap has %d buckets, want at most %d", n, MaxHeatmapBuckets)
+	}
+	if got := heatmap.Start.Add(time.Duration(len(heatmap.Rows[0].Levels)) * heatmap.Resolution); !got.Equal(end) {
+		t.Errorf("buckets of %s end at %s, want %s", heatmap.Resolution, got, end)
+	}
+	if levels := heatmap.Rows[0].Levels; levels[len(levels) - 1] != StateError {
+		t.Errorf("last bucket %d, want %d", levels[len(levels) - 1], StateError)
+	}
+}
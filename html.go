@@ -0,0 +1,75 @@
+package jsonstate
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"time"
+)
+
+var htmlTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"levelString": LevelString,
+	"levelClass": func(level int) string {
+		return strings.ToLower(builtinLevelString(level)) // custom levels are colored like the built-in level they fall into
+	},
+	// formatted in the locale at the time of rendering, not of parsing the template
+	"lang": func() string {
+		return CurrentLocale().Name
+	},
+	"age": func(datetime string) string {
+		return CurrentLocale().FormatAge(datetime, time.Now())
+	},
+	"count": func(count int) string {
+		return CurrentLocale().FormatCount(count)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{if .Source}}{{.Source}}: {{end}}{{levelString .Level}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+ul { list-style: none; margin: 0; padding-left: 1.5em; }
+summary, .leaf { padding: 0.2em 0; }
+summary { cursor: pointer; }
+.badge { display: inline-block; min-width: 6em; padding: 0.1em 0.5em; border-radius: 0.3em; color: #fff; text-align: center; font-size: 0.9em; }
+.unknown, .disabled { background: #888; }
+.ok { background: #2a2; }
+.attention { background: #cb0; }
+.warning { background: #e80; }
+.error { background: #d33; }
+.fault { background: #a00; }
+.panic { background: #000; }
+.source { font-weight: bold; margin-left: 0.5em; }
+.message { margin-left: 0.5em; }
+.datetime, .count { margin-left: 0.5em; color: #888; font-size: 0.8em; }
+.annotations { margin: 0.2em 0 0.2em 1.5em; padding: 0; font-size: 0.9em; color: #444; }
+.annotations .author { font-weight: bold; margin: 0 0.5em; }
+</style>
+</head>
+<body>
+{{template "state" .}}
+</body>
+</html>
+{{define "line"}}<span class="badge {{levelClass .Level}}">{{.Level}} {{levelString .Level}}</span>{{if .Source}}<span class="source">{{.Source}}</span>{{end}}{{if .Message}}<span class="message">{{.Message}}</span>{{end}}{{if .Datetime}}<span class="datetime" title="{{.Datetime}}">{{with age .Datetime}}{{.}}{{else}}{{$.Datetime}}{{end}}</span>{{end}}{{if gt .Count 1}}<span class="count">{{count .Count}}</span>{{end}}{{if .RunbookURL}} <a href="{{.RunbookURL}}">runbook</a>{{end}}{{end}}
+{{- define "annotations"}}{{if .Annotations}}
+<ul class="annotations">
+{{range .Annotations}}<li><span class="datetime">{{.Time.Format "2006-01-02 15:04:05"}}</span>{{if .Author}}<span class="author">{{.Author}}</span>{{end}}{{.Text}}</li>
+{{end}}</ul>{{end}}{{end}}
+{{- define "state"}}{{if .Tree}}<details open><summary>{{template "line" .}}</summary>{{template "annotations" .}}
+<ul>
+{{range .Tree}}<li>{{template "state" .}}</li>
+{{end}}</ul>
+</details>{{else}}<div class="leaf">{{template "line" .}}{{template "annotations" .}}</div>{{end}}{{end}}`))
+
+// standalone HTML page with the tree as collapsible list (one should probably call AggregateLevels() first)
+// note: ages and counts are formatted in the current locale (see SetLocale), with the datetime as tooltip
+func (s *State) ToHTML() ([]byte, error) {
+	
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, s); err != nil {
+		return nil, err
+	}
+	
+	return buf.Bytes(), nil
+}
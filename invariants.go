@@ -0,0 +1,45 @@
+//go:build jsonstate_invariants
+
+package jsonstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// development build (go build -tags jsonstate_invariants): tree operations check the trees they return, and panic on the first violation, so that a bug surfaces where it is introduced rather than where the tree is used
+// note: never use this tag in production, where a malformed tree is reported by CheckTree and repaired by the registry instead
+func checkInvariants(op string, s *State) {
+	
+	if s == nil {
+		return
+	}
+	
+	if err := s.CheckTree(); err != nil {
+		panic(fmt.Sprintf("jsonstate: %s: invariant violated: %v", op, err))
+	}
+}
+// an aggregated tree has the worst level of its children at every state with a tree
+func checkAggregated(op string, s *State) {
+	
+	checkInvariants(op, s)
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if len(s_it.Tree) == 0 || len(source_path) >= MaxDepth {
+			return true
+		}
+		
+		level := StateUnknown
+		for _, s_child := range s_it.Tree {
+			if s_child.Level > level {
+				level = s_child.Level
+			}
+		}
+		if s_it.Level != level {
+			panic(fmt.Sprintf("jsonstate: %s: invariant violated: /%s has level %d, but the worst of its tree is %d", op, strings.Join(source_path, "/"), s_it.Level, level))
+		}
+		
+		return true
+	})
+}
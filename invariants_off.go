@@ -0,0 +1,7 @@
+//go:build !jsonstate_invariants
+
+package jsonstate
+
+// see invariants.go, without the jsonstate_invariants build tag the checks compile to nothing
+func checkInvariants(op string, s *State) {}
+func checkAggregated(op string, s *State) {}
@@ -1,7 +1,9 @@
 package jsonstate
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -17,6 +19,14 @@ const (
 	StatePanic int = 700 // something is going wrong (crash), and it's uncertain what the consequences are, so the worst must be assumed, and manual intervention is always required
 )
 
+// override modes (see Apply)
+const (
+	OverrideReplace string = "replace" // report the override level instead of the live level
+	OverrideCap string = "cap" // never report worse than the override level
+	OverrideFloor string = "floor" // never report better than the override level
+	OverrideClear string = "clear" // report Unknown (not-applicable), without a message
+)
+
 // note: Tree is an array so that we may set a custom logical order, but "source" should be unique for each State object in the same Tree!
 // note: we may store a /etc/<module>/state_override.json file with custom levels, and then override with s.Apply(importedState)
 // note: if source is empty, we semantically refer to the parent State
@@ -30,24 +40,242 @@ type State struct {
 	Datetime string    `json:"datetime,omitempty"`
 	Tree []*State      `json:"tree,omitempty"`
 	Override bool      `json:"override,omitempty"`
+	RunbookURL string  `json:"runbook_url,omitempty"`
+	Count int          `json:"count,omitempty"` // number of times Set was called with a level of Attention or worse
+	FirstSeen string   `json:"first_seen,omitempty"` // datetime of the first of these
+	LastSeen string    `json:"last_seen,omitempty"` // datetime of the last of these
+	CausedBy string    `json:"caused_by,omitempty"` // source path of the state in the tree that determined Level in AggregateLevels()
+	SLA *SLA           `json:"sla,omitempty"`
+	Annotations []Annotation `json:"annotations,omitempty"` // manual notes, oldest first (see Annotate)
+	Mode string        `json:"mode,omitempty"` // only for override states, see Apply()
+	KeepMessage bool   `json:"keep_message,omitempty"` // only for override states, see Apply()
 }
 type FlatState struct {
 	Depth int          `json:"depth"`
+	Path string        `json:"path,omitempty"` // source path relative to the flattened State (see SplitPath)
+	Parent int         `json:"parent"` // index of the parent entry in the list returned by Flatten(), -1 for the flattened State itself
 	Level int          `json:"level"`
 	Source string      `json:"source,omitempty"`
 	Message string     `json:"message,omitempty"`
 	Datetime string    `json:"datetime,omitempty"`
 	Override bool      `json:"override,omitempty"`
+	RunbookURL string  `json:"runbook_url,omitempty"`
+	Count int          `json:"count,omitempty"`
+	FirstSeen string   `json:"first_seen,omitempty"`
+	LastSeen string    `json:"last_seen,omitempty"`
+	CausedBy string    `json:"caused_by,omitempty"`
+	SLA *SLA           `json:"sla,omitempty"`
+	Annotations []Annotation `json:"annotations,omitempty"`
 }
 
+// reset Count, FirstSeen and LastSeen when a state is Set to a level better than Attention (by default they are kept, so that one can tell how often an entry had problems)
+var ResetCountOnRecovery = false
+
 // constructor: jsonstate.New(...) instead of &jsonstate.State{}, the former is slightly more readable though less flexible
 func New(source string) *State {
 	return &State{
-		Source: source,
+		Source: NormalizeSource(source),
+	}
+}
+// constructor: build a tree from a map of source path (see SplitPath) to level, intermediate states are created as needed (and the empty path is the root itself)
+func FromMap(levels map[string]int) *State {
+	
+	// sort for a deterministic tree order
+	paths := make([]string, 0, len(levels))
+	for path := range levels {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	
+	root := New("")
+	for _, path := range paths {
+		
+		s := root
+		for _, source := range SplitPath(path) {
+			
+			s_it := s.FindBySource(source)
+			if s_it == nil {
+				s_it = New(source)
+				s.Add(s_it)
+			}
+			s = s_it
+		}
+		
+		s.Level = levels[path]
 	}
+	
+	return root
 }
+// constructor: rebuild a tree from Flatten() output, using Depth to find the parent of each entry (an entry that is nested too deep is added to the last state, and any later entry at depth 0 is added to the root)
+func FromFlat(list []*FlatState) *State {
+	
+	if len(list) == 0 {
+		return nil
+	}
+	
+	if list[0] == nil {
+		return nil
+	}
+	
+	root := fromFlatState(list[0])
+	
+	// stack[i] is the last state at depth i
+	stack := []*State{root}
+	for _, item := range list[1:] {
+		
+		if item == nil {
+			continue
+		}
+		
+		depth := item.Depth
+		if depth < 1 {
+			depth = 1
+		} else if depth > len(stack) {
+			depth = len(stack)
+		}
+		
+		s := fromFlatState(item)
+		stack[depth - 1].Add(s)
+		stack = append(stack[:depth], s)
+	}
+	
+	return root
+}
+
+// constructor: rebuild a tree from Flatten() output using the Parent of each entry, or else (if the list was filtered or reordered, or has no parents) the Path of each entry (states that are missing in between are created without a level, and an entry without Path is the root)
+// note: a path does not tell apart sources that are empty or contain a "/", the parents do
+func ReverseFlatten(list []*FlatState) *State {
+	
+	if root := fromFlatParents(list); root != nil {
+		return root
+	}
+	
+	// add parents before their children, and otherwise keep the order of the list
+	sorted := []*FlatState{}
+	for _, item := range list {
+		if item != nil {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(SplitPath(sorted[i].Path)) < len(SplitPath(sorted[j].Path))
+	})
+	
+	var root *State
+	states := map[string]*State{}
+	
+	for _, item := range sorted {
+		
+		source_path := SplitPath(item.Path)
+		path := strings.Join(source_path, "/")
+		
+		s := fromFlatState(item)
+		if len(source_path) == 0 {
+			if root == nil {
+				root = s
+				states[""] = s
+			}
+			continue
+		}
+		
+		if root == nil {
+			root = New("")
+			states[""] = root
+		}
+		
+		if _, ok := states[path]; ok {
+			continue // duplicate entry
+		}
+		
+		// the parent (or any state in between) may have been filtered out
+		parent := root
+		for i := 1; i < len(source_path); i += 1 {
+			
+			parent_path := strings.Join(source_path[:i], "/")
+			if states[parent_path] == nil {
+				states[parent_path] = New(source_path[i - 1])
+				parent.Add(states[parent_path])
+			}
+			parent = states[parent_path]
+		}
+		
+		s.Source = source_path[len(source_path) - 1]
+		parent.Add(s)
+		states[path] = s
+	}
+	
+	return root
+}
+
+// rebuild a tree from the parents of a list as returned by Flatten(), or nil if the parents (or depths and paths) do not agree with the list
+func fromFlatParents(list []*FlatState) *State {
+	
+	if len(list) == 0 || list[0] == nil || list[0].Parent != -1 || list[0].Path != "" {
+		return nil
+	}
+	
+	states := make([]*State, len(list))
+	states[0] = fromFlatState(list[0])
+	for i, item := range list[1:] {
+		
+		i += 1
+		if item == nil || item.Parent < 0 || item.Parent >= i {
+			return nil
+		}
+		
+		parent := list[item.Parent]
+		path := item.Source
+		if parent.Path != "" {
+			path = parent.Path + "/" + item.Source
+		}
+		if item.Depth != parent.Depth + 1 || item.Path != path {
+			return nil
+		}
+		
+		states[i] = fromFlatState(item)
+		states[item.Parent].Add(states[i])
+	}
+	
+	return states[0]
+}
+func fromFlatState(item *FlatState) *State {
+	return &State{
+		Level: item.Level,
+		Source: item.Source,
+		Message: item.Message,
+		Datetime: item.Datetime,
+		Override: item.Override,
+		RunbookURL: item.RunbookURL,
+		Count: item.Count,
+		FirstSeen: item.FirstSeen,
+		LastSeen: item.LastSeen,
+		CausedBy: item.CausedBy,
+		SLA: item.SLA,
+		Annotations: item.Annotations,
+	}
+}
+// human readable name of a level, custom levels (see RegisterLevel) take precedence over the built-in level they fall into
 func LevelString(level int) string {
 	
+	if name, custom_level, ok := customLevelString(level); ok && custom_level >= builtinLevel(level) {
+		return name
+	}
+	
+	return builtinLevelString(level)
+}
+// the built-in level that the given level falls into
+func builtinLevel(level int) int {
+	
+	if level < StateUnknown {
+		return StateUnknown
+	} else if level > StatePanic {
+		return StatePanic
+	}
+	
+	return level - level % 100
+}
+func builtinLevelString(level int) string {
+	
 	if level < 100 {
 		
 		return "Unknown"
@@ -85,12 +313,19 @@ func LevelString(level int) string {
 
 // apply override state object recursively, it will never introduce new states though, that would be confusing, because then something may become a tree, where it is not supposed to be as such
 func (s *State) Apply(override *State) {
-	if override == nil {
+	s.apply(override, 0)
+	checkInvariants("Apply", s)
+}
+func (s *State) apply(override *State, depth int) {
+	if override == nil || depth > MaxDepth {
 		return // nothing to apply
 	}
 	
 	// override Level and Message iff Source matches
-	if override.Source != s.Source {
+	// note: an override without Mode keeps the original behavior, an explicit Mode always applies to the state it is matched with
+	if override.Mode != "" {
+		s.applyMode(override)
+	} else if NormalizeSource(override.Source) != NormalizeSource(s.Source) {
 		s.Override = true
 		s.Level = override.Level
 		s.Message = override.Message
@@ -101,6 +336,10 @@ func (s *State) Apply(override *State) {
 		
 		for _, override_it := range override.Tree {
 			
+			if override_it == nil {
+				continue
+			}
+			
 			// apply override to the entire tree of s, if a wildcard is specified
 			list := s.Tree
 			
@@ -109,7 +348,7 @@ func (s *State) Apply(override *State) {
 				list = []*State{}
 				if s.Tree != nil {
 					for _, s_it := range s.Tree {
-						if s_it.Source == override_it.Source {
+						if s_it != nil && NormalizeSource(s_it.Source) == NormalizeSource(override_it.Source) {
 							list = append(list, s_it)
 						}
 					}
@@ -118,34 +357,138 @@ func (s *State) Apply(override *State) {
 			
 			// apply to every filtered tree
 			for _, s_it := range list {
-				s_it.Apply(override_it)
+				if s_it != nil {
+					s_it.apply(override_it, depth + 1)
+				}
 			}
 		}
 	}
 }
+// apply a single override with an explicit Mode, the message (and datetime) of the override replace the live ones when the level is changed, unless KeepMessage is set
+func (s *State) applyMode(override *State) {
+	
+	level := s.Level
+	message := override.Message
+	datetime := override.Datetime
+	
+	switch override.Mode {
+	case OverrideReplace:
+		level = override.Level
+	case OverrideCap:
+		if level > override.Level {
+			level = override.Level
+		}
+	case OverrideFloor:
+		if level < override.Level {
+			level = override.Level
+		}
+	case OverrideClear:
+		level = StateUnknown
+		message = ""
+		datetime = ""
+	default:
+		return // unknown mode, rather not override than guess
+	}
+	
+	if level == s.Level && override.Mode != OverrideReplace && override.Mode != OverrideClear {
+		return // cap/floor not reached, the live state is reported as is
+	}
+	
+	s.Override = true
+	s.Level = level
+	if !override.KeepMessage {
+		s.Message = message
+		s.Datetime = datetime
+	}
+}
+// apply like Apply, and report the parts of the override that cannot be applied: an unknown Mode, or a source that is not in the tree
+// note: the returned error joins an error per rejected override, each wrapping ErrOverrideRejected (and ErrSourceNotFound for a missing source)
+func (s *State) ApplyChecked(override *State) error {
+	
+	s.Apply(override)
+	
+	errs := []error{}
+	checkOverride(s, override, nil, &errs)
+	
+	return errors.Join(errs...)
+}
+func checkOverride(s *State, override *State, source_path []string, errs *[]error) {
+	
+	if override == nil || len(source_path) > MaxDepth {
+		return
+	}
+	
+	switch override.Mode {
+	case "", OverrideReplace, OverrideCap, OverrideFloor, OverrideClear:
+	default:
+		*errs = append(*errs, fmt.Errorf("%w: unknown mode %q for /%s", ErrOverrideRejected, override.Mode, strings.Join(source_path, "/")))
+	}
+	
+	for _, override_it := range override.Tree {
+		
+		if override_it == nil {
+			continue
+		}
+		
+		matched := false
+		for _, s_it := range s.Tree {
+			if s_it != nil && (override_it.Source == "*" || NormalizeSource(s_it.Source) == NormalizeSource(override_it.Source)) {
+				matched = true
+				checkOverride(s_it, override_it, append(source_path[:len(source_path):len(source_path)], s_it.Source), errs)
+			}
+		}
+		
+		// a wildcard may match nothing
+		if !matched && override_it.Source != "*" {
+			*errs = append(*errs, &sentinelsError{
+				message: "jsonstate: override rejected: source not found: /" + strings.Join(append(source_path[:len(source_path):len(source_path)], override_it.Source), "/"),
+				sentinels: []error{ErrOverrideRejected, ErrSourceNotFound},
+			})
+		}
+	}
+}
 // this also means, no Tree can/should exist (the root state must be re-evaluated if any level is changed, with rootState.AggregateLevels())
 func (s *State) Set(level int, message string) *State {
 	s.Level = level
 	s.Message = message
 	s.Datetime = time.Now().Format(time.RFC3339)
 	
+	// track occurrences
+	if level >= StateAttention {
+		s.Count += 1
+		if s.FirstSeen == "" {
+			s.FirstSeen = s.Datetime
+		}
+		s.LastSeen = s.Datetime
+	} else if ResetCountOnRecovery {
+		s.Count = 0
+		s.FirstSeen = ""
+		s.LastSeen = ""
+	}
+	
 	return s
 }
 // add/remove Tree states based on the given array (first argument is typically 0, but may be set higher, to ignore first N items in the Tree as non-dynamic states)
 func (s *State) EnsureTree(offset int, array []any, get_source func(any) string) *State {
 	
+	if offset < 0 {
+		offset = 0
+	} else if offset > len(s.Tree) {
+		offset = len(s.Tree)
+	}
+	
 	sOffsetTree := s.Tree[offset:]
 	
-	// create a new tree array, but ensure matching with given array
-	newTree := s.Tree[:offset]
+	// create a new tree array (not appending to s.Tree, which would overwrite the states that are still to be matched), but ensure matching with given array
+	newTree := append([]*State{}, s.Tree[:offset]...)
 	for _, a := range array {
 		
-		a_source := get_source(a)
+		a_source := NormalizeSource(get_source(a))
 		
 		// get current instance, if possible, based on first matching source in the remaining Tree that we fix
 		var s *State
 		for _, s_it := range sOffsetTree {
-			if s_it.Source == a_source {
+			if s_it != nil && NormalizeSource(s_it.Source) == a_source {
 				s = s_it
 				break
 			}
@@ -159,15 +502,74 @@ func (s *State) EnsureTree(offset int, array []any, get_source func(any) string)
 	s.Tree = newTree
 	return s
 }
-// add new state to tree
+// add new state to tree (see Upsert to replace a state with the same source instead)
 func (s *State) Add(s_list ...*State) *State {
 	
 	for _, s_it := range s_list {
-		s.Tree = append(s.Tree, s_it)
+		if s_it != nil {
+			s_it.Source = NormalizeSource(s_it.Source)
+			s.Tree = append(s.Tree, s_it)
+		}
 	}
 	
 	return s
 }
+// remove states with the given source from the tree, returns false if there was no such state
+func (s *State) Remove(source string) bool {
+	
+	if s.Tree == nil {
+		return false
+	}
+	
+	source = NormalizeSource(source)
+	
+	removed := false
+	newTree := []*State{}
+	for _, s_it := range s.Tree {
+		if s_it == nil {
+			continue
+		}
+		if NormalizeSource(s_it.Source) == source {
+			removed = true
+			continue
+		}
+		newTree = append(newTree, s_it)
+	}
+	
+	s.Tree = newTree
+	return removed
+}
+// deep copy of this State and its recursive tree (without nil states, and at most MaxDepth deep)
+func (s *State) Clone() *State {
+	
+	c := s.clone(0)
+	checkInvariants("Clone", c)
+	
+	return c
+}
+func (s *State) clone(depth int) *State {
+	
+	c := *s
+	
+	if s.SLA != nil {
+		sla := *s.SLA
+		c.SLA = &sla
+	}
+	if s.Annotations != nil {
+		c.Annotations = append([]Annotation{}, s.Annotations...)
+	}
+	
+	if s.Tree != nil {
+		c.Tree = make([]*State, 0, len(s.Tree))
+		for _, s_it := range s.Tree {
+			if s_it != nil && depth < MaxDepth {
+				c.Tree = append(c.Tree, s_it.clone(depth + 1))
+			}
+		}
+	}
+	
+	return &c
+}
 // return matching sources (recurse for multiple parameters)
 func (s *State) FindBySource(source_path ...string) *State {
 	
@@ -176,10 +578,10 @@ func (s *State) FindBySource(source_path ...string) *State {
 	}
 	if len(source_path) > 0 {
 		
-		source := source_path[0]
+		source := NormalizeSource(source_path[0])
 		
 		for _, s_it := range s.Tree {
-			if s_it.Source == source {
+			if s_it != nil && NormalizeSource(s_it.Source) == source {
 				
 				if len(source_path) > 1 {
 					return s_it.FindBySource(source_path[1:]...)
@@ -192,40 +594,94 @@ func (s *State) FindBySource(source_path ...string) *State {
 	
 	return nil
 }
+// find the state with the given source path in the tree, or an error wrapping ErrSourceNotFound
+func (s *State) Lookup(path string) (*State, error) {
+	
+	source_path := SplitPath(path)
+	if len(source_path) == 0 {
+		return s, nil
+	}
+	
+	s_it := s.FindBySource(source_path...)
+	if s_it == nil {
+		return nil, fmt.Errorf("%w: /%s", ErrSourceNotFound, strings.Join(source_path, "/"))
+	}
+	
+	return s_it, nil
+}
 // aggregate levels in this State's recursive tree
 func (s *State) AggregateLevels() *State {
 	
-	if s.Tree == nil {
+	s.aggregateLevels(nil, nil)
+	checkAggregated("AggregateLevels", s)
+	
+	return s
+}
+// see AggregateLevels, and record every decision in x (if not nil)
+func (s *State) aggregateLevels(source_path []string, x *explainer) *State {
+	
+	if s.Tree == nil || len(source_path) >= MaxDepth {
 		return s
 	}
 	
 	maxLevelDatetime := time.Now().Format(time.RFC3339)
 	maxLevel := 0
+	maxLevelCausedBy := ""
 	for _, s_it := range s.Tree {
 		
+		if s_it == nil {
+			continue
+		}
+		
 		// update s_it.Level with the aggregated level
-		s_it.AggregateLevels()
+		s_it.aggregateLevels(append(source_path[:len(source_path):len(source_path)], s_it.Source), x)
 		
 		if s_it.Level > maxLevel {
 			maxLevel = s_it.Level
 			maxLevelDatetime = s_it.Datetime
+			
+			// follow the path down to the state that actually has this level
+			maxLevelCausedBy = s_it.Source
+			if s_it.CausedBy != "" {
+				maxLevelCausedBy = s_it.Source + "/" + s_it.CausedBy
+			}
 		}
 	}
 	
 	s.Datetime = maxLevelDatetime
 	s.Level = maxLevel
+	s.CausedBy = maxLevelCausedBy
+	
+	x.aggregated(source_path, s)
 	
 	return s
 }
 // this is particularly useful for exporting to a flat list for simple iteration
 func (s *State) Flatten() []*FlatState {
-	return rflat(s, 0)
+	
+	list := rflat(s, 0, "")
+	
+	// stack[i] is the index of the last entry at depth i
+	stack := []int{}
+	for i, item := range list {
+		
+		item.Parent = -1
+		if item.Depth > 0 {
+			item.Parent = stack[item.Depth - 1]
+		}
+		stack = append(stack[:item.Depth], i)
+	}
+	
+	return list
 }
 // human readable string (one should probably call AggregateLevels() first)
+// note: numbers are formatted in the current locale (see SetLocale)
 func (s *State) String() string {
 	
 	var sb strings.Builder
 	
+	l := CurrentLocale()
+	
 	for _, item := range s.Flatten() {
 		
 		for i := 0; i < item.Depth; i += 1 {
@@ -246,29 +702,67 @@ func (s *State) String() string {
 			sb.WriteString(fmt.Sprintf(": %s", item.Message))
 		}
 		
+		if item.CausedBy != "" {
+			sb.WriteString(fmt.Sprintf(" (caused by [%s])", item.CausedBy))
+		}
+		
+		if item.Count > 1 {
+			sb.WriteString(fmt.Sprintf(" (%s)", l.FormatCount(item.Count)))
+		}
+		
 		sb.WriteString("\n")
+		
+		for _, a := range item.Annotations {
+			
+			for i := 0; i <= item.Depth; i += 1 {
+				sb.WriteString("  ")
+			}
+			
+			sb.WriteString(fmt.Sprintf("# <%s>", a.Time.Format(time.RFC3339)))
+			if a.Author != "" {
+				sb.WriteString(fmt.Sprintf(" %s", a.Author))
+			}
+			sb.WriteString(fmt.Sprintf(": %s\n", a.Text))
+		}
 	}
 	
 	return sb.String()
 }
 
-func rflat(rs *State, depth int) []*FlatState {
+func rflat(rs *State, depth int, path string) []*FlatState {
 	
 	list := []*FlatState{}
 	
 	list = append(list, &FlatState{
 		Depth: depth,
+		Path: path,
 		Level: rs.Level,
 		Source: rs.Source,
 		Message: rs.Message,
 		Datetime: rs.Datetime,
+		RunbookURL: rs.RunbookURL,
+		Count: rs.Count,
+		FirstSeen: rs.FirstSeen,
+		LastSeen: rs.LastSeen,
+		CausedBy: rs.CausedBy,
+		SLA: rs.SLA,
+		Annotations: rs.Annotations,
 	})
 	
-	if rs.Tree != nil {
+	if rs.Tree != nil && depth < MaxDepth {
 		
 		for _, rs_it := range rs.Tree {
 			
-			for _, rss := range rflat(rs_it, depth + 1) {
+			if rs_it == nil {
+				continue
+			}
+			
+			rs_it_path := rs_it.Source
+			if path != "" {
+				rs_it_path = path + "/" + rs_it.Source
+			}
+			
+			for _, rss := range rflat(rs_it, depth + 1, rs_it_path) {
 				
 				list = append(list, rss)
 			}
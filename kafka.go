@@ -0,0 +1,92 @@
+package jsonstate
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// produces a record to a Kafka topic (a nil value is a tombstone), implement it with the Kafka client of choice
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key []byte, value []byte) error
+}
+// sends every transition to TransitionsTopic, and the latest state of the source to StateTopic keyed by its source path (suitable for a compacted topic)
+// note: attach it to a Route of an Alerter to publish asynchronously and in order, and call PublishAll once to seed the state topic
+type KafkaNotifier struct {
+	Producer KafkaProducer
+	Registry *Registry // to look up the latest state of a source
+	StateTopic string // not published if empty
+	TransitionsTopic string // not published if empty
+}
+
+// constructor: publish the states of the registry to state_topic, and its transitions to transitions_topic
+func NewKafkaNotifier(producer KafkaProducer, r *Registry, state_topic string, transitions_topic string) *KafkaNotifier {
+	return &KafkaNotifier{
+		Producer: producer,
+		Registry: r,
+		StateTopic: state_topic,
+		TransitionsTopic: transitions_topic,
+	}
+}
+func (p *KafkaNotifier) Notify(ctx context.Context, n Notification) error {
+	
+	if p.TransitionsTopic != "" {
+		
+		value, err := json.Marshal(n.Transition)
+		if err != nil {
+			return err
+		}
+		
+		if err := p.Producer.Produce(ctx, p.TransitionsTopic, []byte(n.Path), value); err != nil {
+			return transportError("kafka", p.TransitionsTopic, err)
+		}
+	}
+	
+	if p.StateTopic == "" || p.Registry == nil {
+		return nil
+	}
+	
+	// the state may have changed (or been removed) since the transition, which is fine, as only the latest state per key matters
+	var value []byte
+	for _, item := range p.Registry.Snapshot().Flatten() {
+		if item.Path == n.Path {
+			
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			value = data
+			break
+		}
+	}
+	
+	if err := p.Producer.Produce(ctx, p.StateTopic, []byte(n.Path), value); err != nil {
+		return transportError("kafka", p.StateTopic, err)
+	}
+	
+	return nil
+}
+func (p *KafkaNotifier) String() string {
+	return "kafka " + strings.Trim(p.StateTopic + "," + p.TransitionsTopic, ",")
+}
+// publish the latest state of every source of the registry to StateTopic
+func (p *KafkaNotifier) PublishAll(ctx context.Context) error {
+	
+	if p.StateTopic == "" || p.Registry == nil {
+		return nil
+	}
+	
+	for _, item := range p.Registry.Snapshot().Flatten() {
+		
+		value, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		
+		if err := p.Producer.Produce(ctx, p.StateTopic, []byte(item.Path), value); err != nil {
+			return transportError("kafka", p.StateTopic, err)
+		}
+	}
+	
+	return nil
+}
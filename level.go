@@ -0,0 +1,103 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// a custom level, that applies from Level up to the next (custom or built-in) level
+type customLevel struct {
+	level int
+	name string
+}
+
+var (
+	levelsMu sync.RWMutex
+	customLevels []customLevel // sorted by level
+)
+
+// register a custom level name, which LevelString returns for levels from the given level up to the next registered or built-in level (e.g. RegisterLevel(350, "Degraded")), registering a built-in level renames it
+func RegisterLevel(level int, name string) {
+	
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	
+	i := sort.Search(len(customLevels), func(i int) bool {
+		return customLevels[i].level >= level
+	})
+	if i < len(customLevels) && customLevels[i].level == level {
+		customLevels[i].name = name
+		return
+	}
+	
+	customLevels = append(customLevels, customLevel{})
+	copy(customLevels[i + 1:], customLevels[i:])
+	customLevels[i] = customLevel{
+		level: level,
+		name: name,
+	}
+}
+// register custom levels from a JSON object of level to name, e.g. {"350": "Degraded", "450": "Impaired"}
+// note: negative levels and empty names are rejected with an error wrapping ErrInvalidLevel, and then no level is registered
+func LoadLevels(r io.Reader) error {
+	
+	levels := map[int]string{}
+	if err := json.NewDecoder(r).Decode(&levels); err != nil {
+		return err
+	}
+	
+	for level, name := range levels {
+		if level < StateUnknown {
+			return fmt.Errorf("%w: %d (%s)", ErrInvalidLevel, level, name)
+		}
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%w: %d without name", ErrInvalidLevel, level)
+		}
+	}
+	
+	for level, name := range levels {
+		RegisterLevel(level, name)
+	}
+	
+	return nil
+}
+// the level for a (built-in or custom) level name, case-insensitive, false if the name is unknown
+func LevelByName(name string) (int, bool) {
+	
+	levelsMu.RLock()
+	defer levelsMu.RUnlock()
+	
+	for _, custom := range customLevels {
+		if strings.EqualFold(custom.name, name) {
+			return custom.level, true
+		}
+	}
+	
+	for level := StateUnknown; level <= StatePanic; level += 100 {
+		if strings.EqualFold(builtinLevelString(level), name) {
+			return level, true
+		}
+	}
+	
+	return 0, false
+}
+
+// the custom level name that applies to level, if any, and the level at which it starts
+func customLevelString(level int) (string, int, bool) {
+	
+	levelsMu.RLock()
+	defer levelsMu.RUnlock()
+	
+	i := sort.Search(len(customLevels), func(i int) bool {
+		return customLevels[i].level > level
+	})
+	if i == 0 {
+		return "", 0, false
+	}
+	
+	return customLevels[i - 1].name, customLevels[i - 1].level, true
+}
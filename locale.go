@@ -0,0 +1,227 @@
+package jsonstate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// how the renderers (String, ColorString, Table and ToHTML) and the messages of the package (e.g. of SLA breaches and rate probes) write durations and numbers, registered by language with RegisterLocale and selected with SetLocale
+// note: numbers are formatted with the CLDR data of the language (see golang.org/x/text/message), e.g. "12,345.6" (en), "12\u00a0345,6" (nb) or "12.345,6" (de), while the units of durations are words of the locale
+type Locale struct {
+	Name string                        // language tag (BCP 47), e.g. "en" or "nb", which also matches tags like "nb-NO" or "nb_NO.UTF-8" (see LocaleByName)
+	Day, Hour, Minute, Second string   // format of an amount of a duration unit, e.g. "%dh" or "%d t"
+	Count string                        // format of the number of times a state was seen (see Count), e.g. "%s times"
+	Ago string                          // format of the time since a datetime, e.g. "%s ago"
+	tag language.Tag
+	printer *message.Printer
+}
+
+var (
+	localesMu sync.RWMutex
+	locales = map[string]*Locale{}
+	localeMatcher language.Matcher // of the tags of the locales, in the order of localeTags
+	localeTags []language.Tag
+	currentLocale *Locale
+)
+
+func init() {
+	
+	RegisterLocale(Locale{Name: "en", Day: "%dd", Hour: "%dh", Minute: "%dm", Second: "%ds", Count: "%s times", Ago: "%s ago"})
+	RegisterLocale(Locale{Name: "nb", Day: "%d d", Hour: "%d t", Minute: "%d min", Second: "%d s", Count: "%s ganger", Ago: "for %s siden"})
+	RegisterLocale(Locale{Name: "da", Day: "%d d", Hour: "%d t", Minute: "%d min", Second: "%d s", Count: "%s gange", Ago: "for %s siden"})
+	RegisterLocale(Locale{Name: "sv", Day: "%d d", Hour: "%d h", Minute: "%d min", Second: "%d s", Count: "%s gånger", Ago: "för %s sedan"})
+	RegisterLocale(Locale{Name: "de", Day: "%d T.", Hour: "%d Std.", Minute: "%d Min.", Second: "%d Sek.", Count: "%s-mal", Ago: "vor %s"})
+	RegisterLocale(Locale{Name: "fr", Day: "%d j", Hour: "%d h", Minute: "%d min", Second: "%d s", Count: "%s fois", Ago: "il y a %s"})
+	RegisterLocale(Locale{Name: "nl", Day: "%d d", Hour: "%d u", Minute: "%d min", Second: "%d s", Count: "%s keer", Ago: "%s geleden"})
+	
+	currentLocale = locales["en"]
+}
+
+// register a locale (replacing any locale with the same name), formats that are empty are taken from "en"
+func RegisterLocale(l Locale) {
+	
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	
+	if en := locales["en"]; en != nil {
+		
+		if l.Day == "" {
+			l.Day = en.Day
+		}
+		if l.Hour == "" {
+			l.Hour = en.Hour
+		}
+		if l.Minute == "" {
+			l.Minute = en.Minute
+		}
+		if l.Second == "" {
+			l.Second = en.Second
+		}
+		if l.Count == "" {
+			l.Count = en.Count
+		}
+		if l.Ago == "" {
+			l.Ago = en.Ago
+		}
+	}
+	
+	l.Name = strings.ToLower(l.Name)
+	l.tag = localeTag(l.Name)
+	l.printer = message.NewPrinter(l.tag)
+	
+	if _, ok := locales[l.Name]; !ok {
+		localeTags = append(localeTags, l.tag)
+		localeMatcher = language.NewMatcher(localeTags)
+	}
+	locales[l.Name] = &l
+	
+	if currentLocale != nil && currentLocale.Name == l.Name {
+		currentLocale = &l
+	}
+}
+// get a registered locale by name, or else the best match of the language tag (e.g. "nb-NO" or "nb_NO.UTF-8" for "nb", see language.Matcher)
+func LocaleByName(name string) (*Locale, bool) {
+	
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+	
+	name = strings.ToLower(name)
+	if l, ok := locales[name]; ok {
+		return l, true
+	}
+	
+	tag := localeTag(name)
+	if tag == language.Und {
+		return nil, false
+	}
+	
+	// e.g. "de-AT" for "de", but not "ja" for "en"
+	_, i, confidence := localeMatcher.Match(tag)
+	if confidence < language.High {
+		return nil, false
+	}
+	for _, l := range locales {
+		if l.tag == localeTags[i] {
+			return l, true
+		}
+	}
+	
+	return nil, false
+}
+// use a registered locale (see LocaleByName) for all renderers, "en" by default
+func SetLocale(name string) error {
+	
+	l, ok := LocaleByName(name)
+	if !ok {
+		return fmt.Errorf("jsonstate: unknown locale: %s", name)
+	}
+	
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	
+	currentLocale = l
+	
+	return nil
+}
+// the locale used by the renderers
+func CurrentLocale() *Locale {
+	
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+	
+	return currentLocale
+}
+
+// the language tag of a locale name or POSIX locale (e.g. "nb_NO.UTF-8"), language.Und if it is not valid
+func localeTag(name string) language.Tag {
+	
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "@")
+	
+	tag, err := language.Parse(strings.ReplaceAll(name, "_", "-"))
+	if err != nil {
+		return language.Und
+	}
+	
+	return tag
+}
+
+// the two largest units of a duration, rounded down to seconds, e.g. "2h 13m" (en) or "2 t 13 min" (nb)
+func (l *Locale) FormatDuration(d time.Duration) string {
+	
+	if d < 0 {
+		d = -d
+	}
+	
+	units := []struct {
+		size time.Duration
+		format string
+	}{
+		{24 * time.Hour, l.Day},
+		{time.Hour, l.Hour},
+		{time.Minute, l.Minute},
+		{time.Second, l.Second},
+	}
+	
+	parts := []string{}
+	for _, unit := range units {
+		
+		n := int(d / unit.size)
+		d -= time.Duration(n) * unit.size
+		
+		// the largest unit that is not zero, and the one after it (if not zero either)
+		if n > 0 && len(parts) < 2 {
+			parts = append(parts, fmt.Sprintf(unit.format, n))
+		} else if len(parts) > 0 {
+			break
+		}
+	}
+	
+	if len(parts) == 0 {
+		return fmt.Sprintf(l.Second, 0)
+	}
+	
+	return strings.Join(parts, " ")
+}
+// an integer with the thousands separators of the language, e.g. "12,345" (en) or "12\u00a0345" (nb)
+func (l *Locale) FormatInt(n int) string {
+	return l.numbers().Sprintf("%d", n)
+}
+// a number rounded to at most decimals digits after the decimal separator, with the separators of the language, e.g. "12,345.67" (en) or "12.345,67" (de)
+func (l *Locale) FormatNumber(value float64, decimals int) string {
+	return l.numbers().Sprint(number.Decimal(value, number.MaxFractionDigits(decimals)))
+}
+// the printer of the language, also for a locale that was not registered
+func (l *Locale) numbers() *message.Printer {
+	
+	if l.printer == nil {
+		return message.NewPrinter(localeTag(l.Name))
+	}
+	
+	return l.printer
+}
+// the number of times a state was seen, e.g. "1,234 times" (en)
+func (l *Locale) FormatCount(count int) string {
+	return fmt.Sprintf(l.Count, l.FormatInt(count))
+}
+// the time since an RFC3339 datetime, e.g. "2h 13m ago" (en), or "" if the datetime is not valid
+func (l *Locale) FormatAge(datetime string, now time.Time) string {
+	
+	t, err := time.Parse(time.RFC3339, datetime)
+	if err != nil {
+		return ""
+	}
+	
+	d := now.Sub(t)
+	if d < 0 {
+		d = 0
+	}
+	
+	return fmt.Sprintf(l.Ago, l.FormatDuration(d))
+}
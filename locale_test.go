@@ -0,0 +1,66 @@
+package jsonstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocaleByName(t *testing.T) {
+	
+	for name, want := range map[string]string{
+		"nb": "nb",
+		"NB": "nb",
+		"nb-NO": "nb",
+		"nb_NO.UTF-8": "nb",
+		"no": "nb",
+		"de-AT": "de",
+		"en-US": "en",
+		"fr_CA": "fr",
+	} {
+		l, ok := LocaleByName(name)
+		if !ok || l.Name != want {
+			t.Errorf("LocaleByName(%q) = %v, %v, want %s", name, l, ok, want)
+		}
+	}
+	
+	for _, name := range []string{"ja", "xx", "", "not a tag"} {
+		if l, ok := LocaleByName(name); ok {
+			t.Errorf("LocaleByName(%q) = %s", name, l.Name)
+		}
+	}
+}
+func TestLocaleFormat(t *testing.T) {
+	
+	for name, want := range map[string][3]string{
+		"en": {"1,234,567", "-1,234.57", "2h 13m"},
+		"nb": {"1\u00a0234\u00a0567", "\u22121\u00a0234,57", "2 t 13 min"},
+		"de": {"1.234.567", "-1.234,57", "2 Std. 13 Min."},
+	} {
+		
+		l, _ := LocaleByName(name)
+		got := [3]string{l.FormatInt(1234567), l.FormatNumber(-1234.567, 2), l.FormatDuration(2 * time.Hour + 13 * time.Minute + 5 * time.Second)}
+		if got != want {
+			t.Errorf("%s: %q, want %q", name, got, want)
+		}
+	}
+	
+	if got := (&Locale{Name: "nl", Count: "%s keer"}).FormatCount(12345); got != "12.345 keer" {
+		t.Errorf("unregistered locale: %q", got)
+	}
+}
+func TestLocaleMessages(t *testing.T) {
+	
+	defer SetLocale("en")
+	if err := SetLocale("de-DE"); err != nil {
+		t.Fatal(err)
+	}
+	
+	breaches := SLABreaches("sla", []*Availability{{Path: "db", Availability: 99.5, Breach: true, SLA: &SLA{Target: 99.95}}})
+	if message := breaches.Tree[0].Message; message != "availability 99,5% is below the SLA target of 99,95%" {
+		t.Errorf("SLA message: %q", message)
+	}
+	
+	if got := formatRate(12345.678); got != "12.345,68" {
+		t.Errorf("rate: %q", got)
+	}
+}
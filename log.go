@@ -0,0 +1,50 @@
+package jsonstate
+
+import (
+	"context"
+	"log/slog"
+)
+
+// map a State level to the closest slog level
+func LogLevel(level int) slog.Level {
+	
+	if level < StateAttention {
+		
+		return slog.LevelInfo
+		
+	} else if level < StateError {
+		
+		return slog.LevelWarn
+		
+	} else {
+		
+		return slog.LevelError
+		
+	}
+}
+// option: emit a structured log record for every transition, at the log level corresponding to the new level (nil uses slog.Default())
+func (r *Registry) LogTransitions(logger *slog.Logger) *Registry {
+	
+	if logger == nil {
+		logger = slog.Default()
+	}
+	
+	return r.OnTransition(func(t Transition) {
+		
+		attrs := []slog.Attr{
+			slog.String("path", t.Path),
+			slog.Int("level", t.To),
+			slog.String("level_name", LevelString(t.To)),
+			slog.Int("previous_level", t.From),
+			slog.String("previous_level_name", LevelString(t.From)),
+		}
+		if t.Duration > 0 {
+			attrs = append(attrs, slog.Duration("duration", t.Duration))
+		}
+		if t.Message != "" {
+			attrs = append(attrs, slog.String("message", t.Message))
+		}
+		
+		logger.LogAttrs(context.Background(), LogLevel(t.To), "state transition", attrs...)
+	})
+}
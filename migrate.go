@@ -0,0 +1,305 @@
+package jsonstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// the schema version of the JSON documents (a tree or a flat list, see Flatten) written by this library
+//   1: level, source, message, datetime, tree and override
+//   2: runbook_url, count, first_seen and last_seen (see Set)
+//   3: caused_by, sla, annotations, mode and keep_message
+//   4: path and parent of the entries of a flat list
+const SchemaVersion = 4
+
+// a step from the previous schema version to version, on a decoded document (a tree map, or a list of flat maps)
+type migration struct {
+	version int
+	fields []string // fields that were added in this version, removed when migrating down
+	up func(doc any, flat bool)
+}
+
+var migrations = []migration{
+	{
+		version: 2,
+		fields: []string{"runbook_url", "count", "first_seen", "last_seen"},
+		// the runbook is attached by ApplyRunbooks, and how often a state had problems is unknown, so these stay empty (a document without them is also detected as version 1, see DetectVersion, so that inventing a count would change documents of the current version that Parse reads)
+	},
+	{
+		version: 3,
+		fields: []string{"caused_by", "sla", "annotations", "mode", "keep_message"},
+		// caused_by is recomputed by AggregateLevels, and the other fields default to what version 2 did
+	},
+	{
+		version: 4,
+		fields: []string{"path", "parent"},
+		up: func(doc any, flat bool) {
+			
+			if !flat {
+				return
+			}
+			
+			// derive the path and parent of every entry from the depth, like FromFlat
+			list := doc.([]any)
+			
+			// stack[i] is the index of the last entry at depth i
+			stack := []int{}
+			for i, v := range list {
+				
+				item, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				
+				depth := documentInt(item["depth"])
+				if i == 0 || depth < 1 {
+					depth = 0
+				} else if depth > len(stack) {
+					depth = len(stack)
+				}
+				item["depth"] = depth
+				
+				if _, ok := item["parent"]; ok {
+					stack = append(stack[:depth], i)
+					continue
+				}
+				
+				item["parent"] = -1
+				path := ""
+				if depth > 0 {
+					
+					parent := list[stack[depth - 1]].(map[string]any)
+					item["parent"] = stack[depth - 1]
+					
+					path, _ = item["source"].(string)
+					if parent_path, _ := parent["path"].(string); parent_path != "" {
+						path = parent_path + "/" + path
+					}
+				}
+				if path != "" {
+					item["path"] = path
+				}
+				
+				stack = append(stack[:depth], i)
+			}
+		},
+	},
+}
+
+// convert a JSON document (a tree, or a flat list as returned by Flatten) from one schema version to another (see SchemaVersion)
+// note: migrating down removes the fields that the older version does not know, so that older libraries (e.g. of remote modules) read the document as they wrote it
+func Migrate(doc []byte, fromVersion, toVersion int) ([]byte, error) {
+	
+	if fromVersion < 1 || fromVersion > SchemaVersion {
+		return nil, fmt.Errorf("jsonstate: unsupported schema version: %d", fromVersion)
+	}
+	if toVersion < 1 || toVersion > SchemaVersion {
+		return nil, fmt.Errorf("jsonstate: unsupported schema version: %d", toVersion)
+	}
+	if fromVersion == toVersion {
+		return doc, nil
+	}
+	
+	v, flat, err := decodeDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+	
+	for _, m := range migrations {
+		
+		if fromVersion < m.version && m.version <= toVersion && m.up != nil {
+			m.up(v, flat)
+		}
+		
+		if toVersion < m.version && m.version <= fromVersion {
+			eachDocumentState(v, flat, func(item map[string]any, leaf bool) {
+				for _, field := range m.fields {
+					delete(item, field)
+				}
+			})
+		}
+	}
+	
+	return json.Marshal(v)
+}
+// the oldest schema version in which a JSON document (a tree, or a flat list) is valid, which is the version of the newest fields it uses
+// note: a document without any of the later fields is valid in version 1, and migrates from there without changes
+func DetectVersion(doc []byte) (int, error) {
+	
+	v, flat, err := decodeDocument(doc)
+	if err != nil {
+		return 0, err
+	}
+	
+	version := 1
+	eachDocumentState(v, flat, func(item map[string]any, leaf bool) {
+		for _, m := range migrations {
+			
+			if m.version <= version {
+				continue
+			}
+			for _, field := range m.fields {
+				if _, ok := item[field]; ok {
+					version = m.version
+					break
+				}
+			}
+		}
+	})
+	
+	return version, nil
+}
+// constructor: read a JSON document (a tree, or a flat list as returned by Flatten) of any schema version (see DetectVersion and Migrate)
+// note: a malformed tree (see CheckTree) is rejected with an error wrapping ErrMalformedTree
+func Parse(data []byte) (*State, error) {
+	
+	version, err := DetectVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	
+	if version < SchemaVersion {
+		data, err = Migrate(data, version, SchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	s := &State{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		
+		list := []*FlatState{}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+		
+		s, err = fromFlatList(list)
+		if err != nil {
+			return nil, err
+		}
+		
+	} else if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	
+	// e.g. "tree": [null], or a path of a flat entry that is too deep
+	if err := s.CheckTree(); err != nil {
+		return nil, err
+	}
+	checkInvariants("Parse", s)
+	
+	return s, nil
+}
+
+// the tree as the original minimal JSON (level, source, message, datetime and tree), for consumers that are pinned to that format
+// note: unlike Migrate(doc, SchemaVersion, 1), this also strips override
+func (s *State) MarshalLegacy() ([]byte, error) {
+	return json.Marshal(toLegacy(s, 0))
+}
+
+type legacyState struct {
+	Level int              `json:"level"`
+	Source string          `json:"source,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Datetime string        `json:"datetime,omitempty"`
+	Tree []*legacyState    `json:"tree,omitempty"`
+}
+
+func toLegacy(s *State, depth int) *legacyState {
+	
+	ls := &legacyState{
+		Level: s.Level,
+		Source: s.Source,
+		Message: s.Message,
+		Datetime: s.Datetime,
+	}
+	for _, s_it := range s.Tree {
+		if s_it != nil && depth < MaxDepth {
+			ls.Tree = append(ls.Tree, toLegacy(s_it, depth + 1))
+		}
+	}
+	
+	return ls
+}
+
+// decode a tree (an object) or a flat list (an array of objects), keeping numbers as they are
+func decodeDocument(doc []byte) (any, bool, error) {
+	
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+	
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, false, err
+	}
+	
+	switch v.(type) {
+	case map[string]any:
+		return v, false, nil
+	case []any:
+		return v, true, nil
+	}
+	
+	return nil, false, errors.New("jsonstate: expected a JSON object or array of states")
+}
+// call fn for every state of a decoded document, with whether the state is a leaf (has no tree)
+func eachDocumentState(doc any, flat bool, fn func(item map[string]any, leaf bool)) {
+	
+	if !flat {
+		eachDocumentTree(doc, fn)
+		return
+	}
+	
+	list := doc.([]any)
+	for i, v := range list {
+		
+		item, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		
+		leaf := true
+		if i + 1 < len(list) {
+			if next, ok := list[i + 1].(map[string]any); ok {
+				leaf = documentInt(next["depth"]) <= documentInt(item["depth"])
+			}
+		}
+		
+		fn(item, leaf)
+	}
+}
+func eachDocumentTree(v any, fn func(item map[string]any, leaf bool)) {
+	
+	item, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	
+	tree, _ := item["tree"].([]any)
+	fn(item, len(tree) == 0)
+	
+	for _, v_it := range tree {
+		eachDocumentTree(v_it, fn)
+	}
+}
+// an integer field of a decoded document (0 if missing or not a number)
+func documentInt(v any) int {
+	
+	switch n := v.(type) {
+	case json.Number:
+		
+		if i, err := n.Int64(); err == nil {
+			return int(i)
+		}
+		if f, err := n.Float64(); err == nil {
+			return int(f)
+		}
+		
+	case int:
+		return n
+	}
+	
+	return 0
+}
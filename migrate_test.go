@@ -0,0 +1,95 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	
+	leaf := New("db")
+	leaf.Level = StateError
+	leaf.Datetime = "2024-01-02T03:04:05Z"
+	
+	tree := FromMap(map[string]int{"web/1": StateOk, "web/2": StateError, "db": StateFault})
+	
+	for _, s := range []*State{leaf, tree} {
+		
+		data, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		parsed, err := Parse(data)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", data, err)
+		}
+		if got, _ := json.Marshal(parsed); string(got) != string(data) {
+			t.Errorf("tree round trip:\ngot  %s\nwant %s", got, data)
+		}
+		
+		flat, err := json.Marshal(s.Flatten())
+		if err != nil {
+			t.Fatal(err)
+		}
+		
+		parsed, err = Parse(flat)
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", flat, err)
+		}
+		if got, _ := json.Marshal(parsed); string(got) != string(data) {
+			t.Errorf("flat round trip:\ngot  %s\nwant %s", got, data)
+		}
+	}
+}
+func TestMigrate(t *testing.T) {
+	
+	v1 := `{"level":400,"source":"db","datetime":"2024-01-02T03:04:05Z"}`
+	if version, err := DetectVersion([]byte(v1)); err != nil || version != 1 {
+		t.Errorf("DetectVersion = %d, %v", version, err)
+	}
+	
+	up, err := Migrate([]byte(v1), 1, SchemaVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(up), "count") {
+		t.Errorf("migrating up invented a count: %s", up)
+	}
+	
+	v4 := `[{"level":400,"source":"root","depth":0,"parent":-1,"count":2},{"level":400,"source":"db","depth":1,"path":"db","parent":0,"caused_by":"db"}]`
+	down, err := Migrate([]byte(v4), 4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(down); got != `[{"depth":0,"level":400,"source":"root"},{"depth":1,"level":400,"source":"db"}]` {
+		t.Errorf("migrating down: %s", got)
+	}
+	
+	// the path and parent of an older flat list are derived from the depth
+	up, err = Migrate(down, 1, SchemaVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(up); got != `[{"depth":0,"level":400,"parent":-1,"source":"root"},{"depth":1,"level":400,"parent":0,"path":"db","source":"db"}]` {
+		t.Errorf("migrating up: %s", got)
+	}
+	
+	// the runbook was added after the original format
+	v2 := `{"level":400,"source":"db","override":true,"runbook_url":"https://wiki/db"}`
+	if version, err := DetectVersion([]byte(v2)); err != nil || version != 2 {
+		t.Errorf("DetectVersion = %d, %v", version, err)
+	}
+	down, err = Migrate([]byte(v2), 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(down); got != `{"level":400,"override":true,"source":"db"}` {
+		t.Errorf("migrating down: %s", got)
+	}
+	
+	if _, err := Migrate([]byte(v1), 0, SchemaVersion); err == nil {
+		t.Error("migrated from version 0")
+	}
+}
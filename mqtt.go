@@ -0,0 +1,172 @@
+package jsonstate
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// publishes the encoded tree to an MQTT broker (MQTT 3.1.1, QoS 0), with a connection per Publish
+// note: this is meant for a report every few seconds or minutes, it is not an MQTT client library
+type MQTTReporter struct {
+	URL string // mqtt://[user:password@]host[:port] (port 1883), or mqtts:// for TLS (port 8883)
+	Topic string
+	Retain bool
+	ClientID string // "jsonstate-<hostname>-<pid>" if empty
+	Codec Codec // JSON if nil
+	TLSConfig *tls.Config // for mqtts://
+}
+
+func (rep *MQTTReporter) Publish(ctx context.Context, s *State) error {
+	
+	if rep.Topic == "" {
+		return errors.New("jsonstate: mqtt: no topic")
+	}
+	
+	payload, err := reporterCodec(rep.Codec).Marshal(s)
+	if err != nil {
+		return err
+	}
+	
+	u, err := url.Parse(rep.URL)
+	if err != nil {
+		return err
+	}
+	
+	conn, err := rep.dial(ctx, u)
+	if err != nil {
+		return transportError("mqtt", u.Host, err)
+	}
+	defer conn.Close()
+	
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(NotifyTimeout))
+	}
+	
+	client_id := rep.ClientID
+	if client_id == "" {
+		hostname, _ := os.Hostname()
+		client_id = "jsonstate-" + hostname + "-" + strconv.Itoa(os.Getpid())
+	}
+	
+	// CONNECT with a clean session
+	var connect []byte
+	connect = appendMQTTString(connect, "MQTT")
+	connect = append(connect, 4) // protocol level 3.1.1
+	flags := byte(0x02)
+	if u.User != nil {
+		flags |= 0x80
+		if _, ok := u.User.Password(); ok {
+			flags |= 0x40
+		}
+	}
+	connect = append(connect, flags, 0, 60) // keep alive of 60 seconds
+	connect = appendMQTTString(connect, client_id)
+	if u.User != nil {
+		connect = appendMQTTString(connect, u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			connect = appendMQTTString(connect, password)
+		}
+	}
+	
+	w := bufio.NewWriter(conn)
+	writeMQTTPacket(w, 0x10, connect)
+	if err := w.Flush(); err != nil {
+		return transportError("mqtt", u.Host, err)
+	}
+	
+	// CONNACK
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return transportError("mqtt", u.Host, err)
+	}
+	if connack[0] != 0x20 || connack[1] != 2 {
+		return transportError("mqtt", u.Host, errors.New("unexpected response to connect"))
+	}
+	if connack[3] != 0 {
+		return transportError("mqtt", u.Host, fmt.Errorf("connection refused (return code %d)", connack[3]))
+	}
+	
+	// PUBLISH at QoS 0, and DISCONNECT
+	publish := appendMQTTString(nil, rep.Topic)
+	publish = append(publish, payload...)
+	
+	header := byte(0x30)
+	if rep.Retain {
+		header |= 0x01
+	}
+	writeMQTTPacket(w, header, publish)
+	writeMQTTPacket(w, 0xe0, nil)
+	
+	if err := w.Flush(); err != nil {
+		return transportError("mqtt", u.Host, err)
+	}
+	
+	return nil
+}
+
+func (rep *MQTTReporter) dial(ctx context.Context, u *url.URL) (net.Conn, error) {
+	
+	host := u.Host
+	dialer := &net.Dialer{}
+	
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+		return dialer.DialContext(ctx, "tcp", host)
+		
+	case "mqtts", "ssl", "tls":
+		
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		
+		config := rep.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: u.Hostname()}
+		}
+		tls_dialer := &tls.Dialer{NetDialer: dialer, Config: config}
+		return tls_dialer.DialContext(ctx, "tcp", host)
+	}
+	
+	return nil, fmt.Errorf("unsupported scheme: %q", u.Scheme)
+}
+
+// fixed header with the remaining length, followed by the rest of the packet
+func writeMQTTPacket(w *bufio.Writer, header byte, data []byte) {
+	
+	w.WriteByte(header)
+	
+	length := len(data)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		w.WriteByte(b)
+		if length == 0 {
+			break
+		}
+	}
+	
+	w.Write(data)
+}
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
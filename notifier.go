@@ -0,0 +1,137 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// maximum time a built-in notifier may take for a single notification (notifications are delivered one at a time)
+var NotifyTimeout = 30 * time.Second
+
+// posts the notification as JSON to URL, any 2xx response is a success
+type WebhookNotifier struct {
+	URL string
+	Header http.Header // additional request headers (e.g. Authorization)
+	Client *http.Client // http.DefaultClient if nil
+	CloudEvents bool // post the transition as CloudEvent (see Transition.ToCloudEvent) instead of the notification
+}
+// runs a command for every notification, with the notification as JSON on stdin, and in the environment:
+// JSONSTATE_PATH, JSONSTATE_FROM, JSONSTATE_TO, JSONSTATE_LEVEL, JSONSTATE_LEVEL_NAME, JSONSTATE_MESSAGE, JSONSTATE_ROUTE and JSONSTATE_RUNBOOK_URL
+type ExecNotifier struct {
+	Name string
+	Args []string
+	Dir string // working directory, the current directory if empty
+}
+
+// constructor: a webhook notifier for the given URL
+func Webhook(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL: url,
+	}
+}
+func (wh *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	
+	content_type := "application/json"
+	
+	var v any = n
+	if wh.CloudEvents {
+		
+		e, err := n.Transition.ToCloudEvent()
+		if err != nil {
+			return err
+		}
+		
+		v = e
+		content_type = "application/cloudevents+json"
+	}
+	
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	
+	ctx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+	defer cancel()
+	
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range wh.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", content_type)
+	
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return transportError("webhook", wh.URL, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1 << 16)) // allow reuse of the connection
+	
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusError("webhook", wh.URL, res.StatusCode, res.Status, nil)
+	}
+	
+	return nil
+}
+func (wh *WebhookNotifier) String() string {
+	return "webhook " + wh.URL
+}
+
+// constructor: an exec notifier for the given command
+func Exec(name string, args ...string) *ExecNotifier {
+	return &ExecNotifier{
+		Name: name,
+		Args: args,
+	}
+}
+func (e *ExecNotifier) Notify(ctx context.Context, n Notification) error {
+	
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	
+	ctx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+	defer cancel()
+	
+	cmd := exec.CommandContext(ctx, e.Name, e.Args...)
+	cmd.Dir = e.Dir
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"JSONSTATE_PATH=" + n.Path,
+		"JSONSTATE_FROM=" + strconv.Itoa(n.From),
+		"JSONSTATE_TO=" + strconv.Itoa(n.To),
+		"JSONSTATE_LEVEL=" + strconv.Itoa(n.Level),
+		"JSONSTATE_LEVEL_NAME=" + LevelString(n.Level),
+		"JSONSTATE_MESSAGE=" + n.Message,
+		"JSONSTATE_ROUTE=" + n.Route,
+		"JSONSTATE_RUNBOOK_URL=" + n.RunbookURL,
+	)
+	
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if len(output) > 0 {
+			return fmt.Errorf("jsonstate: exec %s: %w: %s", e.Name, err, bytes.TrimSpace(output))
+		}
+		return fmt.Errorf("jsonstate: exec %s: %w", e.Name, err)
+	}
+	
+	return nil
+}
+func (e *ExecNotifier) String() string {
+	return "exec " + e.Name
+}
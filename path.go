@@ -0,0 +1,71 @@
+package jsonstate
+
+import (
+	"path"
+	"strings"
+)
+
+// note: a source path is the list of Source values from (but excluding) some State down to one of the states in its recursive tree, joined with "/" when it is a string
+
+// split a source path on "/" (empty elements are ignored, so "db/replica1", "/db/replica1" and "db//replica1" are the same)
+func SplitPath(path string) []string {
+	
+	source_path := []string{}
+	for _, source := range strings.Split(path, "/") {
+		if source != "" {
+			source_path = append(source_path, source)
+		}
+	}
+	
+	return source_path
+}
+// match a source path against a glob pattern, each element is matched with path.Match, and "**" matches any number of elements (e.g. "db/*", "**/replica1")
+func MatchPath(pattern string, source_path string) bool {
+	return matchPath(SplitPath(pattern), SplitPath(source_path))
+}
+
+func matchPath(pattern []string, source_path []string) bool {
+	
+	for len(pattern) > 0 {
+		
+		if pattern[0] == "**" {
+			
+			// try to let ** consume 0, 1, ..., N elements
+			for i := 0; i <= len(source_path); i += 1 {
+				if matchPath(pattern[1:], source_path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		
+		if len(source_path) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], source_path[0]); err != nil || !ok {
+			return false
+		}
+		
+		pattern = pattern[1:]
+		source_path = source_path[1:]
+	}
+	
+	return len(source_path) == 0
+}
+// call fn for every State in the recursive tree (depth-first, including s itself with an empty source path), stop descending into a tree if fn returns false
+func (s *State) Walk(fn func(source_path []string, s *State) bool) {
+	rwalk(s, []string{}, fn)
+}
+
+func rwalk(rs *State, source_path []string, fn func([]string, *State) bool) {
+	
+	if !fn(source_path, rs) || len(source_path) >= MaxDepth {
+		return
+	}
+	
+	for _, rs_it := range rs.Tree {
+		if rs_it != nil {
+			rwalk(rs_it, append(source_path[:len(source_path):len(source_path)], rs_it.Source), fn)
+		}
+	}
+}
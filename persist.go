@@ -0,0 +1,247 @@
+package jsonstate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// periodically saves a snapshot to a file, keeping the last Keep snapshots as path.1 (most recent) up to path.<Keep>
+// note: attach it with r.PurgeWith(saver), so that PurgeHistory and PurgeSource also remove the annotations from the saved (and rotated) snapshots
+type PeriodicSaver struct {
+	Snapshot func() *State
+	Path string
+	Interval time.Duration
+	Keep int
+	OnError func(error) // called for failed saves of Run, which keeps saving, as the storage may recover (logged with slog by default)
+	mu sync.Mutex // saving and purging the files
+}
+
+// write the tree to a file atomically (a temporary file in the same directory is renamed), gzip-compressed if path ends with ".gz"
+// note: the format is that of the codec registered for the file extension (e.g. ".proto", see RegisterCodec), or JSON
+// note: failures to write are a *StorageError
+func (s *State) SaveFile(path string) error {
+	return s.saveFile(path, path)
+}
+// write the tree to path in the format of format_path (see SaveFile), e.g. of "state.json.gz" for its rotation "state.json.gz.1"
+func (s *State) saveFile(path string, format_path string) error {
+	
+	var buf bytes.Buffer
+	
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if strings.HasSuffix(format_path, ".gz") {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	
+	if name, codec, ok := CodecForFile(format_path); ok && name != "json" {
+		
+		data, err := codec.Marshal(s)
+		if err != nil {
+			return storageError("save", path, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return storageError("save", path, err)
+		}
+		
+	} else if err := json.NewEncoder(w).Encode(s); err != nil {
+		return storageError("save", path, err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return storageError("save", path, err)
+		}
+	}
+	
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return storageError("save", path, err)
+	}
+	
+	return nil
+}
+// read a tree from a file written by SaveFile (or any state JSON document), gzip-compressed files are detected automatically, and the format by the file extension like SaveFile
+// note: any failure is a *StorageError, e.g. errors.Is(err, fs.ErrNotExist) when there is no snapshot yet
+func LoadFile(path string) (*State, error) {
+	return loadFile(path, path)
+}
+// read a tree from path in the format of format_path (see LoadFile)
+func loadFile(path string, format_path string) (*State, error) {
+	
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, storageError("load", path, err)
+	}
+	defer f.Close()
+	
+	br := bufio.NewReader(f)
+	
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, storageError("load", path, err)
+		}
+		defer gz.Close()
+		
+		r = gz
+	}
+	
+	if name, codec, ok := CodecForFile(format_path); ok && name != "json" {
+		
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, storageError("load", path, err)
+		}
+		
+		s, err := codec.Unmarshal(data)
+		if err != nil {
+			return nil, storageError("load", path, err)
+		}
+		
+		return s, nil
+	}
+	
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, storageError("load", path, err)
+	}
+	
+	// snapshots of older versions are migrated (see Parse)
+	s, err := Parse(data)
+	if err != nil {
+		return nil, storageError("load", path, err)
+	}
+	
+	return s, nil
+}
+
+// constructor: e.g. NewPeriodicSaver(registry.Snapshot, "/var/lib/<module>/state.json.gz", 30 * time.Second, 5)
+func NewPeriodicSaver(snapshot func() *State, path string, interval time.Duration, keep int) *PeriodicSaver {
+	return &PeriodicSaver{
+		Snapshot: snapshot,
+		Path: path,
+		Interval: interval,
+		Keep: keep,
+	}
+}
+// save a snapshot every Interval until ctx is done, and once more before returning (so that the last known state also survives a clean shutdown), returns the error of that last save
+func (p *PeriodicSaver) Run(ctx context.Context) error {
+	
+	if p.Interval <= 0 {
+		return fmt.Errorf("jsonstate: invalid save interval: %v", p.Interval)
+	}
+	
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ctx.Done():
+			return p.Save()
+		case <-ticker.C:
+			if err := p.Save(); err != nil {
+				p.error(err)
+			}
+		}
+	}
+}
+// rotate the previous snapshots, and save a new one
+func (p *PeriodicSaver) Save() error {
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if err := p.rotate(); err != nil {
+		return err
+	}
+	
+	return p.Snapshot().SaveFile(p.Path)
+}
+func (p *PeriodicSaver) error(err error) {
+	
+	if p.OnError != nil {
+		p.OnError(err)
+		return
+	}
+	
+	slog.Error("jsonstate: periodic save", slog.String("error", err.Error()))
+}
+
+// shift path.<i> to path.<i+1>, dropping the oldest, and link path to path.1 (path itself stays in place until it is atomically replaced)
+func (p *PeriodicSaver) rotate() error {
+	
+	if p.Keep <= 0 {
+		return nil
+	}
+	
+	if _, err := os.Stat(p.Path); os.IsNotExist(err) {
+		return nil // nothing to rotate yet
+	}
+	
+	for i := p.Keep - 1; i >= 1; i -= 1 {
+		if err := os.Rename(fmt.Sprintf("%s.%d", p.Path, i), fmt.Sprintf("%s.%d", p.Path, i + 1)); err != nil && !os.IsNotExist(err) {
+			return storageError("rotate", p.Path, err)
+		}
+	}
+	
+	first := p.Path + ".1"
+	os.Remove(first)
+	if err := os.Link(p.Path, first); err != nil {
+		
+		// hard links are not supported everywhere, then the file is briefly missing, which is still better than no rotation
+		if err := os.Rename(p.Path, first); err != nil {
+			return storageError("rotate", p.Path, err)
+		}
+	}
+	
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	
+	f, err := os.CreateTemp(filepath.Dir(path), "." + filepath.Base(path) + ".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	
+	// clean up the temporary file on any failure
+	ok := false
+	defer func() {
+		if !ok {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	
+	ok = true
+	return nil
+}
@@ -0,0 +1,74 @@
+package jsonstate
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeriodicSaverKeepsRunning(t *testing.T) {
+	
+	r := NewRegistry("")
+	r.Component("db").Set(StateOk, "")
+	
+	path := filepath.Join(t.TempDir(), "missing", "state.json")
+	saver := NewPeriodicSaver(r.Snapshot, path, time.Millisecond, 0)
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	failures := make(chan error, 16)
+	saver.OnError = func(err error) {
+		select {
+		case failures <- err:
+		default:
+		}
+	}
+	
+	done := make(chan error, 1)
+	go func() { done <- saver.Run(ctx) }()
+	
+	for i := 0; i < 3; i += 1 {
+		select {
+		case err := <-failures:
+			var storage_err *StorageError
+			if !errors.As(err, &storage_err) {
+				t.Errorf("failed save: %v", err)
+			}
+		case err := <-done:
+			t.Fatalf("Run returned after a failed save: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no failed saves reported")
+		}
+	}
+	
+	// the storage recovers
+	if err := os.Mkdir(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("last save: %v", err)
+	}
+	
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("no snapshot after recovery: %v", err)
+	}
+}
+func TestSaveFileEncodeError(t *testing.T) {
+	
+	s := &State{Level: StateOk, SLA: &SLA{Target: math.NaN()}}
+	for _, file := range []string{"state.json", "state.json.gz"} {
+		
+		err := s.SaveFile(filepath.Join(t.TempDir(), file))
+		var storage_err *StorageError
+		if !errors.As(err, &storage_err) || storage_err.Op != "save" {
+			t.Errorf("%s: %v is not a StorageError of save", file, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// a check of a component, the error (or nil) is mapped to a level with ErrorLevel, so a probe may return a LevelError to decide the level itself
+type Probe interface {
+	Check(ctx context.Context) error
+}
+// adapter to use a plain function as Probe
+type ProbeFunc func(ctx context.Context) error
+
+// configuration of a probe (see NewProbe), e.g. {"path": "web/frontend", "type": "http", "url": "http://localhost:8080/health", "interval": "30s"}
+type ProbeConfig struct {
+	Path string         `json:"path"` // source path of the component in the registry
+	Type string         `json:"type"` // "http", "tcp", "exec" or "gauge"
+	URL string          `json:"url,omitempty"` // http, gauge: responds with a number
+	Status int          `json:"status,omitempty"` // http: the expected status code, any 2xx status if zero
+	Address string      `json:"address,omitempty"` // tcp: host:port
+	Command []string    `json:"command,omitempty"` // exec: the program and its arguments, a non-zero exit status is an Error, gauge: prints a number (instead of url)
+	Name string         `json:"name,omitempty"` // gauge: what is sampled, e.g. "queue depth"
+	Rates []RateConfig  `json:"rates,omitempty"` // gauge: the rate-of-change rules (see RateProbe)
+	Interval string     `json:"interval,omitempty"` // time between checks (e.g. "30s"), the default interval of the scheduler if empty
+	Timeout string      `json:"timeout,omitempty"` // maximum duration of a check, the interval if empty
+}
+
+// checks that a GET request gets the expected status
+type HTTPProbe struct {
+	URL string
+	Status int // any 2xx status if zero
+	Client *http.Client // http.DefaultClient if nil
+}
+// checks that a TCP connection can be established
+type TCPProbe struct {
+	Address string
+}
+// runs a command, a non-zero exit status is an Error (with the output as message)
+type ExecProbe struct {
+	Name string
+	Args []string
+}
+
+func (fn ProbeFunc) Check(ctx context.Context) error {
+	return fn(ctx)
+}
+
+// constructor: create a probe from its configuration
+func NewProbe(config ProbeConfig) (Probe, error) {
+	
+	switch config.Type {
+	case "http":
+		
+		if config.URL == "" {
+			return nil, fmt.Errorf("jsonstate: probe %s: no url", config.Path)
+		}
+		
+		return &HTTPProbe{
+			URL: config.URL,
+			Status: config.Status,
+		}, nil
+		
+	case "tcp":
+		
+		if config.Address == "" {
+			return nil, fmt.Errorf("jsonstate: probe %s: no address", config.Path)
+		}
+		
+		return &TCPProbe{
+			Address: config.Address,
+		}, nil
+		
+	case "exec":
+		
+		if len(config.Command) == 0 {
+			return nil, fmt.Errorf("jsonstate: probe %s: no command", config.Path)
+		}
+		
+		return &ExecProbe{
+			Name: config.Command[0],
+			Args: config.Command[1:],
+		}, nil
+		
+	case "gauge":
+		
+		rules, err := newRateRules(config.Rates)
+		if err != nil {
+			return nil, fmt.Errorf("jsonstate: probe %s: %w", config.Path, err)
+		}
+		
+		var gauge Gauge
+		switch {
+		case config.URL != "":
+			gauge = &HTTPGauge{
+				URL: config.URL,
+			}
+		case len(config.Command) > 0:
+			gauge = &ExecGauge{
+				Name: config.Command[0],
+				Args: config.Command[1:],
+			}
+		default:
+			return nil, fmt.Errorf("jsonstate: probe %s: no url or command", config.Path)
+		}
+		
+		return NewRateProbe(config.Name, gauge, rules...), nil
+	}
+	
+	return nil, fmt.Errorf("jsonstate: probe %s: unknown type: %q", config.Path, config.Type)
+}
+
+func (p *HTTPProbe) Check(ctx context.Context) error {
+	
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1 << 16))
+	
+	if p.Status != 0 && res.StatusCode != p.Status {
+		return fmt.Errorf("%s: %s (expected %d)", p.URL, res.Status, p.Status)
+	}
+	if p.Status == 0 && (res.StatusCode < 200 || res.StatusCode > 299) {
+		return fmt.Errorf("%s: %s", p.URL, res.Status)
+	}
+	
+	return nil
+}
+func (p *TCPProbe) Check(ctx context.Context) error {
+	
+	dialer := &net.Dialer{}
+	
+	conn, err := dialer.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return err
+	}
+	
+	return conn.Close()
+}
+func (p *ExecProbe) Check(ctx context.Context) error {
+	
+	output, err := exec.CommandContext(ctx, p.Name, p.Args...).CombinedOutput()
+	if err != nil {
+		if output = bytes.TrimSpace(output); len(output) > 0 {
+			return fmt.Errorf("%s: %w: %s", p.Name, err, output)
+		}
+		return fmt.Errorf("%s: %w", p.Name, err)
+	}
+	
+	return nil
+}
+
+// parse an optional duration of a configuration
+func parseConfigDuration(value string, fallback time.Duration) (time.Duration, error) {
+	
+	if value == "" {
+		return fallback, nil
+	}
+	
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	
+	return d, nil
+}
@@ -0,0 +1,479 @@
+package jsonstate
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// protobuf wire format of the messages in jsonstate.proto, so that the Go structs are the single source of truth (no generated code, no dependencies)
+// note: the bytes are compatible with the generated code of jsonstate.proto in any language, but this package has no gRPC server: a StateService generated from jsonstate.proto only needs to wrap ToProto/FromProto, Snapshot and Watch
+
+// encode as a jsonstate.State message (including the tree)
+func (s *State) ToProto() ([]byte, error) {
+	return s.appendProto(nil, 0), nil
+}
+// decode a jsonstate.State message
+// note: a tree deeper than MaxDepth is rejected with an error wrapping ErrMalformedTree
+func FromProto(data []byte) (*State, error) {
+	
+	s := &State{}
+	if err := s.unmarshalProto(data, 0); err != nil {
+		return nil, err
+	}
+	checkInvariants("FromProto", s)
+	
+	return s, nil
+}
+// encode as a jsonstate.FlatState message
+func (f *FlatState) ToProto() ([]byte, error) {
+	return f.appendProto(nil), nil
+}
+// decode a jsonstate.FlatState message
+func FlatStateFromProto(data []byte) (*FlatState, error) {
+	
+	f := &FlatState{}
+	err := protoFields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			f.Depth = int(int32(v))
+		case 2:
+			f.Path = string(b)
+		case 3:
+			f.Level = int(int32(v))
+		case 4:
+			f.Source = string(b)
+		case 5:
+			f.Message = string(b)
+		case 6:
+			f.Datetime = string(b)
+		case 7:
+			f.Override = v != 0
+		case 8:
+			f.RunbookURL = string(b)
+		case 9:
+			f.Count = int(int32(v))
+		case 10:
+			f.FirstSeen = string(b)
+		case 11:
+			f.LastSeen = string(b)
+		case 12:
+			f.CausedBy = string(b)
+		case 13:
+			sla, err := slaFromProto(b)
+			if err != nil {
+				return err
+			}
+			f.SLA = sla
+		case 14:
+			a, err := annotationFromProto(b)
+			if err != nil {
+				return err
+			}
+			f.Annotations = append(f.Annotations, a)
+		case 15:
+			f.Parent = int(int32(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	return f, nil
+}
+// encode as a jsonstate.Transition message
+func (t Transition) ToProto() ([]byte, error) {
+	return t.appendProto(nil), nil
+}
+// decode a jsonstate.Transition message
+func TransitionFromProto(data []byte) (Transition, error) {
+	
+	t := Transition{}
+	err := protoFields(data, func(field int, v uint64, b []byte) error {
+		
+		var err error
+		switch field {
+		case 1:
+			t.ID = v
+		case 2:
+			t.Path = string(b)
+		case 3:
+			t.From = int(int32(v))
+		case 4:
+			t.To = int(int32(v))
+		case 5:
+			t.PreviousMessage = string(b)
+		case 6:
+			t.Message = string(b)
+		case 7:
+			t.Time, err = timestampFromProto(b)
+		case 8:
+			t.Duration, err = durationFromProto(b)
+		}
+		return err
+	})
+	
+	return t, err
+}
+
+// call fn with the transitions since last_id (0 for only new transitions) and the aggregated tree, and again whenever the tree changes, until ctx is done or fn returns an error (the WatchState RPC)
+// note: like StreamHandler, transitions that are no longer buffered are skipped, and with a ctx of AccessPolicy.Context only the readable part of the tree and its transitions are passed
+func (r *Registry) Watch(ctx context.Context, last_id uint64, fn func(id uint64, transitions []Transition, s *State) error) error {
+	
+	r.mu.RLock()
+	if last_id == 0 || last_id > r.seq {
+		last_id = r.seq
+	}
+	r.mu.RUnlock()
+	
+	for {
+		
+		r.mu.RLock()
+		changed := r.changed
+		transitions := r.transitionsSince(last_id)
+		snapshot := r.root.Clone()
+		seq := r.seq
+		r.mu.RUnlock()
+		
+		// see AccessPolicy.Context
+		readable := transitions[:0:0]
+		for _, t := range transitions {
+			if accessible(ctx, t.Path) {
+				readable = append(readable, t)
+			}
+		}
+		
+		if err := fn(seq, readable, restrictContext(ctx, prepareSnapshot(snapshot))); err != nil {
+			return err
+		}
+		
+		last_id = seq
+		
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (s *State) appendProto(b []byte, depth int) []byte {
+	
+	b = appendProtoInt(b, 1, s.Level)
+	b = appendProtoString(b, 2, s.Source)
+	b = appendProtoString(b, 3, s.Message)
+	b = appendProtoString(b, 4, s.Datetime)
+	for _, s_it := range s.Tree {
+		if s_it != nil && depth < MaxDepth {
+			b = appendProtoMessage(b, 5, s_it.appendProto(nil, depth + 1))
+		}
+	}
+	b = appendProtoBool(b, 6, s.Override)
+	b = appendProtoString(b, 7, s.RunbookURL)
+	b = appendProtoInt(b, 8, s.Count)
+	b = appendProtoString(b, 9, s.FirstSeen)
+	b = appendProtoString(b, 10, s.LastSeen)
+	b = appendProtoString(b, 11, s.CausedBy)
+	if s.SLA != nil {
+		b = appendProtoMessage(b, 12, s.SLA.appendProto(nil))
+	}
+	for _, a := range s.Annotations {
+		b = appendProtoMessage(b, 13, a.appendProto(nil))
+	}
+	b = appendProtoString(b, 14, s.Mode)
+	b = appendProtoBool(b, 15, s.KeepMessage)
+	
+	return b
+}
+func (s *State) unmarshalProto(data []byte, depth int) error {
+	return protoFields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			s.Level = int(int32(v))
+		case 2:
+			s.Source = string(b)
+		case 3:
+			s.Message = string(b)
+		case 4:
+			s.Datetime = string(b)
+		case 5:
+			if depth >= MaxDepth {
+				return fmt.Errorf("%w: deeper than %d", ErrMalformedTree, MaxDepth)
+			}
+			s_it := &State{}
+			if err := s_it.unmarshalProto(b, depth + 1); err != nil {
+				return err
+			}
+			s.Tree = append(s.Tree, s_it)
+		case 6:
+			s.Override = v != 0
+		case 7:
+			s.RunbookURL = string(b)
+		case 8:
+			s.Count = int(int32(v))
+		case 9:
+			s.FirstSeen = string(b)
+		case 10:
+			s.LastSeen = string(b)
+		case 11:
+			s.CausedBy = string(b)
+		case 12:
+			sla, err := slaFromProto(b)
+			if err != nil {
+				return err
+			}
+			s.SLA = sla
+		case 13:
+			a, err := annotationFromProto(b)
+			if err != nil {
+				return err
+			}
+			s.Annotations = append(s.Annotations, a)
+		case 14:
+			s.Mode = string(b)
+		case 15:
+			s.KeepMessage = v != 0
+		}
+		return nil
+	})
+}
+func (f *FlatState) appendProto(b []byte) []byte {
+	
+	b = appendProtoInt(b, 1, f.Depth)
+	b = appendProtoString(b, 2, f.Path)
+	b = appendProtoInt(b, 3, f.Level)
+	b = appendProtoString(b, 4, f.Source)
+	b = appendProtoString(b, 5, f.Message)
+	b = appendProtoString(b, 6, f.Datetime)
+	b = appendProtoBool(b, 7, f.Override)
+	b = appendProtoString(b, 8, f.RunbookURL)
+	b = appendProtoInt(b, 9, f.Count)
+	b = appendProtoString(b, 10, f.FirstSeen)
+	b = appendProtoString(b, 11, f.LastSeen)
+	b = appendProtoString(b, 12, f.CausedBy)
+	if f.SLA != nil {
+		b = appendProtoMessage(b, 13, f.SLA.appendProto(nil))
+	}
+	for _, a := range f.Annotations {
+		b = appendProtoMessage(b, 14, a.appendProto(nil))
+	}
+	b = appendProtoInt(b, 15, f.Parent)
+	
+	return b
+}
+func (t Transition) appendProto(b []byte) []byte {
+	
+	b = appendProtoVarint(b, 1, t.ID)
+	b = appendProtoString(b, 2, t.Path)
+	b = appendProtoInt(b, 3, t.From)
+	b = appendProtoInt(b, 4, t.To)
+	b = appendProtoString(b, 5, t.PreviousMessage)
+	b = appendProtoString(b, 6, t.Message)
+	if !t.Time.IsZero() {
+		b = appendProtoMessage(b, 7, appendProtoTimestamp(nil, t.Time))
+	}
+	if t.Duration != 0 {
+		b = appendProtoMessage(b, 8, appendProtoDuration(nil, t.Duration))
+	}
+	
+	return b
+}
+func (sla *SLA) appendProto(b []byte) []byte {
+	
+	if sla.Target != 0 {
+		b = appendProtoKey(b, 1, 1)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(sla.Target))
+	}
+	b = appendProtoString(b, 2, sla.Tier)
+	
+	return b
+}
+func slaFromProto(data []byte) (*SLA, error) {
+	
+	sla := &SLA{}
+	err := protoFields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			sla.Target = math.Float64frombits(v)
+		case 2:
+			sla.Tier = string(b)
+		}
+		return nil
+	})
+	
+	return sla, err
+}
+func (a Annotation) appendProto(b []byte) []byte {
+	
+	if !a.Time.IsZero() {
+		b = appendProtoMessage(b, 1, appendProtoTimestamp(nil, a.Time))
+	}
+	b = appendProtoString(b, 2, a.Author)
+	b = appendProtoString(b, 3, a.Text)
+	
+	return b
+}
+func annotationFromProto(data []byte) (Annotation, error) {
+	
+	a := Annotation{}
+	err := protoFields(data, func(field int, v uint64, b []byte) error {
+		
+		var err error
+		switch field {
+		case 1:
+			a.Time, err = timestampFromProto(b)
+		case 2:
+			a.Author = string(b)
+		case 3:
+			a.Text = string(b)
+		}
+		return err
+	})
+	
+	return a, err
+}
+
+// google.protobuf.Timestamp
+func appendProtoTimestamp(b []byte, t time.Time) []byte {
+	b = appendProtoVarint(b, 1, uint64(t.Unix()))
+	return appendProtoInt(b, 2, t.Nanosecond())
+}
+func timestampFromProto(data []byte) (time.Time, error) {
+	
+	var seconds, nanos int64
+	err := protoFields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			seconds = int64(v)
+		case 2:
+			nanos = int64(int32(v))
+		}
+		return nil
+	})
+	
+	return time.Unix(seconds, nanos).UTC(), err
+}
+// google.protobuf.Duration
+func appendProtoDuration(b []byte, d time.Duration) []byte {
+	b = appendProtoVarint(b, 1, uint64(int64(d / time.Second)))
+	return appendProtoInt(b, 2, int(d % time.Second))
+}
+func durationFromProto(data []byte) (time.Duration, error) {
+	
+	var seconds, nanos int64
+	err := protoFields(data, func(field int, v uint64, b []byte) error {
+		switch field {
+		case 1:
+			seconds = int64(v)
+		case 2:
+			nanos = int64(int32(v))
+		}
+		return nil
+	})
+	
+	return time.Duration(seconds) * time.Second + time.Duration(nanos), err
+}
+
+// note: proto3 does not encode default values, so the append functions skip zero values
+func appendProtoKey(b []byte, field int, wire_type int) []byte {
+	return binary.AppendUvarint(b, uint64(field) << 3 | uint64(wire_type))
+}
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	
+	if v == 0 {
+		return b
+	}
+	
+	b = appendProtoKey(b, field, 0)
+	return binary.AppendUvarint(b, v)
+}
+func appendProtoInt(b []byte, field int, v int) []byte {
+	return appendProtoVarint(b, field, uint64(int64(v))) // negative int32 values are sign-extended to 10 bytes
+}
+func appendProtoBool(b []byte, field int, v bool) []byte {
+	
+	if !v {
+		return b
+	}
+	
+	return appendProtoVarint(b, field, 1)
+}
+func appendProtoString(b []byte, field int, s string) []byte {
+	
+	if s == "" {
+		return b
+	}
+	
+	b = appendProtoKey(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+// note: embedded messages are always encoded (also when empty), as they may be elements of a repeated field
+func appendProtoMessage(b []byte, field int, data []byte) []byte {
+	b = appendProtoKey(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+var errProtoTruncated = errors.New("jsonstate: truncated protobuf message")
+
+// call fn for every field of the message, with v set for varint and fixed-size fields, and b set for length-delimited fields (unknown fields are to be ignored)
+func protoFields(data []byte, fn func(field int, v uint64, b []byte) error) error {
+	
+	for len(data) > 0 {
+		
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+		
+		field := int(key >> 3)
+		var v uint64
+		var b []byte
+		
+		switch key & 7 {
+		case 0:
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errProtoTruncated
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errProtoTruncated
+			}
+			v = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case 2:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data) - n) {
+				return errProtoTruncated
+			}
+			b = data[n:n + int(length)]
+			data = data[n + int(length):]
+		case 5:
+			if len(data) < 4 {
+				return errProtoTruncated
+			}
+			v = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("jsonstate: unsupported protobuf wire type %d of field %d", key & 7, field)
+		}
+		
+		if field == 0 {
+			return errors.New("jsonstate: invalid protobuf field number 0")
+		}
+		
+		if err := fn(field, v, b); err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
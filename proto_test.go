@@ -0,0 +1,199 @@
+package jsonstate
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// field numbers by message and field name in jsonstate.proto
+func protoSchema(t *testing.T) map[string]map[string]int {
+	
+	data, err := os.ReadFile("jsonstate.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	schema := map[string]map[string]int{}
+	for _, message := range regexp.MustCompile(`(?s)message (\w+) \{(.*?)\n\}`).FindAllStringSubmatch(string(data), -1) {
+		
+		fields := map[string]int{}
+		for _, field := range regexp.MustCompile(`(?m)^\s*(?:repeated\s+)?[\w.]+\s+(\w+)\s*=\s*(\d+);`).FindAllStringSubmatch(message[2], -1) {
+			fields[field[1]], _ = strconv.Atoi(field[2])
+		}
+		schema[message[1]] = fields
+	}
+	
+	return schema
+}
+// set a field to a value that is not the zero value
+func fillProtoField(v reflect.Value) {
+	
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64:
+		v.SetInt(7)
+	case reflect.Uint64:
+		v.SetUint(7)
+	case reflect.Float64:
+		v.SetFloat(99.9)
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		if v.Index(0).Kind() == reflect.Pointer {
+			fillProtoField(v.Index(0))
+		}
+	case reflect.Struct:
+		v.Set(reflect.ValueOf(time.Unix(1700000000, 0)))
+	}
+}
+
+func TestProtoSchema(t *testing.T) {
+	
+	schema := protoSchema(t)
+	
+	for message, encode := range map[string]func(v reflect.Value) []byte{
+		"State": func(v reflect.Value) []byte { b, _ := v.Addr().Interface().(*State).ToProto(); return b },
+		"FlatState": func(v reflect.Value) []byte { b, _ := v.Addr().Interface().(*FlatState).ToProto(); return b },
+		"Transition": func(v reflect.Value) []byte { b, _ := v.Interface().(Transition).ToProto(); return b },
+		"SLA": func(v reflect.Value) []byte { return v.Addr().Interface().(*SLA).appendProto(nil) },
+		"Annotation": func(v reflect.Value) []byte { return v.Interface().(Annotation).appendProto(nil) },
+	} {
+		
+		fields, ok := schema[message]
+		if !ok {
+			t.Errorf("jsonstate.proto has no message %s", message)
+			continue
+		}
+		
+		var typ reflect.Type
+		switch message {
+		case "State":
+			typ = reflect.TypeOf(State{})
+		case "FlatState":
+			typ = reflect.TypeOf(FlatState{})
+		case "Transition":
+			typ = reflect.TypeOf(Transition{})
+		case "SLA":
+			typ = reflect.TypeOf(SLA{})
+		case "Annotation":
+			typ = reflect.TypeOf(Annotation{})
+		}
+		
+		if typ.NumField() != len(fields) {
+			t.Errorf("%s has %d fields in Go and %d in jsonstate.proto", message, typ.NumField(), len(fields))
+		}
+		
+		// the field number that each Go field is encoded with must be the one of the proto field with its JSON name
+		for i := 0; i < typ.NumField(); i += 1 {
+			
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			number, ok := fields[name]
+			if !ok {
+				t.Errorf("%s.%s (%s) is not in jsonstate.proto", message, typ.Field(i).Name, name)
+				continue
+			}
+			
+			v := reflect.New(typ).Elem()
+			fillProtoField(v.Field(i))
+			
+			key, n := binary.Uvarint(encode(v))
+			if n <= 0 {
+				t.Errorf("%s.%s is not encoded", message, typ.Field(i).Name)
+				continue
+			}
+			if int(key >> 3) != number {
+				t.Errorf("%s.%s is encoded as field %d, jsonstate.proto has %d", message, typ.Field(i).Name, key >> 3, number)
+			}
+		}
+	}
+}
+func TestProtoRoundTrip(t *testing.T) {
+	
+	at := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	
+	s := &State{
+		Level: StateWarning,
+		Source: "app",
+		Message: "degraded",
+		Datetime: at.Format(time.RFC3339),
+		Count: 3,
+		FirstSeen: at.Format(time.RFC3339),
+		LastSeen: at.Format(time.RFC3339),
+		CausedBy: "db",
+		SLA: &SLA{Target: 99.9, Tier: "24/7"},
+		Annotations: []Annotation{{Time: at, Author: "alice", Text: "restarted primary"}},
+		Tree: []*State{
+			{Level: StateError, Source: "db", RunbookURL: "https://wiki.example.com/db"},
+			{Level: -1, Source: "override", Override: true, Mode: OverrideCap, KeepMessage: true},
+		},
+	}
+	
+	data, err := s.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := FromProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, decoded) {
+		t.Errorf("State round trip:\n%+v\n%+v", s, decoded)
+	}
+	
+	for _, f := range s.Flatten() {
+		
+		data, err := f.ToProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := FlatStateFromProto(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f, decoded) {
+			t.Errorf("FlatState round trip:\n%+v\n%+v", f, decoded)
+		}
+	}
+	
+	tr := Transition{ID: 42, Path: "app/db", From: StateOk, To: StateError, PreviousMessage: "ok", Message: "down", Time: at, Duration: 90 * time.Second + 5}
+	data, err = tr.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded_tr, err := TransitionFromProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tr, decoded_tr) {
+		t.Errorf("Transition round trip:\n%+v\n%+v", tr, decoded_tr)
+	}
+}
+func TestFromProtoMalformed(t *testing.T) {
+	
+	data, _ := (&State{Source: "app", Tree: []*State{New("db")}}).ToProto()
+	
+	// within the last field
+	if _, err := FromProto(data[:len(data) - 1]); err == nil {
+		t.Error("truncated message: no error")
+	}
+	for i := range data {
+		FromProto(data[:i]) // must not panic
+	}
+	
+	defer func(max_depth int) { MaxDepth = max_depth }(MaxDepth)
+	MaxDepth = 0
+	if _, err := FromProto(data); !errors.Is(err, ErrMalformedTree) {
+		t.Errorf("tree deeper than MaxDepth: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package jsonstate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maximum time to fetch the tree from the origin of a Proxy
+var ProxyTimeout = 10 * time.Second
+
+// maximum size of a document fetched by a Proxy
+var MaxProxyDocumentSize int64 = 16 << 20
+
+// a pull-through cache for the /state/ endpoint of a slow, flaky or constrained module: the origin is fetched at most once per Interval (in the background, while the last tree is served), and when it is down the last good tree is served with an annotation that it is stale
+type Proxy struct {
+	Origin string // URL of the endpoint
+	Header http.Header // additional request headers, e.g. Authorization
+	Client *http.Client // http.DefaultClient if nil
+	Interval time.Duration // 10 seconds if 0
+	Author string // of the stale annotation, "proxy" if empty
+	OnError func(error) // called for failed fetches (logged with slog by default)
+	
+	ctx context.Context
+	mu sync.Mutex
+	cached *State // the last good tree
+	fetched time.Time // of cached
+	attempted time.Time // of the last fetch
+	err error // of the last fetch
+	down_since time.Time // first failed fetch since the last good one
+	fetching chan struct{} // closed when the running fetch is done, nil if none
+}
+
+// constructor: the origin is fetched on the first request, and no more after ctx is done (then the last tree is served as stale)
+func NewProxy(ctx context.Context, origin string) *Proxy {
+	return &Proxy{
+		Origin: origin,
+		ctx: ctx,
+	}
+}
+// the tree of the origin, fetched at most once per Interval, with an annotation on the root if the origin is down
+// note: only the first call waits for the origin (or ctx), later calls get the last tree while it is fetched again
+func (p *Proxy) Snapshot(ctx context.Context) (*State, error) {
+	
+	s, _, _, err := p.snapshot(ctx)
+	return s, err
+}
+// serves the tree of the origin like Registry.Handler (?format=, ?flat= and ?version=), with the Age header, and a Warning header if stale
+// note: until the origin is fetched once, requests fail with 502 Bad Gateway
+func (p *Proxy) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		
+		s, fetched, stale, err := p.snapshot(req.Context())
+		if err != nil {
+			http.Error(w, strings.TrimPrefix(err.Error(), "jsonstate: "), http.StatusBadGateway)
+			return
+		}
+		
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(fetched).Seconds())))
+		if stale {
+			w.Header().Set("Warning", `110 - "Response is Stale"`)
+		}
+		
+		writeState(w, req, s)
+	})
+}
+
+func (p *Proxy) snapshot(ctx context.Context) (*State, time.Time, bool, error) {
+	
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	
+	p.mu.Lock()
+	if p.fetching == nil && time.Since(p.attempted) >= interval && p.ctx.Err() == nil {
+		p.fetching = make(chan struct{})
+		go p.refresh(p.fetching)
+	}
+	fetching := p.fetching
+	cached := p.cached
+	p.mu.Unlock()
+	
+	if cached == nil && fetching != nil {
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, time.Time{}, false, ctx.Err()
+		}
+	}
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	if p.cached == nil {
+		if p.err == nil {
+			return nil, time.Time{}, false, fmt.Errorf("jsonstate: %s not fetched yet", p.Origin)
+		}
+		return nil, time.Time{}, false, p.err
+	}
+	
+	s := p.cached.Clone()
+	if p.err == nil {
+		return s, p.fetched, false, nil
+	}
+	
+	author := p.Author
+	if author == "" {
+		author = "proxy"
+	}
+	s.Annotate(Annotation{
+		Time: p.down_since,
+		Author: author,
+		Text: fmt.Sprintf("stale: fetched at %s, then the origin became unavailable: %s", p.fetched.Format(time.RFC3339), strings.TrimPrefix(p.err.Error(), "jsonstate: ")),
+	})
+	
+	return s, p.fetched, true, nil
+}
+func (p *Proxy) refresh(done chan struct{}) {
+	
+	ctx, cancel := context.WithTimeout(p.ctx, ProxyTimeout)
+	s, err := p.fetch(ctx)
+	cancel()
+	
+	p.mu.Lock()
+	
+	now := time.Now()
+	p.attempted = now
+	if err == nil {
+		p.cached = s
+		p.fetched = now
+		p.down_since = time.Time{}
+	} else if p.err == nil {
+		p.down_since = now
+	}
+	p.err = err
+	p.fetching = nil
+	
+	p.mu.Unlock()
+	close(done)
+	
+	if err == nil {
+		return
+	}
+	if p.OnError != nil {
+		p.OnError(err)
+	} else {
+		slog.Error("jsonstate: proxy", "origin", p.Origin, "error", err)
+	}
+}
+func (p *Proxy) fetch(ctx context.Context) (*State, error) {
+	
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Origin, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range p.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, transportError("fetch", p.Origin, err)
+	}
+	defer res.Body.Close()
+	
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1 << 10))
+		return nil, statusError("fetch", p.Origin, res.StatusCode, res.Status, message)
+	}
+	
+	data, err := io.ReadAll(io.LimitReader(res.Body, MaxProxyDocumentSize + 1))
+	if err != nil {
+		return nil, transportError("fetch", p.Origin, err)
+	}
+	if int64(len(data)) > MaxProxyDocumentSize {
+		return nil, fmt.Errorf("jsonstate: fetch %s: document larger than %d bytes", p.Origin, MaxProxyDocumentSize)
+	}
+	
+	// a module may answer in another format than asked for
+	if _, codec, ok := DecoderByContentType(res.Header.Get("Content-Type")); ok {
+		return codec.Unmarshal(data)
+	}
+	
+	return Parse(data)
+}
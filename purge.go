@@ -0,0 +1,341 @@
+package jsonstate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// a store of operational data that can be purged (History, AuditLog, PeriodicSaver, FileReporter, SnapshotFiles, or a custom backend), attach it to a Registry with r.PurgeWith(p)
+// note: the audit log of a Remediator or FlagBridge is attached to its registry automatically
+type Purger interface {
+	PurgeBefore(before time.Time) int // remove everything older than before, returns the number of removed entries
+	PurgeSource(path string) int // remove everything of the source path and its tree, returns the number of removed entries
+}
+
+// snapshot files written with SaveFile (or FileReporter), of which PurgeHistory and PurgeSource remove the annotations (by rewriting the files that have any), e.g. r.PurgeWith(jsonstate.SnapshotFiles{"/var/lib/app/state.json"})
+type SnapshotFiles []string
+
+// option: also purge the given store with PurgeHistory and PurgeSource (histories attached with RecordHistory are always purged)
+func (r *Registry) PurgeWith(p Purger) *Registry {
+	
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	
+	r.purgers = append(r.purgers, p)
+	
+	return r
+}
+// attach the audit log of a Remediator or FlagBridge with PurgeWith, unless it is already attached
+func (r *Registry) purgeAuditLog(audit *AuditLog) {
+	
+	if audit == nil {
+		return
+	}
+	
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	
+	for _, p := range r.purgers {
+		if p == Purger(audit) {
+			return
+		}
+	}
+	r.purgers = append(r.purgers, audit)
+}
+// remove transitions, annotations and audit entries older than before, from the registry and every attached store, returns the number of removed entries
+func (r *Registry) PurgeHistory(before time.Time) int {
+	
+	r.mu.Lock()
+	
+	removed := 0
+	r.root.Walk(func(source_path []string, s *State) bool {
+		removed += s.purgeAnnotations(func(a Annotation) bool {
+			return a.Time.Before(before)
+		})
+		return true
+	})
+	
+	recent := r.recent[:0:0]
+	for _, t := range r.recent {
+		if !t.Time.Before(before) {
+			recent = append(recent, t)
+		}
+	}
+	removed += len(r.recent) - len(recent)
+	r.recent = recent
+	
+	stores := r.stores()
+	
+	r.notify()
+	r.mu.Unlock()
+	
+	for _, p := range stores {
+		removed += p.PurgeBefore(before)
+	}
+	
+	return removed
+}
+// remove transitions, annotations and audit entries of the source path and its tree, from the registry and every attached store, returns the number of removed entries
+// note: the states themselves are kept, see Remove
+func (r *Registry) PurgeSource(path string) int {
+	
+	source_path := SplitPath(path)
+	path = strings.Join(source_path, "/")
+	
+	r.mu.Lock()
+	
+	removed := 0
+	if s := r.root.FindBySource(source_path...); s != nil {
+		s.Walk(func(source_path []string, s_it *State) bool {
+			removed += s_it.purgeAnnotations(func(a Annotation) bool {
+				return true
+			})
+			return true
+		})
+	}
+	
+	recent := r.recent[:0:0]
+	for _, t := range r.recent {
+		if !inSourcePath(path, t.Path) {
+			recent = append(recent, t)
+		}
+	}
+	removed += len(r.recent) - len(recent)
+	r.recent = recent
+	
+	for since_path := range r.since {
+		if inSourcePath(path, since_path) {
+			delete(r.since, since_path)
+		}
+	}
+	
+	stores := r.stores()
+	
+	r.notify()
+	r.mu.Unlock()
+	
+	for _, p := range stores {
+		removed += p.PurgeSource(path)
+	}
+	
+	return removed
+}
+
+func (h *History) PurgeBefore(before time.Time) int {
+	
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	
+	removed := len(h.transitions) + len(h.annotations)
+	
+	transitions := h.transitions[:0:0]
+	for _, t := range h.transitions {
+		if !t.Time.Before(before) {
+			transitions = append(transitions, t)
+		}
+	}
+	h.transitions = transitions
+	
+	annotations := h.annotations[:0:0]
+	for _, a := range h.annotations {
+		if !a.Time.Before(before) {
+			annotations = append(annotations, a)
+		}
+	}
+	h.annotations = annotations
+	
+	return removed - len(h.transitions) - len(h.annotations)
+}
+func (h *History) PurgeSource(path string) int {
+	
+	path = strings.Join(SplitPath(path), "/")
+	
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	
+	removed := len(h.transitions) + len(h.annotations)
+	
+	transitions := h.transitions[:0:0]
+	for _, t := range h.transitions {
+		if !inSourcePath(path, t.Path) {
+			transitions = append(transitions, t)
+		}
+	}
+	h.transitions = transitions
+	
+	annotations := h.annotations[:0:0]
+	for _, a := range h.annotations {
+		if !inSourcePath(path, a.Path) {
+			annotations = append(annotations, a)
+		}
+	}
+	h.annotations = annotations
+	
+	return removed - len(h.transitions) - len(h.annotations)
+}
+
+func (l *AuditLog) PurgeBefore(before time.Time) int {
+	return l.purge(func(e AuditEntry) bool {
+		return e.Time.Before(before)
+	})
+}
+func (l *AuditLog) PurgeSource(path string) int {
+	
+	path = strings.Join(SplitPath(path), "/")
+	
+	return l.purge(func(e AuditEntry) bool {
+		return e.Path != "" && inSourcePath(path, strings.Join(SplitPath(e.Path), "/"))
+	})
+}
+func (l *AuditLog) purge(remove func(AuditEntry) bool) int {
+	
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	
+	entries := l.entries[:0:0]
+	for _, e := range l.entries {
+		if !remove(e) {
+			entries = append(entries, e)
+		}
+	}
+	
+	removed := len(l.entries) - len(entries)
+	l.entries = entries
+	
+	return removed
+}
+
+func (files SnapshotFiles) PurgeBefore(before time.Time) int {
+	
+	removed := 0
+	for _, path := range files {
+		removed += purgeFile(path, path, func(path string, a Annotation) bool {
+			return a.Time.Before(before)
+		})
+	}
+	
+	return removed
+}
+func (files SnapshotFiles) PurgeSource(path string) int {
+	
+	removed := 0
+	for _, file := range files {
+		removed += purgeFile(file, file, purgeSourceAnnotation(path))
+	}
+	
+	return removed
+}
+
+func (rep *FileReporter) PurgeBefore(before time.Time) int {
+	return SnapshotFiles{rep.Path}.PurgeBefore(before)
+}
+func (rep *FileReporter) PurgeSource(path string) int {
+	return SnapshotFiles{rep.Path}.PurgeSource(path)
+}
+
+func (p *PeriodicSaver) PurgeBefore(before time.Time) int {
+	return p.purge(func(path string, a Annotation) bool {
+		return a.Time.Before(before)
+	})
+}
+func (p *PeriodicSaver) PurgeSource(path string) int {
+	return p.purge(purgeSourceAnnotation(path))
+}
+// purge the snapshot and its rotations (in the format of the snapshot)
+func (p *PeriodicSaver) purge(remove func(path string, a Annotation) bool) int {
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	removed := purgeFile(p.Path, p.Path, remove)
+	for i := 1; i <= p.Keep; i += 1 {
+		removed += purgeFile(fmt.Sprintf("%s.%d", p.Path, i), p.Path, remove)
+	}
+	
+	return removed
+}
+
+// remove the annotations from a snapshot file, and rewrite it if there were any, a file that does not exist has none
+// note: failures are logged with slog, as purging continues with the other stores
+func purgeFile(path string, format_path string, remove func(path string, a Annotation) bool) int {
+	
+	s, err := loadFile(path, format_path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0
+	}
+	if err != nil {
+		slog.Error("jsonstate: purge " + path, slog.String("error", err.Error()))
+		return 0
+	}
+	
+	removed := 0
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		path := strings.Join(source_path, "/")
+		removed += s_it.purgeAnnotations(func(a Annotation) bool {
+			return remove(path, a)
+		})
+		
+		return true
+	})
+	if removed == 0 {
+		return 0
+	}
+	
+	if err := s.saveFile(path, format_path); err != nil {
+		slog.Error("jsonstate: purge " + path, slog.String("error", err.Error()))
+		return 0
+	}
+	
+	return removed
+}
+// whether an annotation belongs to the source path or its tree
+func purgeSourceAnnotation(path string) func(string, Annotation) bool {
+	
+	path = strings.Join(SplitPath(path), "/")
+	
+	return func(a_path string, a Annotation) bool {
+		return inSourcePath(path, a_path)
+	}
+}
+
+// note: must be called while holding the lock
+func (r *Registry) stores() []Purger {
+	
+	stores := []Purger{}
+	for _, h := range r.histories {
+		stores = append(stores, h)
+	}
+	
+	return append(stores, r.purgers...)
+}
+func (s *State) purgeAnnotations(remove func(Annotation) bool) int {
+	
+	if len(s.Annotations) == 0 {
+		return 0
+	}
+	
+	annotations := []Annotation{}
+	for _, a := range s.Annotations {
+		if !remove(a) {
+			annotations = append(annotations, a)
+		}
+	}
+	
+	removed := len(s.Annotations) - len(annotations)
+	
+	s.Annotations = annotations
+	if len(s.Annotations) == 0 {
+		s.Annotations = nil
+	}
+	
+	return removed
+}
+// whether path is the source path prefix or a path within its tree (an empty prefix is the root, which contains every path)
+func inSourcePath(prefix string, path string) bool {
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix + "/")
+}
@@ -0,0 +1,105 @@
+package jsonstate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func countAnnotations(s *State) int {
+	
+	n := 0
+	s.Walk(func(source_path []string, s_it *State) bool {
+		n += len(s_it.Annotations)
+		return true
+	})
+	
+	return n
+}
+
+func TestPurgeSourceSavedSnapshots(t *testing.T) {
+	
+	r := NewRegistry("")
+	r.Component("db").Set(StateError, "down")
+	r.Annotate("db", "alice", "restarted primary")
+	r.Annotate("web", "bob", "deployed")
+	
+	for _, file := range []string{"state.json.gz", "state.proto"} {
+		
+		saver := NewPeriodicSaver(r.Snapshot, filepath.Join(t.TempDir(), file), time.Minute, 2)
+		for i := 0; i < 3; i += 1 {
+			if err := saver.Save(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		
+		r := NewRegistry("")
+		r.PurgeWith(saver)
+		
+		// the snapshot and both rotations
+		if removed := r.PurgeSource("db"); removed != 3 {
+			t.Errorf("%s: purged %d annotations, want 3", file, removed)
+		}
+		
+		for _, path := range []string{saver.Path, saver.Path + ".1", saver.Path + ".2"} {
+			
+			s, err := loadFile(path, saver.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := countAnnotations(s); n != 1 {
+				t.Errorf("%s: %d annotations left, want 1", path, n)
+			}
+			if db, err := s.Lookup("db"); err != nil || db.Level != StateError || db.Message != "down" {
+				t.Errorf("%s: state of db changed: %+v %v", path, db, err)
+			}
+		}
+	}
+}
+func TestPurgeHistorySnapshotFiles(t *testing.T) {
+	
+	path := filepath.Join(t.TempDir(), "state.json")
+	
+	s := New("")
+	s.Add(New("db").Annotate(Annotation{Time: time.Now().Add(-48 * time.Hour), Text: "old"}).Annotate(Annotation{Time: time.Now(), Text: "new"}))
+	if err := s.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	
+	r := NewRegistry("").PurgeWith(SnapshotFiles{path, path + ".missing"})
+	if removed := r.PurgeHistory(time.Now().Add(-24 * time.Hour)); removed != 1 {
+		t.Errorf("purged %d annotations, want 1", removed)
+	}
+	
+	s, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db, _ := s.Lookup("db"); len(db.Annotations) != 1 || db.Annotations[0].Text != "new" {
+		t.Errorf("annotations after purge: %+v", db.Annotations)
+	}
+}
+func TestPurgeAuditLogOfRemediator(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	audit := NewAuditLog(0)
+	for i := 0; i < 3; i += 1 {
+		audit.Record(AuditEntry{Action: "restart", Path: fmt.Sprintf("db/replica%d", i)})
+	}
+	audit.Record(AuditEntry{Action: "restart", Path: "web"})
+	
+	r := NewRegistry("")
+	NewRemediator(ctx, r, audit)
+	NewRemediator(ctx, r, audit) // attached once
+	
+	if removed := r.PurgeSource("db"); removed != 3 {
+		t.Errorf("purged %d audit entries, want 3", removed)
+	}
+	if entries := audit.Entries(); len(entries) != 1 || entries[0].Path != "web" {
+		t.Errorf("audit entries after purge: %+v", entries)
+	}
+}
@@ -0,0 +1,125 @@
+package jsonstate
+
+import (
+	"strings"
+)
+
+// a filter over flattened states, built with NewFilter().MinLevel(StateWarning).SourceGlob("db/**"), or compiled from a query with CompileQuery()
+type Filter struct {
+	predicates []func(*FlatState) bool
+}
+
+// constructor: an empty filter matches everything
+func NewFilter() *Filter {
+	return &Filter{}
+}
+// match states with a level of at least level
+func (f *Filter) MinLevel(level int) *Filter {
+	return f.Where(func(item *FlatState) bool {
+		return item.Level >= level
+	})
+}
+// match states with a level of at most level
+func (f *Filter) MaxLevel(level int) *Filter {
+	return f.Where(func(item *FlatState) bool {
+		return item.Level <= level
+	})
+}
+// match states of which the source path matches the glob pattern (see MatchPath)
+func (f *Filter) SourceGlob(pattern string) *Filter {
+	return f.Where(func(item *FlatState) bool {
+		return MatchPath(pattern, item.Path)
+	})
+}
+// match states with this source (see NormalizeSource)
+func (f *Filter) Source(source string) *Filter {
+	
+	source = NormalizeSource(source)
+	
+	return f.Where(func(item *FlatState) bool {
+		return NormalizeSource(item.Source) == source
+	})
+}
+// match states of which the message contains the given text
+func (f *Filter) MessageContains(text string) *Filter {
+	return f.Where(func(item *FlatState) bool {
+		return strings.Contains(item.Message, text)
+	})
+}
+// match states for which fn returns true
+func (f *Filter) Where(fn func(*FlatState) bool) *Filter {
+	f.predicates = append(f.predicates, fn)
+	return f
+}
+// true if the state matches all conditions of the filter
+func (f *Filter) Match(item *FlatState) bool {
+	
+	for _, predicate := range f.predicates {
+		if !predicate(item) {
+			return false
+		}
+	}
+	
+	return true
+}
+// return the flattened states in the tree of s that match the filter (in Flatten() order)
+func (f *Filter) Apply(s *State) []*FlatState {
+	
+	list := []*FlatState{}
+	for _, item := range s.Flatten() {
+		if f.Match(item) {
+			list = append(list, item)
+		}
+	}
+	
+	return list
+}
+// return the flattened states that match a query (see CompileQuery), e.g. root.Query("level >= Warning && source ~ 'db/*'")
+func (s *State) Query(query string) ([]*FlatState, error) {
+	
+	f, err := CompileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	
+	return f.Apply(s), nil
+}
+
+// compile a query into a Filter, a query is an expression (see ParseExpression) in the ExprState context
+// note: a query compares fields with values, and combines comparisons with &&, ||, ! and parentheses:
+//  - fields: level, depth, count (numbers), source, path, message, datetime (strings)
+//  - operators: ==, !=, <, <=, >, >= and ~, which matches a glob against the source path for source and path (see MatchPath), and finds a substring for the other strings
+//  - values: numbers, level names (e.g. Warning, including custom levels) and 'single' or "double" quoted strings
+func CompileQuery(query string) (*Filter, error) {
+	
+	e, err := ParseExpression(ExprState, query)
+	if err != nil {
+		return nil, err
+	}
+	
+	// evaluating a type checked condition over a flattened state cannot fail
+	return NewFilter().Where(func(item *FlatState) bool {
+		ok, _ := e.MatchState(item)
+		return ok
+	}), nil
+}
+
+func compareQuery(op string, a int, b int) bool {
+	
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	
+	return false
+}
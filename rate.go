@@ -0,0 +1,232 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a numeric value of a component (queue depth, disk usage, ...), see RateProbe
+type Gauge interface {
+	Sample(ctx context.Context) (float64, error)
+}
+// adapter to use a plain function as Gauge
+type GaugeFunc func(ctx context.Context) (float64, error)
+
+// a rate-of-change rule: the component is at Level when its value changes faster than Rate per minute for at least For
+type RateRule struct {
+	Rate float64             `json:"rate"` // change per minute, positive for growth (e.g. 100 for "growing more than 100/min"), negative for decline
+	For time.Duration        `json:"for"`
+	Level int                `json:"level"`
+}
+// configuration of a rate rule (see ProbeConfig), e.g. {"rate": 100, "for": "5m", "level": "warning"}
+type RateConfig struct {
+	Rate float64             `json:"rate"`
+	For string               `json:"for,omitempty"`
+	Level string             `json:"level"` // name of the level (see LevelByName)
+}
+// a probe that samples a gauge at every check, and applies the rules to the rate of change since the previous check (the worst matching rule wins)
+// note: this catches problems that absolute thresholds miss, such as a queue that keeps growing while it is still far from full
+type RateProbe struct {
+	Name string // what is sampled, e.g. "queue depth" (used in the message)
+	Gauge Gauge
+	Rules []RateRule
+	mu sync.Mutex
+	sampled bool
+	value float64 // previous sample
+	time time.Time
+	since []time.Time // per rule: start of the period the rate exceeds it, zero if it does not
+}
+// runs a command that prints a number
+type ExecGauge struct {
+	Name string
+	Args []string
+}
+// gets a URL that responds with a number
+type HTTPGauge struct {
+	URL string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+type rateError struct {
+	level int
+	message string
+}
+
+func (fn GaugeFunc) Sample(ctx context.Context) (float64, error) {
+	return fn(ctx)
+}
+
+// constructor: e.g. NewRateProbe("queue depth", gauge, RateRule{Rate: 100, For: 5 * time.Minute, Level: StateWarning})
+func NewRateProbe(name string, gauge Gauge, rules ...RateRule) *RateProbe {
+	return &RateProbe{
+		Name: name,
+		Gauge: gauge,
+		Rules: rules,
+	}
+}
+func (p *RateProbe) Check(ctx context.Context) error {
+	
+	value, err := p.Gauge.Sample(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	// the first sample has no rate yet
+	if !p.sampled || !now.After(p.time) {
+		p.sampled = true
+		p.value = value
+		p.time = now
+		return nil
+	}
+	
+	rate := (value - p.value) / now.Sub(p.time).Minutes()
+	previous := p.time
+	p.value = value
+	p.time = now
+	
+	if len(p.since) != len(p.Rules) {
+		p.since = make([]time.Time, len(p.Rules))
+	}
+	
+	var matched *RateRule
+	for i := range p.Rules {
+		
+		rule := &p.Rules[i]
+		
+		if !rule.exceeded(rate) {
+			p.since[i] = time.Time{}
+			continue
+		}
+		
+		// the rate is measured since the previous sample
+		if p.since[i].IsZero() {
+			p.since[i] = previous
+		}
+		
+		if now.Sub(p.since[i]) >= rule.For && (matched == nil || rule.Level > matched.Level) {
+			matched = rule
+		}
+	}
+	
+	if matched == nil {
+		return nil
+	}
+	
+	direction := "growing"
+	if rate < 0 {
+		direction = "declining"
+	}
+	name := p.Name
+	if name == "" {
+		name = "value"
+	}
+	
+	return &rateError{
+		level: matched.Level,
+		message: fmt.Sprintf("%s %s %s/min for at least %s (now %s)", name, direction, formatRate(rate), matched.For, formatRate(value)),
+	}
+}
+
+func (rule *RateRule) exceeded(rate float64) bool {
+	
+	if rule.Rate < 0 {
+		return rate < rule.Rate
+	}
+	
+	return rate > rule.Rate
+}
+
+func (g *ExecGauge) Sample(ctx context.Context) (float64, error) {
+	
+	output, err := exec.CommandContext(ctx, g.Name, g.Args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", g.Name, err)
+	}
+	
+	return parseGauge(g.Name, output)
+}
+func (g *HTTPGauge) Sample(ctx context.Context) (float64, error) {
+	
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1 << 16))
+	if err != nil {
+		return 0, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return 0, fmt.Errorf("%s: %s", g.URL, res.Status)
+	}
+	
+	return parseGauge(g.URL, body)
+}
+
+func (e *rateError) Error() string {
+	return e.message
+}
+func (e *rateError) StateLevel() int {
+	return e.level
+}
+
+// create the rules of a configuration
+func newRateRules(configs []RateConfig) ([]RateRule, error) {
+	
+	rules := []RateRule{}
+	for _, config := range configs {
+		
+		level, ok := LevelByName(config.Level)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLevel, config.Level)
+		}
+		
+		d, err := parseConfigDuration(config.For, 0)
+		if err != nil {
+			return nil, err
+		}
+		
+		rules = append(rules, RateRule{
+			Rate: config.Rate,
+			For: d,
+			Level: level,
+		})
+	}
+	
+	return rules, nil
+}
+func parseGauge(name string, data []byte) (float64, error) {
+	
+	value, err := strconv.ParseFloat(string(bytes.TrimSpace(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: not a number: %q", name, bytes.TrimSpace(data))
+	}
+	
+	return value, nil
+}
+// in the current locale (see SetLocale), e.g. "1,234.5" (en)
+func formatRate(value float64) string {
+	return CurrentLocale().FormatNumber(value, 2)
+}
@@ -0,0 +1,250 @@
+package jsonstate
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// source of the state that a Receiver adds to the subtree of a client that exceeds its quota
+var QuotaSource = "quota"
+
+// limits of a reporting client of a Receiver, a zero field means no limit
+type Quota struct {
+	MaxNodes int // states in a pushed tree
+	MaxDocumentSize int64 // bytes of a pushed document, at most 16 MiB (also if 0)
+	MaxUpdates int // pushes per Window
+	Window time.Duration // one minute if 0
+}
+
+// accepts trees that clients push (e.g. with HTTPReporter) to the source path of the client, and puts them in the Registry, replacing what the client pushed before
+// note: a push that exceeds the quota of the client is rejected, and the last accepted tree of the client gets a QuotaSource state at Attention that says why, until the next accepted push
+// note: a push to a source path in the subtree of another client (or that contains another client) is rejected, so that a client cannot replace the trees of others, nor escape its quota by pushing below its path
+type Receiver struct {
+	Registry *Registry
+	Quota Quota // of every client
+	Quotas map[string]Quota // of the clients at or below specific source paths (e.g. "hosts/big-one", or "hosts" for all of them), by the longest matching path, instead of Quota
+	
+	mu sync.Mutex
+	clients map[string]bool // source paths of the clients that pushed a tree
+	updates map[string][]time.Time // of the pushes within the window, per client
+	next_sweep time.Time // of the updates of clients that stopped pushing
+}
+
+// constructor: e.g. http.Handle("/state/", http.StripPrefix("/state/", NewReceiver(registry, jsonstate.Quota{MaxNodes: 1000, MaxUpdates: 60}).Handler()))
+func NewReceiver(r *Registry, quota Quota) *Receiver {
+	return &Receiver{
+		Registry: r,
+		Quota: quota,
+		Quotas: map[string]Quota{},
+		clients: map[string]bool{},
+		updates: map[string][]time.Time{},
+	}
+}
+// accept POST or PUT of a tree in any registered format (by Content-Type, JSON by default), to the source path of the client as URL path (see http.StripPrefix)
+// note: the response is 204 No Content if accepted, 409 Conflict for a source path in the subtree of another client (or that contains one), or 413 Request Entity Too Large, 422 Unprocessable Entity (too many states) or 429 Too Many Requests (with Retry-After) if the quota is exceeded
+func (rc *Receiver) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		
+		source_path := SplitPath(req.URL.Path)
+		if len(source_path) == 0 {
+			http.Error(w, "missing source path of the client", http.StatusBadRequest)
+			return
+		}
+		client := strings.Join(source_path, "/")
+		quota := rc.quota(source_path)
+		
+		if other := rc.overlap(client); other != "" {
+			http.Error(w, fmt.Sprintf("source path overlaps the one of client %s", other), http.StatusConflict)
+			return
+		}
+		
+		if retry_after, ok := rc.allow(client, quota); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry_after.Seconds()) + 1))
+			rc.reject(w, source_path, http.StatusTooManyRequests, fmt.Sprintf("more than %d updates per %s", quota.MaxUpdates, quotaWindow(quota)))
+			return
+		}
+		
+		max_size := quota.MaxDocumentSize
+		if max_size <= 0 || max_size > 16 << 20 {
+			max_size = 16 << 20
+		}
+		
+		data, err := io.ReadAll(io.LimitReader(req.Body, max_size + 1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(data)) > max_size {
+			rc.reject(w, source_path, http.StatusRequestEntityTooLarge, fmt.Sprintf("document larger than %d bytes", max_size))
+			return
+		}
+		
+		var s *State
+		if _, codec, ok := DecoderByContentType(req.Header.Get("Content-Type")); ok {
+			s, err = codec.Unmarshal(data)
+		} else {
+			s, err = Parse(data)
+		}
+		if err != nil {
+			http.Error(w, strings.TrimPrefix(err.Error(), "jsonstate: "), http.StatusBadRequest)
+			return
+		}
+		
+		if nodes := countNodes(s); quota.MaxNodes > 0 && nodes > quota.MaxNodes {
+			rc.reject(w, source_path, http.StatusUnprocessableEntity, fmt.Sprintf("%d states, at most %d allowed", nodes, quota.MaxNodes))
+			return
+		}
+		
+		if other := rc.claim(client); other != "" {
+			http.Error(w, fmt.Sprintf("source path overlaps the one of client %s", other), http.StatusConflict)
+			return
+		}
+		
+		rc.Registry.Update(source_path, func(s_it *State) {
+			
+			// the tree of the client replaces the previous one (and any QuotaSource state)
+			source := s_it.Source
+			*s_it = *s
+			s_it.Source = source
+		})
+		
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// the quota of the longest source path in Quotas that the source path is (or is in the subtree of), or else Quota
+func (rc *Receiver) quota(source_path []string) Quota {
+	
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	
+	for i := len(source_path); i > 0; i -= 1 {
+		if quota, ok := rc.Quotas[strings.Join(source_path[:i], "/")]; ok {
+			return quota
+		}
+	}
+	
+	return rc.Quota
+}
+// another client of which the source path is a parent or child of the one of client, or ""
+func (rc *Receiver) overlap(client string) string {
+	
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	
+	return rc.overlapping(client)
+}
+// register the client (unless another client overlaps it, see overlap)
+func (rc *Receiver) claim(client string) string {
+	
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	
+	if other := rc.overlapping(client); other != "" {
+		return other
+	}
+	rc.clients[client] = true
+	
+	return ""
+}
+// note: must be called while holding the lock
+func (rc *Receiver) overlapping(client string) string {
+	
+	for other := range rc.clients {
+		if other != client && (strings.HasPrefix(client, other + "/") || strings.HasPrefix(other, client + "/")) {
+			return other
+		}
+	}
+	
+	return ""
+}
+// whether the client may push within its quota (and count the push), or else how long until it may
+func (rc *Receiver) allow(client string, quota Quota) (time.Duration, bool) {
+	
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	
+	now := time.Now()
+	rc.sweep(now)
+	
+	if quota.MaxUpdates <= 0 {
+		return 0, true
+	}
+	
+	window := quotaWindow(quota)
+	
+	// forget the pushes that left the window
+	updates := rc.updates[client]
+	for len(updates) > 0 && now.Sub(updates[0]) >= window {
+		updates = updates[1:]
+	}
+	
+	if len(updates) >= quota.MaxUpdates {
+		rc.updates[client] = updates
+		return updates[0].Add(window).Sub(now), false
+	}
+	
+	rc.updates[client] = append(updates, now)
+	
+	return 0, true
+}
+// forget the updates of the clients of which every push left the longest window of the quotas, at most once per minute
+// note: must be called while holding the lock
+func (rc *Receiver) sweep(now time.Time) {
+	
+	if now.Before(rc.next_sweep) {
+		return
+	}
+	rc.next_sweep = now.Add(time.Minute)
+	
+	window := quotaWindow(rc.Quota)
+	for _, quota := range rc.Quotas {
+		window = max(window, quotaWindow(quota))
+	}
+	
+	for client, updates := range rc.updates {
+		if len(updates) == 0 || now.Sub(updates[len(updates) - 1]) >= window {
+			delete(rc.updates, client)
+		}
+	}
+}
+// respond with the violation, and show it in the subtree of the client
+func (rc *Receiver) reject(w http.ResponseWriter, source_path []string, status int, reason string) {
+	
+	message := "quota exceeded: " + reason
+	rc.Registry.Update(append(source_path[:len(source_path):len(source_path)], QuotaSource), func(s *State) {
+		s.Set(StateAttention, message)
+	})
+	
+	http.Error(w, message, status)
+}
+
+func quotaWindow(quota Quota) time.Duration {
+	
+	if quota.Window <= 0 {
+		return time.Minute
+	}
+	
+	return quota.Window
+}
+func countNodes(s *State) int {
+	
+	n := 0
+	s.Walk(func(source_path []string, s_it *State) bool {
+		n += 1
+		return true
+	})
+	
+	return n
+}
@@ -0,0 +1,91 @@
+package jsonstate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func push(handler http.Handler, path string, body string) int {
+	
+	req := httptest.NewRequest(http.MethodPost, "/" + path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	
+	return rec.Code
+}
+func TestReceiverOverlap(t *testing.T) {
+	
+	r := NewRegistry("app")
+	handler := NewReceiver(r, Quota{}).Handler()
+	
+	if code := push(handler, "hosts/a", `{"level": 200}`); code != http.StatusNoContent {
+		t.Fatalf("push: %d", code)
+	}
+	if code := push(handler, "hosts/b", `{"level": 400}`); code != http.StatusNoContent {
+		t.Fatalf("push: %d", code)
+	}
+	
+	// neither the parent of the clients, nor a path below one of them
+	if code := push(handler, "hosts", `{"level": 200}`); code != http.StatusConflict {
+		t.Errorf("push to the parent of clients: %d", code)
+	}
+	if code := push(handler, "hosts/a/x", `{"level": 200}`); code != http.StatusConflict {
+		t.Errorf("push below a client: %d", code)
+	}
+	if code := push(handler, "hosts/a", `{"level": 300}`); code != http.StatusNoContent {
+		t.Errorf("push of the same client: %d", code)
+	}
+	
+	if b, err := r.Lookup("hosts/b"); err != nil || b.Level != StateWarning {
+		t.Errorf("tree of another client: %v, %v", b, err)
+	}
+}
+func TestReceiverQuotaPrefix(t *testing.T) {
+	
+	r := NewRegistry("app")
+	rc := NewReceiver(r, Quota{})
+	rc.Quotas["hosts"] = Quota{MaxNodes: 100}
+	rc.Quotas["hosts/big-one"] = Quota{MaxNodes: 2}
+	handler := rc.Handler()
+	
+	tree := `{"level": 200, "tree": [{"source": "a", "level": 200}, {"source": "b", "level": 200}]}`
+	if code := push(handler, "hosts/small", tree); code != http.StatusNoContent {
+		t.Errorf("push within the quota of hosts: %d", code)
+	}
+	if code := push(handler, "hosts/big-one/x", tree); code != http.StatusUnprocessableEntity {
+		t.Errorf("push beyond the quota of hosts/big-one: %d", code)
+	}
+	if q, err := r.Lookup("hosts/big-one/x/" + QuotaSource); err != nil || q.Level != StateAttention {
+		t.Errorf("quota state: %v, %v", q, err)
+	}
+}
+func TestReceiverPrunesUpdates(t *testing.T) {
+	
+	rc := NewReceiver(NewRegistry("app"), Quota{MaxUpdates: 1, Window: time.Millisecond})
+	handler := rc.Handler()
+	
+	if code := push(handler, "a", `{"level": 200}`); code != http.StatusNoContent {
+		t.Fatalf("push: %d", code)
+	}
+	if code := push(handler, "a", `{"level": 200}`); code != http.StatusTooManyRequests && code != http.StatusNoContent {
+		t.Fatalf("push: %d", code)
+	}
+	
+	time.Sleep(5 * time.Millisecond)
+	rc.mu.Lock()
+	rc.next_sweep = time.Time{}
+	rc.mu.Unlock()
+	
+	if code := push(handler, "b", `{"level": 200}`); code != http.StatusNoContent {
+		t.Fatalf("push: %d", code)
+	}
+	
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if _, ok := rc.updates["a"]; ok || len(rc.updates) != 1 {
+		t.Errorf("updates: %v", rc.updates)
+	}
+}
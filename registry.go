@@ -0,0 +1,372 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a Registry owns a State tree, so that components may update their state from anywhere without threading a *State pointer around
+// note: the tree is only ever modified while holding the lock, readers get a copy with Snapshot()
+type Registry struct {
+	mu sync.RWMutex
+	root *State
+	since map[string]time.Time // time of the last transition per source path
+	hooks []func(Transition)
+	histories []*History // also receive annotations
+	purgers []Purger // see PurgeWith
+	seq uint64 // ID of the last transition
+	recent []Transition // the last transitions (at most maxRecentTransitions), so that streaming clients may resubscribe without missing any
+	changed chan struct{} // closed (and replaced) whenever the tree changes
+}
+// a handle to a single State in the Registry tree, identified by its source path (e.g. "db/replica1")
+type Component struct {
+	registry *Registry
+	path []string
+}
+
+// process-wide registry, used by the package-level GetComponent(), Snapshot() and Handler()
+var DefaultRegistry = NewRegistry("")
+
+// constructor: source is the Source of the root state
+func NewRegistry(source string) *Registry {
+	return &Registry{
+		root: New(source),
+		since: map[string]time.Time{},
+		changed: make(chan struct{}),
+	}
+}
+// get a handle to the component with the given path, the State (and any parent) is created lazily on first update
+func (r *Registry) Component(path string) *Component {
+	return &Component{
+		registry: r,
+		path: SplitPath(path),
+	}
+}
+// run fn on the State for the given source path while holding the lock, creating the State (and parents) if they do not exist yet
+func (r *Registry) Update(source_path []string, fn func(*State)) {
+	
+	r.mu.Lock()
+	
+	transitions := r.update(source_path, fn)
+	r.notify()
+	
+	r.release(transitions)
+}
+// remove the State with the given source path (and its tree), returns false if it did not exist
+// note: every removed state that was not Unknown has a transition to Unknown, so that alerts, escalations and remediations of the removed states end
+func (r *Registry) Remove(path string) bool {
+	
+	r.mu.Lock()
+	
+	transitions, ok := r.remove(SplitPath(path))
+	if !ok {
+		r.mu.Unlock()
+		return false
+	}
+	r.notify()
+	
+	r.release(transitions)
+	
+	return true
+}
+// return a deep copy of the tree with aggregated levels, which is safe to read and modify without locking
+func (r *Registry) Snapshot() *State {
+	
+	r.mu.RLock()
+	snapshot := r.root.Clone()
+	r.mu.RUnlock()
+	
+	return prepareSnapshot(snapshot)
+}
+// a snapshot of the state with the given source path (see Snapshot), or an error wrapping ErrSourceNotFound
+func (r *Registry) Lookup(path string) (*State, error) {
+	return r.Snapshot().Lookup(path)
+}
+// aggregate and annotate a copy of the tree for readers
+func prepareSnapshot(snapshot *State) *State {
+	return snapshot.AggregateLevels().ApplySynthetics().ApplyRunbooks().ApplySLAs()
+}
+// run fn on the State for the given source path (see Update), and return a transition for every state in its recursive tree of which the level changed
+// note: a state that fn adds is a transition from Unknown, and a state that fn removes is a transition to Unknown (e.g. when fn replaces the tree)
+// note: must be called while holding the lock
+func (r *Registry) update(source_path []string, fn func(*State)) []Transition {
+	
+	s := r.root
+	for _, source := range source_path {
+		
+		s_it := s.FindBySource(source)
+		if s_it == nil {
+			s_it = New(source)
+			s.Add(s_it)
+		}
+		s = s_it
+	}
+	
+	before, before_paths := subtreeLevels(s, source_path)
+	
+	fn(s)
+	
+	// fn may have added nil states, or a state that is already in the tree (e.g. a parent, which would make the tree self-referential), the states that were there first are kept
+	if err := r.root.Repair(); err != nil {
+		slog.Error("jsonstate: repaired the tree after updating /" + strings.Join(source_path, "/"), slog.String("error", err.Error()))
+	}
+	checkInvariants("Registry.Update", r.root)
+	
+	after, after_paths := subtreeLevels(s, source_path)
+	
+	return r.subtreeTransitions(before, before_paths, after, after_paths)
+}
+// the transitions between the levels of a subtree before and after a change (see subtreeLevels), removed states go to Unknown
+// note: must be called while holding the lock
+func (r *Registry) subtreeTransitions(before map[string]State, before_paths []string, after map[string]State, after_paths []string) []Transition {
+	
+	transitions := []Transition{}
+	for _, path := range after_paths {
+		if from := before[path]; from.Level != after[path].Level {
+			transitions = append(transitions, r.transition(path, from.Level, from.Message, after[path].Level, after[path].Message))
+		}
+	}
+	for _, path := range before_paths {
+		if _, ok := after[path]; !ok && before[path].Level != StateUnknown {
+			transitions = append(transitions, r.transition(path, before[path].Level, before[path].Message, StateUnknown, ""))
+		}
+	}
+	
+	return transitions
+}
+// level and message of every state in the recursive tree of s by source path (joined with "/", prefixed with the source path of s), and the paths in tree order
+func subtreeLevels(s *State, source_path []string) (map[string]State, []string) {
+	
+	levels := map[string]State{}
+	paths := []string{}
+	s.Walk(func(s_path []string, s_it *State) bool {
+		
+		path := strings.Join(append(source_path[:len(source_path):len(source_path)], s_path...), "/")
+		if _, ok := levels[path]; !ok {
+			levels[path] = State{Level: s_it.Level, Message: s_it.Message}
+			paths = append(paths, path)
+		}
+		
+		return true
+	})
+	
+	return levels, paths
+}
+// remove the state and its tree, with the transitions of the removed states to Unknown
+// note: must be called while holding the lock
+func (r *Registry) remove(source_path []string) ([]Transition, bool) {
+	
+	if len(source_path) == 0 {
+		return nil, false // the root cannot be removed
+	}
+	
+	parent := r.root
+	if len(source_path) > 1 {
+		parent = r.root.FindBySource(source_path[:len(source_path) - 1]...)
+	}
+	if parent == nil {
+		return nil, false
+	}
+	
+	s := parent.FindBySource(source_path[len(source_path) - 1])
+	if s == nil {
+		return nil, false
+	}
+	before, before_paths := subtreeLevels(s, source_path)
+	
+	if !parent.Remove(source_path[len(source_path) - 1]) {
+		return nil, false
+	}
+	
+	return r.subtreeTransitions(before, before_paths, nil, nil), true
+}
+// release the lock, and then call the hooks for the transitions, so that they may read from (or update) the registry
+// note: must be called while holding the lock
+func (r *Registry) release(transitions []Transition) {
+	
+	hooks := r.hooks
+	
+	r.mu.Unlock()
+	
+	for _, t := range transitions {
+		for _, hook := range hooks {
+			hook(t)
+		}
+	}
+}
+// note: must be called while holding the lock
+func (r *Registry) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+// serve the aggregated tree as JSON, or the flattened list with ?flat=1, or in any registered format with ?format=<name> (see RegisterCodec)
+// note: the Accept header selects a non-text format (e.g. application/x-ndjson), so that browsers still get JSON
+// note: with ?version=<n>, the JSON is migrated down to that schema version (see Migrate), for remote modules on older versions of this library
+// note: with ?explain=1, the response is a JSON object {"state": ..., "explain": [...]} with the explanation of every computed level (see Explain)
+// note: wrapped with AccessPolicy.Handler, each request only gets the subtrees it may read
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		
+		w.Header().Set("Cache-Control", "no-cache")
+		
+		if explain := req.URL.Query().Get("explain"); explain != "" && explain != "0" {
+			
+			snapshot, all := r.Explain()
+			
+			snapshot = restrictContext(req.Context(), snapshot)
+			explanations := []Explanation{}
+			for _, e := range all {
+				if accessible(req.Context(), e.Path) {
+					explanations = append(explanations, e)
+				}
+			}
+			
+			var v any = snapshot
+			if flat := req.URL.Query().Get("flat"); flat != "" && flat != "0" {
+				v = snapshot.Flatten()
+			}
+			
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"state": v,
+				"explain": explanations,
+			})
+			return
+		}
+		
+		writeState(w, req, r.Snapshot())
+	})
+}
+// write a tree in the format of the request: ?format=<codec> (or the Accept header), ?flat=1 and ?version=N (see Handler), restricted to what the request may read
+func writeState(w http.ResponseWriter, req *http.Request, s *State) {
+	
+	s = restrictContext(req.Context(), s) // see AccessPolicy
+	
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = acceptedCodec(req.Header.Get("Accept"))
+	}
+	
+	if format != "" && format != "json" {
+		
+		codec, ok := CodecByName(format)
+		if !ok {
+			http.Error(w, "unknown format: " + format, http.StatusBadRequest)
+			return
+		}
+		
+		data, err := codec.Marshal(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		
+		w.Header().Set("Content-Type", codec.ContentType())
+		w.Write(data)
+		return
+	}
+	
+	var v any = s
+	if flat := req.URL.Query().Get("flat"); flat != "" && flat != "0" {
+		v = s.Flatten()
+	}
+	
+	if version := req.URL.Query().Get("version"); version != "" {
+		
+		to_version, err := strconv.Atoi(version)
+		if err != nil {
+			http.Error(w, "invalid version: " + version, http.StatusBadRequest)
+			return
+		}
+		
+		data, err := json.Marshal(v)
+		if err == nil {
+			data, err = Migrate(data, SchemaVersion, to_version)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(data, '\n'))
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+// name of the first codec with a non-text media type in the Accept header (an empty string for JSON)
+func acceptedCodec(accept string) string {
+	
+	for _, media_range := range strings.Split(accept, ",") {
+		
+		name, _, ok := CodecByContentType(media_range)
+		if !ok {
+			continue
+		}
+		if name == "json" {
+			return ""
+		}
+		if media_type, _, _ := mime.ParseMediaType(media_range); !strings.HasPrefix(media_type, "text/") {
+			return name
+		}
+	}
+	
+	return ""
+}
+
+// source path of the component, joined with "/"
+func (c *Component) Path() string {
+	return strings.Join(c.path, "/")
+}
+// same as State.Set, but safe for concurrent use
+func (c *Component) Set(level int, message string) *Component {
+	
+	c.registry.Update(c.path, func(s *State) {
+		s.Set(level, message)
+	})
+	
+	return c
+}
+// same as State.SetError, but safe for concurrent use
+func (c *Component) SetError(err error) *Component {
+	
+	c.registry.Update(c.path, func(s *State) {
+		s.SetError(err)
+	})
+	
+	return c
+}
+// get a handle to a child component (path is relative to this component)
+func (c *Component) Component(path string) *Component {
+	return &Component{
+		registry: c.registry,
+		path: append(append([]string{}, c.path...), SplitPath(path)...),
+	}
+}
+
+// shorthand for DefaultRegistry.Component(path)
+func GetComponent(path string) *Component {
+	return DefaultRegistry.Component(path)
+}
+// shorthand for DefaultRegistry.Snapshot()
+func Snapshot() *State {
+	return DefaultRegistry.Snapshot()
+}
+// shorthand for DefaultRegistry.Handler()
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
@@ -0,0 +1,84 @@
+package jsonstate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRemoveEmitsTransitions(t *testing.T) {
+	
+	r := NewRegistry("app")
+	r.Component("db/primary").Set(StateFault, "down")
+	r.Component("db/replica").Set(StateOk, "")
+	
+	transitions := []Transition{}
+	r.OnTransition(func(t Transition) {
+		transitions = append(transitions, t)
+	})
+	
+	if !r.Remove("db") {
+		t.Fatal("db not removed")
+	}
+	if r.Remove("db") {
+		t.Error("removed db twice")
+	}
+	
+	// db itself was Unknown, and is not notified
+	want := map[string]int{"db/primary": StateFault, "db/replica": StateOk}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions: %+v", transitions)
+	}
+	for _, tr := range transitions {
+		if from, ok := want[tr.Path]; !ok || tr.From != from || tr.To != StateUnknown {
+			t.Errorf("transition %+v", tr)
+		}
+	}
+}
+func TestRemoveStopsEscalation(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	escalated := make(chan Notification, 10)
+	a := NewAlerter(ctx).AddRoute(&Route{
+		Pattern: "removed/*",
+		MinLevel: StateError,
+		Notifiers: []Notifier{NotifierFunc(func(ctx context.Context, n Notification) error {
+			return nil
+		})},
+		Escalation: []EscalationStep{{
+			After: 50 * time.Millisecond,
+			Notifiers: []Notifier{NotifierFunc(func(ctx context.Context, n Notification) error {
+				escalated <- n
+				return nil
+			})},
+		}},
+	})
+	
+	r := NewRegistry("app").Alert(a)
+	r.Component("removed/db").Set(StateFault, "down")
+	r.Remove("removed/db")
+	
+	select {
+	case n := <-escalated:
+		t.Errorf("escalated after Remove: %+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+func TestTxRemoveEmitsTransitions(t *testing.T) {
+	
+	r := NewRegistry("app")
+	r.Component("db").Set(StateError, "down")
+	
+	transitions := []Transition{}
+	r.OnTransition(func(t Transition) {
+		transitions = append(transitions, t)
+	})
+	
+	r.Begin().Remove("db").Remove("missing").Commit()
+	
+	if len(transitions) != 1 || transitions[0].Path != "db" || transitions[0].From != StateError || transitions[0].To != StateUnknown {
+		t.Errorf("transitions: %+v", transitions)
+	}
+}
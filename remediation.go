@@ -0,0 +1,373 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a local remediation (restart a service, run a script, ...) for a source that stays at a level
+type Action interface {
+	Run(ctx context.Context, t Transition) error // t is the last transition of the source
+}
+// adapter to use a plain function as Action
+type ActionFunc func(ctx context.Context, t Transition) error
+
+// runs a command, with JSONSTATE_PATH, JSONSTATE_LEVEL, JSONSTATE_LEVEL_NAME and JSONSTATE_MESSAGE in the environment
+type ExecAction struct {
+	Name string
+	Args []string
+}
+
+// a remediation rule: run Action when a source matching Pattern stays at MinLevel (or worse) for After, and again every After as long as it does
+type RemediationRule struct {
+	Name string              `json:"name,omitempty"`
+	Pattern string           `json:"pattern,omitempty"` // glob pattern of the source path (see MatchPath), all sources if empty
+	MinLevel int             `json:"min_level"`
+	After time.Duration      `json:"after"`
+	Action Action            `json:"-"`
+	Cooldown time.Duration   `json:"cooldown,omitempty"` // minimum time between runs for the same source
+	MaxRuns int              `json:"max_runs,omitempty"` // maximum number of runs (for all sources) within Per, unlimited if zero
+	Per time.Duration        `json:"per,omitempty"`
+	RequireApproval bool     `json:"require_approval,omitempty"` // propose the action instead of running it (see Remediator.Approve)
+}
+// runs remediation actions for the sources of a registry, every decision is recorded in the audit log
+type Remediator struct {
+	mu sync.Mutex
+	ctx context.Context // parent of the context of every action
+	registry *Registry
+	audit *AuditLog
+	rules []*RemediationRule
+	pending map[remediationKey]*remediation
+	last map[remediationKey]time.Time // time of the last run per rule and source path
+	runs map[*RemediationRule][]time.Time // times of the runs within Per
+	proposals map[uint64]*proposal // actions awaiting approval, by ID
+	proposal_seq uint64
+	queue chan func()
+	closed bool
+	OnError func(error) // called for failed actions (logged with slog by default)
+	OnProposal func(ActionProposal) // called (one at a time, like the actions) when an action awaits approval, e.g. to post it to a chat
+}
+
+type remediationKey struct {
+	rule *RemediationRule
+	path string
+}
+type remediation struct {
+	t Transition
+	timer *time.Timer
+}
+
+// maximum duration of a remediation action
+var ActionTimeout = 5 * time.Minute
+
+func (fn ActionFunc) Run(ctx context.Context, t Transition) error {
+	return fn(ctx, t)
+}
+
+// constructor: an action that restarts a systemd unit
+func SystemdRestart(unit string) *ExecAction {
+	return &ExecAction{
+		Name: "systemctl",
+		Args: []string{"restart", unit},
+	}
+}
+// constructor: an action that runs a command
+func Script(name string, args ...string) *ExecAction {
+	return &ExecAction{
+		Name: name,
+		Args: args,
+	}
+}
+func (e *ExecAction) Run(ctx context.Context, t Transition) error {
+	
+	cmd := exec.CommandContext(ctx, e.Name, e.Args...)
+	cmd.Env = append(os.Environ(),
+		"JSONSTATE_PATH=" + t.Path,
+		"JSONSTATE_LEVEL=" + strconv.Itoa(t.To),
+		"JSONSTATE_LEVEL_NAME=" + LevelString(t.To),
+		"JSONSTATE_MESSAGE=" + t.Message,
+	)
+	
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if output = bytes.TrimSpace(output); len(output) > 0 {
+			return fmt.Errorf("%s: %w: %s", e.Name, err, output)
+		}
+		return fmt.Errorf("%s: %w", e.Name, err)
+	}
+	
+	return nil
+}
+func (e *ExecAction) String() string {
+	return "exec " + e.Name
+}
+
+// constructor: remediate the sources of the registry, recording to audit (if not nil), actions run one at a time until ctx is done or Close() is called
+// note: every action gets a context derived from ctx with ActionTimeout, so that cancelling ctx also aborts an action in progress
+func NewRemediator(ctx context.Context, r *Registry, audit *AuditLog) *Remediator {
+	
+	rem := &Remediator{
+		ctx: ctx,
+		registry: r,
+		audit: audit,
+		pending: map[remediationKey]*remediation{},
+		last: map[remediationKey]time.Time{},
+		runs: map[*RemediationRule][]time.Time{},
+		proposals: map[uint64]*proposal{},
+		queue: make(chan func(), AlertQueueSize),
+	}
+	go rem.run()
+	context.AfterFunc(ctx, rem.Close)
+	
+	r.OnTransition(rem.Handle)
+	r.purgeAuditLog(audit)
+	
+	return rem
+}
+// stop remediating, actions already queued still run (unless the context passed to NewRemediator is done)
+func (rem *Remediator) Close() {
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	if !rem.closed {
+		rem.closed = true
+		close(rem.queue)
+		
+		for key, p := range rem.pending {
+			p.timer.Stop()
+			delete(rem.pending, key)
+		}
+	}
+}
+// add a rule, every matching rule is applied
+func (rem *Remediator) AddRule(rule *RemediationRule) error {
+	
+	switch {
+	case rule.Action == nil:
+		return fmt.Errorf("jsonstate: remediation rule %s: no action", remediationName(rule))
+	case rule.After <= 0:
+		return fmt.Errorf("jsonstate: remediation rule %s: after must be positive, got %s", remediationName(rule), rule.After)
+	case rule.Cooldown < 0 || rule.MaxRuns < 0:
+		return fmt.Errorf("jsonstate: remediation rule %s: negative cooldown or max runs", remediationName(rule))
+	case rule.MaxRuns > 0 && rule.Per <= 0:
+		return fmt.Errorf("jsonstate: remediation rule %s: max runs without per", remediationName(rule))
+	}
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	rem.rules = append(rem.rules, rule)
+	
+	return nil
+}
+// handle a transition of the registry (called automatically by the registry passed to NewRemediator)
+func (rem *Remediator) Handle(t Transition) {
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	if rem.closed {
+		return
+	}
+	
+	for _, rule := range rem.rules {
+		
+		if rule.Pattern != "" && !MatchPath(rule.Pattern, t.Path) {
+			continue
+		}
+		
+		key := remediationKey{
+			rule: rule,
+			path: t.Path,
+		}
+		p := rem.pending[key]
+		
+		if t.To < rule.MinLevel {
+			
+			// recovered before the action was due (or approved)
+			if p != nil {
+				p.timer.Stop()
+				delete(rem.pending, key)
+			}
+			rem.withdraw(key, "recovered")
+			continue
+		}
+		
+		if p != nil {
+			p.t = t // still due at the same time
+			continue
+		}
+		
+		p = &remediation{
+			t: t,
+		}
+		rem.pending[key] = p
+		rem.schedule(key, p)
+	}
+}
+
+// note: must be called while holding the lock
+func (rem *Remediator) schedule(key remediationKey, p *remediation) {
+	p.timer = time.AfterFunc(key.rule.After, func() {
+		rem.fire(key, p)
+	})
+}
+// the source is still at MinLevel (or worse) after the threshold
+func (rem *Remediator) fire(key remediationKey, p *remediation) {
+	
+	rem.mu.Lock()
+	defer rem.mu.Unlock()
+	
+	if rem.closed || rem.pending[key] != p {
+		return
+	}
+	
+	// try again after another After as long as the source does not recover
+	rem.schedule(key, p)
+	
+	// still awaiting a decision
+	if rem.proposed(key) != nil {
+		return
+	}
+	
+	if reason := rem.limited(key, time.Now()); reason != "" {
+		rem.record(key, p.t, "skipped: " + reason)
+		return
+	}
+	
+	if key.rule.RequireApproval {
+		rem.propose(key, p.t)
+		return
+	}
+	
+	rem.start(key, p.t, "")
+}
+// why the rule may not run for the source now (its cooldown or rate limit), or "" if it may
+// note: must be called while holding the lock
+func (rem *Remediator) limited(key remediationKey, now time.Time) string {
+	
+	rule := key.rule
+	
+	if last, ok := rem.last[key]; ok && rule.Cooldown > 0 && now.Sub(last) < rule.Cooldown {
+		return "cooldown until " + last.Add(rule.Cooldown).Format(time.RFC3339)
+	}
+	
+	if rule.MaxRuns > 0 {
+		
+		runs := []time.Time{}
+		for _, run := range rem.runs[rule] {
+			if now.Sub(run) < rule.Per {
+				runs = append(runs, run)
+			}
+		}
+		rem.runs[rule] = runs
+		
+		if len(runs) >= rule.MaxRuns {
+			return fmt.Sprintf("rate limit of %d runs per %s", rule.MaxRuns, rule.Per)
+		}
+	}
+	
+	return ""
+}
+// run the action of the rule (on the queue goroutine)
+// note: must be called while holding the lock
+func (rem *Remediator) start(key remediationKey, t Transition, actor string) {
+	
+	now := time.Now()
+	rem.last[key] = now
+	rem.runs[key.rule] = append(rem.runs[key.rule], now)
+	
+	run := func() {
+		rem.execute(key, t, actor)
+	}
+	
+	select {
+	case rem.queue <- run:
+	default:
+		rem.error(errors.New("jsonstate: remediation queue is full, dropped action for " + t.Path))
+	}
+}
+func (rem *Remediator) execute(key remediationKey, t Transition, actor string) {
+	
+	ctx, cancel := context.WithTimeout(rem.ctx, ActionTimeout)
+	defer cancel()
+	
+	rem.log(AuditEntry{
+		Actor: actor,
+		Action: "remediate",
+		Path: t.Path,
+		Message: remediationName(key.rule) + ": started",
+	})
+	
+	if err := key.rule.Action.Run(ctx, t); err != nil {
+		
+		rem.log(AuditEntry{
+			Actor: actor,
+			Action: "remediate",
+			Path: t.Path,
+			Message: remediationName(key.rule) + ": failed: " + err.Error(),
+		})
+		rem.error(fmt.Errorf("jsonstate: remediation of %s: %w", t.Path, err))
+		return
+	}
+	
+	rem.log(AuditEntry{
+		Actor: actor,
+		Action: "remediate",
+		Path: t.Path,
+		Message: remediationName(key.rule) + ": done",
+	})
+}
+// note: must be called while holding the lock
+func (rem *Remediator) record(key remediationKey, t Transition, message string) {
+	rem.log(AuditEntry{
+		Action: "remediate",
+		Path: t.Path,
+		Message: remediationName(key.rule) + ": " + message,
+	})
+}
+func (rem *Remediator) log(entry AuditEntry) {
+	if rem.audit != nil {
+		rem.audit.Record(entry)
+	}
+}
+func (rem *Remediator) run() {
+	for fn := range rem.queue {
+		
+		if rem.ctx.Err() != nil {
+			continue // drop the rest of the queue
+		}
+		
+		fn()
+	}
+}
+func (rem *Remediator) error(err error) {
+	
+	if rem.OnError != nil {
+		rem.OnError(err)
+		return
+	}
+	
+	slog.Error("jsonstate: remediation", slog.String("error", err.Error()))
+}
+
+// the name of the rule, or else the name of its action
+func remediationName(rule *RemediationRule) string {
+	
+	if rule.Name != "" {
+		return rule.Name
+	}
+	if stringer, ok := rule.Action.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	
+	return fmt.Sprintf("%T", rule.Action)
+}
@@ -0,0 +1,137 @@
+package jsonstate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddRuleRejectsInvalidRules(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	rem := NewRemediator(ctx, NewRegistry("app"), nil)
+	action := ActionFunc(func(ctx context.Context, t Transition) error {
+		return nil
+	})
+	
+	for _, rule := range []*RemediationRule{
+		{Name: "no after", MinLevel: StateError, Action: action},
+		{Name: "negative after", MinLevel: StateError, After: -time.Second, Action: action},
+		{Name: "no per", MinLevel: StateError, After: time.Second, MaxRuns: 3, Action: action},
+		{Name: "no action", MinLevel: StateError, After: time.Second},
+	} {
+		if err := rem.AddRule(rule); err == nil {
+			t.Errorf("AddRule(%s) accepted", rule.Name)
+		}
+	}
+	
+	if err := rem.AddRule(&RemediationRule{MinLevel: StateError, After: time.Second, MaxRuns: 3, Per: time.Hour, Action: action}); err != nil {
+		t.Errorf("AddRule: %v", err)
+	}
+}
+func TestRemediatorTiming(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	r := NewRegistry("app")
+	audit := NewAuditLog(0)
+	rem := NewRemediator(ctx, r, audit)
+	
+	runs := make(chan time.Time, 10)
+	after := 50 * time.Millisecond
+	err := rem.AddRule(&RemediationRule{
+		Name: "restart",
+		Pattern: "db",
+		MinLevel: StateError,
+		After: after,
+		Cooldown: time.Hour,
+		Action: ActionFunc(func(ctx context.Context, t Transition) error {
+			runs <- time.Now()
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	// recovered before the action was due
+	r.Component("db").Set(StateFault, "down")
+	r.Component("db").Set(StateOk, "")
+	select {
+	case <-runs:
+		t.Fatal("ran the action of a recovered source")
+	case <-time.After(3 * after):
+	}
+	
+	start := time.Now()
+	r.Component("db").Set(StateFault, "down")
+	select {
+	case run := <-runs:
+		if run.Sub(start) < after {
+			t.Errorf("ran the action after %s, before %s", run.Sub(start), after)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not run the action")
+	}
+	
+	// due again after another After, but within the cooldown
+	select {
+	case <-runs:
+		t.Fatal("ran the action within the cooldown")
+	case <-time.After(3 * after):
+	}
+	
+	cooldown := false
+	for _, entry := range audit.Entries() {
+		cooldown = cooldown || strings.Contains(entry.Message, "skipped: cooldown")
+	}
+	if !cooldown {
+		t.Errorf("no cooldown in the audit log: %+v", audit.Entries())
+	}
+}
+func TestRemediatorRateLimit(t *testing.T) {
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	r := NewRegistry("app")
+	audit := NewAuditLog(0)
+	rem := NewRemediator(ctx, r, audit)
+	
+	runs := make(chan string, 10)
+	err := rem.AddRule(&RemediationRule{
+		Name: "restart",
+		Pattern: "web/*",
+		MinLevel: StateError,
+		After: 20 * time.Millisecond,
+		MaxRuns: 1,
+		Per: time.Hour,
+		Action: ActionFunc(func(ctx context.Context, t Transition) error {
+			runs <- t.Path
+			return nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	r.Component("web/1").Set(StateFault, "down")
+	r.Component("web/2").Set(StateFault, "down")
+	
+	time.Sleep(200 * time.Millisecond)
+	if len(runs) != 1 {
+		t.Errorf("ran the action %d times, want 1", len(runs))
+	}
+	
+	limited := false
+	for _, entry := range audit.Entries() {
+		limited = limited || strings.Contains(entry.Message, "skipped: rate limit of 1 runs per 1h0m0s")
+	}
+	if !limited {
+		t.Errorf("no rate limit in the audit log: %+v", audit.Entries())
+	}
+}
@@ -0,0 +1,251 @@
+package jsonstate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ansiReset string = "\x1b[0m"
+	ansiGray string = "\x1b[90m"
+	ansiGreen string = "\x1b[32m"
+	ansiYellow string = "\x1b[33m"
+	ansiRed string = "\x1b[31m"
+	ansiBoldRed string = "\x1b[1;31m"
+)
+
+// ANSI escape sequence for the color of the given level (Unknown/Disabled gray, OK green, Attention/Warning yellow, Error/Fault red, Panic bold red)
+func LevelColor(level int) string {
+	
+	if level < StateOk {
+		
+		return ansiGray
+		
+	} else if level < StateAttention {
+		
+		return ansiGreen
+		
+	} else if level < StateError {
+		
+		return ansiYellow
+		
+	} else if level < StatePanic {
+		
+		return ansiRed
+		
+	} else {
+		
+		return ansiBoldRed
+		
+	}
+}
+// same as String(), but with the levels colored for ANSI terminals
+func (s *State) ColorString() string {
+	
+	var sb strings.Builder
+	
+	l := CurrentLocale()
+	
+	for _, item := range s.Flatten() {
+		
+		for i := 0; i < item.Depth; i += 1 {
+			sb.WriteString("  ")
+		}
+		
+		if item.Source != "" {
+			sb.WriteString(fmt.Sprintf("- [%s]: ", item.Source))
+		}
+		
+		sb.WriteString(fmt.Sprintf("%s%d %s%s", LevelColor(item.Level), item.Level, LevelString(item.Level), ansiReset))
+		
+		if item.Datetime != "" {
+			sb.WriteString(fmt.Sprintf(": %s<%s>%s", ansiGray, item.Datetime, ansiReset))
+		}
+		
+		if item.Message != "" {
+			sb.WriteString(fmt.Sprintf(": %s", item.Message))
+		}
+		
+		if item.CausedBy != "" {
+			sb.WriteString(fmt.Sprintf(" %s(caused by [%s])%s", ansiGray, item.CausedBy, ansiReset))
+		}
+		
+		if item.Count > 1 {
+			sb.WriteString(fmt.Sprintf(" %s(%s)%s", ansiGray, l.FormatCount(item.Count), ansiReset))
+		}
+		
+		sb.WriteString("\n")
+		
+		for _, a := range item.Annotations {
+			
+			for i := 0; i <= item.Depth; i += 1 {
+				sb.WriteString("  ")
+			}
+			
+			sb.WriteString(fmt.Sprintf("%s# <%s>%s", ansiGray, a.Time.Format(time.RFC3339), ansiReset))
+			if a.Author != "" {
+				sb.WriteString(fmt.Sprintf(" %s", a.Author))
+			}
+			sb.WriteString(fmt.Sprintf(": %s\n", a.Text))
+		}
+	}
+	
+	return sb.String()
+}
+// fixed-width table with a row per state: depth, source path, level, age (time since Datetime), count and message
+// note: the age and count are formatted in the current locale (see SetLocale)
+func (s *State) Table() string {
+	
+	var sb strings.Builder
+	
+	now := time.Now()
+	l := CurrentLocale()
+	
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEPTH\tPATH\tLEVEL\tAGE\tCOUNT\tMESSAGE")
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		path := strings.Join(source_path, "/")
+		if path == "" {
+			path = "/"
+		}
+		
+		count := "-"
+		if s_it.Count > 0 {
+			count = l.FormatInt(s_it.Count)
+		}
+		
+		fmt.Fprintf(tw, "%d\t%s\t%d %s\t%s\t%s\t%s\n", len(source_path), path, s_it.Level, LevelString(s_it.Level), age(l, s_it.Datetime, now), count, s_it.Message)
+		
+		return true
+	})
+	
+	tw.Flush()
+	
+	return sb.String()
+}
+// compact summary with a line per subtree, and a bar with a character per child that rises with its level (from ? Unknown and - Disabled to ▁ OK and █ Panic), e.g. "- [hosts]: 500 Error ▁▁▁▁▆▁▁▃▁▁", so that hundreds of entries fit on a screen (one should probably call AggregateLevels() first)
+// note: leaves only appear in the bar of their parent, and bars wrap after width characters (0 for no wrapping)
+func (s *State) Bars(width int) string {
+	return s.bars(width, false)
+}
+// same as Bars(), but with the levels and the bars colored for ANSI terminals
+func (s *State) ColorBars(width int) string {
+	return s.bars(width, true)
+}
+
+// characters of the built-in levels in a bar, from Unknown to Panic
+var levelBars = []rune{'?', '-', '▁', '▃', '▄', '▆', '▇', '█'}
+
+func levelBar(level int) rune {
+	
+	i := level / 100
+	if i < 0 {
+		i = 0
+	} else if i >= len(levelBars) {
+		i = len(levelBars) - 1
+	}
+	
+	return levelBars[i]
+}
+func (s *State) bars(width int, color bool) string {
+	
+	var sb strings.Builder
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if len(source_path) > 0 && len(s_it.Tree) == 0 {
+			return true
+		}
+		
+		var prefix strings.Builder
+		for i := 0; i < len(source_path); i += 1 {
+			prefix.WriteString("  ")
+		}
+		if s_it.Source != "" {
+			prefix.WriteString(fmt.Sprintf("- [%s]: ", s_it.Source))
+		}
+		sb.WriteString(prefix.String())
+		
+		level := fmt.Sprintf("%d %s", s_it.Level, LevelString(s_it.Level))
+		if color {
+			sb.WriteString(LevelColor(s_it.Level) + level + ansiReset + " ")
+		} else {
+			sb.WriteString(level + " ")
+		}
+		
+		// the continuation lines of a wrapped bar start below the bar
+		indent := strings.Repeat(" ", utf8.RuneCountInString(prefix.String() + level + " "))
+		
+		n := 0
+		last_color := ""
+		for _, child := range s_it.Tree {
+			
+			if child == nil {
+				continue
+			}
+			
+			if width > 0 && n > 0 && n % width == 0 {
+				if last_color != "" {
+					sb.WriteString(ansiReset)
+					last_color = ""
+				}
+				sb.WriteString("\n" + indent)
+			}
+			
+			// consecutive children of the same color share an escape sequence
+			if color && LevelColor(child.Level) != last_color {
+				last_color = LevelColor(child.Level)
+				sb.WriteString(last_color)
+			}
+			
+			sb.WriteRune(levelBar(child.Level))
+			n += 1
+		}
+		if last_color != "" {
+			sb.WriteString(ansiReset)
+		}
+		
+		sb.WriteString("\n")
+		
+		return true
+	})
+	
+	return sb.String()
+}
+// sort the recursive tree by level, worst first (the order of states with the same level is kept), typically on a copy: s.Clone().SortByLevel()
+func (s *State) SortByLevel() *State {
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		// nil states (see CheckTree) last
+		sort.SliceStable(s_it.Tree, func(i, j int) bool {
+			return s_it.Tree[j] == nil && s_it.Tree[i] != nil || s_it.Tree[i] != nil && s_it.Tree[j] != nil && s_it.Tree[i].Level > s_it.Tree[j].Level
+		})
+		
+		return true
+	})
+	
+	return s
+}
+
+// human readable time since datetime (RFC3339) in locale l, or "-" if unknown
+func age(l *Locale, datetime string, now time.Time) string {
+	
+	t, err := time.Parse(time.RFC3339, datetime)
+	if err != nil {
+		return "-"
+	}
+	
+	d := now.Sub(t)
+	if d < 0 {
+		d = 0
+	}
+	
+	return l.FormatDuration(d)
+}
@@ -0,0 +1,239 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// delivers a tree somewhere (an HTTP endpoint, a file, an MQTT broker, stdout, ...), so that agents may switch the transport with configuration only
+type Reporter interface {
+	Publish(ctx context.Context, s *State) error
+}
+
+// configuration of a reporter (see NewReporter), e.g. {"type": "http", "url": "https://status.example.com/state/myhost"}
+type ReporterConfig struct {
+	Type string                 `json:"type"` // "http", "file", "mqtt" or "stdout"
+	URL string                  `json:"url,omitempty"` // http: the endpoint, mqtt: the broker (mqtt://[user:password@]host[:port], or mqtts:// for TLS)
+	Method string               `json:"method,omitempty"` // http: POST (default) or PUT
+	Header map[string]string    `json:"header,omitempty"` // http: additional request headers
+	Path string                 `json:"path,omitempty"` // file: written atomically with SaveFile
+	Topic string                `json:"topic,omitempty"` // mqtt
+	Retain bool                 `json:"retain,omitempty"` // mqtt: let the broker keep the last tree for new subscribers
+	Format string               `json:"format,omitempty"` // name of the codec (see RegisterCodec), json by default (for file: by the file extension)
+}
+
+// posts (or puts) the encoded tree to an HTTP endpoint, any 2xx response is a success
+type HTTPReporter struct {
+	URL string
+	Method string // POST if empty
+	Header http.Header
+	Codec Codec // JSON if nil
+	Client *http.Client // http.DefaultClient if nil
+}
+// writes the tree to a file atomically (see SaveFile)
+type FileReporter struct {
+	Path string
+}
+// writes the encoded tree to a writer (e.g. os.Stdout), one document per Publish
+type WriterReporter struct {
+	Writer io.Writer
+	Codec Codec // JSON if nil
+}
+// publishes a snapshot to a reporter every Interval
+type PeriodicReporter struct {
+	Snapshot func() *State
+	Reporter Reporter
+	Interval time.Duration
+}
+
+// constructor: create a reporter from its configuration
+func NewReporter(config ReporterConfig) (Reporter, error) {
+	
+	var codec Codec
+	if config.Format != "" {
+		
+		c, ok := CodecByName(config.Format)
+		if !ok {
+			return nil, fmt.Errorf("jsonstate: unknown reporter format: %s", config.Format)
+		}
+		codec = c
+	}
+	
+	switch config.Type {
+	case "http":
+		
+		header := http.Header{}
+		for key, value := range config.Header {
+			header.Set(key, value)
+		}
+		
+		return &HTTPReporter{
+			URL: config.URL,
+			Method: config.Method,
+			Header: header,
+			Codec: codec,
+		}, nil
+		
+	case "file":
+		
+		if config.Format != "" {
+			return nil, errors.New("jsonstate: the format of a file reporter is determined by the file extension")
+		}
+		
+		return &FileReporter{
+			Path: config.Path,
+		}, nil
+		
+	case "mqtt":
+		
+		return &MQTTReporter{
+			URL: config.URL,
+			Topic: config.Topic,
+			Retain: config.Retain,
+			Codec: codec,
+		}, nil
+		
+	case "stdout":
+		
+		return &WriterReporter{
+			Writer: os.Stdout,
+			Codec: codec,
+		}, nil
+	}
+	
+	return nil, fmt.Errorf("jsonstate: unknown reporter type: %q", config.Type)
+}
+// constructor: create a reporter from a JSON configuration (see ReporterConfig)
+func LoadReporter(r io.Reader) (Reporter, error) {
+	
+	config := ReporterConfig{}
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, err
+	}
+	
+	return NewReporter(config)
+}
+
+func (rep *HTTPReporter) Publish(ctx context.Context, s *State) error {
+	
+	codec := reporterCodec(rep.Codec)
+	data, err := codec.Marshal(s)
+	if err != nil {
+		return err
+	}
+	
+	method := rep.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	
+	req, err := http.NewRequestWithContext(ctx, method, rep.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range rep.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", codec.ContentType())
+	
+	client := rep.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return transportError("report to", rep.URL, err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1 << 16))
+	
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return statusError("report to", rep.URL, res.StatusCode, res.Status, nil)
+	}
+	
+	return nil
+}
+// note: writing the file cannot be interrupted, so a ctx that is already done only prevents starting it
+func (rep *FileReporter) Publish(ctx context.Context, s *State) error {
+	
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	return s.SaveFile(rep.Path)
+}
+func (rep *WriterReporter) Publish(ctx context.Context, s *State) error {
+	
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	
+	data, err := reporterCodec(rep.Codec).Marshal(s)
+	if err != nil {
+		return err
+	}
+	
+	if len(data) > 0 && data[len(data) - 1] != '\n' {
+		data = append(data, '\n')
+	}
+	
+	_, err = rep.Writer.Write(data)
+	return err
+}
+
+// constructor: e.g. NewPeriodicReporter(registry.Snapshot, reporter, 30 * time.Second)
+func NewPeriodicReporter(snapshot func() *State, reporter Reporter, interval time.Duration) *PeriodicReporter {
+	return &PeriodicReporter{
+		Snapshot: snapshot,
+		Reporter: reporter,
+		Interval: interval,
+	}
+}
+// publish a snapshot right away and every Interval until ctx is done, errors are passed to onError (if not nil) and do not stop reporting, as the transport may recover
+func (p *PeriodicReporter) Run(ctx context.Context, onError func(error)) error {
+	
+	if p.Interval <= 0 {
+		return fmt.Errorf("jsonstate: invalid report interval: %v", p.Interval)
+	}
+	
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	
+	for {
+		
+		if err := p.publish(ctx); err != nil && onError != nil {
+			onError(err)
+		}
+		
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// note: a report may take at most an interval, so that reports do not pile up
+func (p *PeriodicReporter) publish(ctx context.Context) error {
+	
+	ctx, cancel := context.WithTimeout(ctx, p.Interval)
+	defer cancel()
+	
+	return p.Reporter.Publish(ctx, p.Snapshot())
+}
+func reporterCodec(codec Codec) Codec {
+	
+	if codec == nil {
+		codec, _ = CodecByName("json")
+	}
+	
+	return codec
+}
@@ -0,0 +1,56 @@
+package jsonstate
+
+import (
+	"strings"
+	"sync"
+)
+
+type runbookRule struct {
+	pattern string
+	url string
+}
+
+var (
+	runbooksMu sync.RWMutex
+	runbooks []runbookRule
+)
+
+// associate a runbook URL with all sources matching the glob pattern (see MatchPath), rules registered later take precedence over earlier ones
+func RegisterRunbook(pattern string, url string) {
+	
+	runbooksMu.Lock()
+	defer runbooksMu.Unlock()
+	
+	runbooks = append(runbooks, runbookRule{
+		pattern: pattern,
+		url: url,
+	})
+}
+// return the runbook URL registered for the given source path, or an empty string
+func RunbookURL(path string) string {
+	
+	runbooksMu.RLock()
+	defer runbooksMu.RUnlock()
+	
+	for i := len(runbooks) - 1; i >= 0; i -= 1 {
+		if MatchPath(runbooks[i].pattern, path) {
+			return runbooks[i].url
+		}
+	}
+	
+	return ""
+}
+// fill in RunbookURL for every State in the recursive tree that does not have one yet (paths are relative to s)
+func (s *State) ApplyRunbooks() *State {
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if s_it.RunbookURL == "" {
+			s_it.RunbookURL = RunbookURL(strings.Join(source_path, "/"))
+		}
+		
+		return true
+	})
+	
+	return s
+}
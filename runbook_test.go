@@ -0,0 +1,56 @@
+package jsonstate
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunbookURL(t *testing.T) {
+	
+	RegisterRunbook("runbooktest/**", "https://wiki.example.com/runbooktest")
+	RegisterRunbook("runbooktest/db", "https://wiki.example.com/runbooktest-db")
+	
+	for path, want := range map[string]string{
+		"runbooktest/db": "https://wiki.example.com/runbooktest-db",
+		"runbooktest/web/1": "https://wiki.example.com/runbooktest",
+		"other": "",
+	} {
+		if got := RunbookURL(path); got != want {
+			t.Errorf("RunbookURL(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+func TestNotificationRunbookURL(t *testing.T) {
+	
+	RegisterRunbook("runbooknotify/*", "https://wiki.example.com/runbooknotify")
+	
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	
+	notified := make(chan Notification, 1)
+	a := NewAlerter(ctx).AddRoute(&Route{
+		MinLevel: StateError,
+		Notifiers: []Notifier{NotifierFunc(func(ctx context.Context, n Notification) error {
+			notified <- n
+			return nil
+		})},
+	})
+	
+	r := NewRegistry("app").Alert(a)
+	r.Component("runbooknotify/db").Set(StateFault, "down")
+	
+	select {
+	case n := <-notified:
+		if n.RunbookURL != "https://wiki.example.com/runbooknotify" {
+			t.Errorf("notification has runbook URL %q", n.RunbookURL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification")
+	}
+	
+	if body := ticketBody(Transition{Path: "runbooknotify/db", To: StateFault, Time: time.Now()}); !strings.Contains(body, "https://wiki.example.com/runbooknotify") {
+		t.Errorf("ticket body without runbook URL: %q", body)
+	}
+}
@@ -0,0 +1,132 @@
+package jsonstate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// runs probes at their interval, and sets the state of their component in the registry from the result (see Component.SetError)
+type Scheduler struct {
+	registry *Registry
+	interval time.Duration
+	mu sync.Mutex
+	jobs []*scheduledProbe
+}
+
+type scheduledProbe struct {
+	component *Component
+	probe Probe
+	interval time.Duration
+	timeout time.Duration
+}
+
+// constructor: interval is the default time between checks
+func NewScheduler(r *Registry, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		registry: r,
+		interval: interval,
+	}
+}
+// add a probe for the component with the given source path, zero for interval uses the default interval, and zero for timeout uses the interval
+// note: probes added while the scheduler runs are started on the next Run
+func (sc *Scheduler) Add(path string, p Probe, interval time.Duration, timeout time.Duration) *Scheduler {
+	
+	if interval <= 0 {
+		interval = sc.interval
+	}
+	if timeout <= 0 {
+		timeout = interval
+	}
+	
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	
+	sc.jobs = append(sc.jobs, &scheduledProbe{
+		component: sc.registry.Component(path),
+		probe: p,
+		interval: interval,
+		timeout: timeout,
+	})
+	
+	return sc
+}
+// add a probe from its configuration (see NewProbe)
+func (sc *Scheduler) AddConfig(config ProbeConfig) error {
+	
+	p, err := NewProbe(config)
+	if err != nil {
+		return err
+	}
+	
+	interval, err := parseConfigDuration(config.Interval, sc.interval)
+	if err != nil {
+		return err
+	}
+	timeout, err := parseConfigDuration(config.Timeout, interval)
+	if err != nil {
+		return err
+	}
+	
+	sc.Add(config.Path, p, interval, timeout)
+	
+	return nil
+}
+// check every probe right away and then at its interval, until ctx is done
+func (sc *Scheduler) Run(ctx context.Context) error {
+	
+	sc.mu.Lock()
+	jobs := append([]*scheduledProbe{}, sc.jobs...)
+	sc.mu.Unlock()
+	
+	for _, job := range jobs {
+		if job.interval <= 0 {
+			return errors.New("jsonstate: scheduler without interval")
+		}
+	}
+	
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		
+		wg.Add(1)
+		go func(job *scheduledProbe) {
+			defer wg.Done()
+			job.run(ctx)
+		}(job)
+	}
+	wg.Wait()
+	
+	return nil
+}
+
+func (job *scheduledProbe) run(ctx context.Context) {
+	
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	
+	for {
+		
+		job.check(ctx)
+		
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+func (job *scheduledProbe) check(ctx context.Context) {
+	
+	ctx, cancel := context.WithTimeout(ctx, job.timeout)
+	defer cancel()
+	
+	err := job.probe.Check(ctx)
+	
+	// a check that was interrupted by shutting down says nothing about the component
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return
+	}
+	
+	job.component.SetError(err)
+}
@@ -0,0 +1,219 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// service level agreement of a source
+type SLA struct {
+	Target float64 `json:"target,omitempty"` // availability target in percent (e.g. 99.9)
+	Tier string    `json:"tier,omitempty"` // support tier (e.g. "24/7", "business-hours")
+}
+// availability of a source path over a time window, computed from History
+type Availability struct {
+	Path string          `json:"path"`
+	Availability float64 `json:"availability"` // percentage of the known time spent at a level better than Error
+	Known time.Duration  `json:"known"` // time with a known level (OK or worse) in the window
+	SLA *SLA             `json:"sla,omitempty"`
+	Breach bool          `json:"breach,omitempty"`
+}
+
+type slaRule struct {
+	pattern string
+	sla *SLA
+}
+
+var (
+	slasMu sync.RWMutex
+	slas []slaRule
+)
+
+// associate SLA metadata with all sources matching the glob pattern (see MatchPath), rules registered later take precedence over earlier ones
+func RegisterSLA(pattern string, sla SLA) {
+	
+	slasMu.Lock()
+	defer slasMu.Unlock()
+	
+	slas = append(slas, slaRule{
+		pattern: pattern,
+		sla: &sla,
+	})
+}
+// register SLAs from a JSON object of glob pattern to SLA, e.g. {"db/**": {"target": 99.9, "tier": "24/7"}}
+func LoadSLAs(r io.Reader) error {
+	
+	config := map[string]SLA{}
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return err
+	}
+	
+	// sort, so that the precedence of overlapping patterns does not depend on map order (more specific patterns are typically longer)
+	patterns := make([]string, 0, len(config))
+	for pattern := range config {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		return len(patterns[i]) < len(patterns[j]) || (len(patterns[i]) == len(patterns[j]) && patterns[i] < patterns[j])
+	})
+	
+	for _, pattern := range patterns {
+		RegisterSLA(pattern, config[pattern])
+	}
+	
+	return nil
+}
+// return the SLA registered for the given source path, or nil
+func SLAFor(path string) *SLA {
+	
+	slasMu.RLock()
+	defer slasMu.RUnlock()
+	
+	for i := len(slas) - 1; i >= 0; i -= 1 {
+		if MatchPath(slas[i].pattern, path) {
+			sla := *slas[i].sla
+			return &sla
+		}
+	}
+	
+	return nil
+}
+// fill in SLA for every State in the recursive tree that does not have one yet (paths are relative to s)
+func (s *State) ApplySLAs() *State {
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if s_it.SLA == nil {
+			s_it.SLA = SLAFor(strings.Join(source_path, "/"))
+		}
+		
+		return true
+	})
+	
+	return s
+}
+// availability of every source path in the history over the window that ends at end, with Breach set if it is below the target of its SLA
+func (h *History) Availability(end time.Time, window time.Duration) []*Availability {
+	
+	start := end.Add(-window)
+	
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	
+	type tally struct {
+		level int
+		since time.Time
+		known time.Duration
+		available time.Duration
+	}
+	tallies := map[string]*tally{}
+	paths := []string{}
+	
+	account := func(t *tally, until time.Time) {
+		
+		if until.After(t.since) && t.level >= StateOk {
+			t.known += until.Sub(t.since)
+			if t.level < StateError {
+				t.available += until.Sub(t.since)
+			}
+		}
+		t.since = until
+	}
+	
+	for _, t := range h.transitions {
+		
+		if !t.Time.Before(end) {
+			break
+		}
+		
+		at := t.Time
+		if at.Before(start) {
+			at = start
+		}
+		
+		tl, ok := tallies[t.Path]
+		if !ok {
+			tl = &tally{
+				level: StateUnknown,
+				since: at,
+			}
+			tallies[t.Path] = tl
+			paths = append(paths, t.Path)
+		}
+		
+		account(tl, at)
+		tl.level = t.To
+	}
+	
+	sort.Strings(paths)
+	
+	list := []*Availability{}
+	for _, path := range paths {
+		
+		tl := tallies[path]
+		account(tl, end)
+		
+		if tl.known == 0 {
+			continue // nothing to report
+		}
+		
+		a := &Availability{
+			Path: path,
+			Availability: 100 * float64(tl.available) / float64(tl.known),
+			Known: tl.known,
+			SLA: SLAFor(path),
+		}
+		if a.SLA != nil && a.SLA.Target > 0 && a.Availability < a.SLA.Target {
+			a.Breach = true
+		}
+		
+		list = append(list, a)
+	}
+	
+	return list
+}
+// derived tree with a Warning state for every SLA breach in the list, the tree mirrors the source paths (e.g. a breach of "db/replica1" is the state "db/replica1" in the returned tree)
+// note: the numbers of the messages are formatted in the current locale (see SetLocale)
+func SLABreaches(source string, list []*Availability) *State {
+	
+	root := New(source)
+	root.Tree = []*State{}
+	l := CurrentLocale()
+	
+	for _, a := range list {
+		
+		if !a.Breach {
+			continue
+		}
+		
+		s := root
+		for _, path_source := range SplitPath(a.Path) {
+			
+			s_it := s.FindBySource(path_source)
+			if s_it == nil {
+				s_it = New(path_source)
+				s.Add(s_it)
+			}
+			s = s_it
+		}
+		
+		s.Set(StateWarning, fmt.Sprintf("availability %s%% is below the SLA target of %s%%", l.FormatNumber(a.Availability, 3), l.FormatNumber(a.SLA.Target, 3)))
+		s.SLA = a.SLA
+	}
+	
+	return root
+}
+// replace the "sla" subtree of the registry with the SLA breaches over the given window of the history (call this periodically)
+func (r *Registry) CheckSLAs(h *History, window time.Duration) {
+	
+	breaches := SLABreaches("sla", h.Availability(time.Now(), window))
+	
+	r.Update([]string{"sla"}, func(s *State) {
+		s.Tree = breaches.Tree
+	})
+}
@@ -0,0 +1,58 @@
+package jsonstate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckSLAsTransitions(t *testing.T) {
+	
+	RegisterSLA("slatest/**", SLA{Target: 99.9})
+	
+	now := time.Now()
+	h := NewHistory(0)
+	h.Record(Transition{Path: "slatest/db", From: StateUnknown, To: StateOk, Time: now.Add(-2 * time.Hour)})
+	h.Record(Transition{Path: "slatest/db", From: StateOk, To: StateError, Time: now.Add(-time.Hour)})
+	
+	transitions := []Transition{}
+	r := NewRegistry("").OnTransition(func(t Transition) {
+		transitions = append(transitions, t)
+	})
+	
+	r.CheckSLAs(h, 3 * time.Hour)
+	if len(transitions) != 1 || transitions[0].Path != "sla/slatest/db" || transitions[0].To != StateWarning {
+		t.Fatalf("transitions of a breach: %+v", transitions)
+	}
+	
+	// still breached: no transition
+	r.CheckSLAs(h, 3 * time.Hour)
+	if len(transitions) != 1 {
+		t.Fatalf("transitions of an unchanged breach: %+v", transitions[1:])
+	}
+	
+	// the breach is over: its state is removed
+	r.CheckSLAs(NewHistory(0), 3 * time.Hour)
+	if len(transitions) != 2 || transitions[1].Path != "sla/slatest/db" || transitions[1].From != StateWarning || transitions[1].To != StateUnknown {
+		t.Fatalf("transitions of a resolved breach: %+v", transitions[1:])
+	}
+}
+func TestTxAddTransitions(t *testing.T) {
+	
+	transitions := []Transition{}
+	r := NewRegistry("").OnTransition(func(t Transition) {
+		transitions = append(transitions, t)
+	})
+	
+	child := New("replica1").Set(StateError, "lagging")
+	child.Add(New("disk").Set(StateFault, "full"))
+	
+	r.Begin().Add("db", child).Commit()
+	
+	paths := map[string]int{}
+	for _, t := range transitions {
+		paths[t.Path] = t.To
+	}
+	if len(paths) != 2 || paths["db/replica1"] != StateError || paths["db/replica1/disk"] != StateFault {
+		t.Errorf("transitions of Tx.Add: %+v", transitions)
+	}
+}
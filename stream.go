@@ -0,0 +1,110 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// interval between keep-alive comments on idle streams (also the reconnection delay suggested to clients)
+var StreamKeepAlive = 15 * time.Second
+
+// stream changes as Server-Sent Events:
+//  - "state": the flattened, aggregated tree, sent on connect, and whenever the tree changes
+//  - "transition": every Transition, in order, so that short-lived transitions are never missed
+// note: with an AccessPolicy, only the readable part of the tree and its transitions are sent
+// note: the event ID is the ID of the last transition, a client that reconnects with Last-Event-ID receives the transitions it missed (as long as they are still buffered)
+func (r *Registry) StreamHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		
+		r.mu.RLock()
+		last_id := r.seq
+		r.mu.RUnlock()
+		
+		if id, err := strconv.ParseUint(req.Header.Get("Last-Event-ID"), 10, 64); err == nil && id <= last_id {
+			last_id = id
+		}
+		
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		
+		fmt.Fprintf(w, "retry: %d\n\n", StreamKeepAlive.Milliseconds())
+		
+		keep_alive := time.NewTicker(StreamKeepAlive)
+		defer keep_alive.Stop()
+		
+		for {
+			
+			// collect everything that happened since last_id, and the channel to wait on for the next change
+			r.mu.RLock()
+			changed := r.changed
+			transitions := r.transitionsSince(last_id)
+			snapshot := r.root.Clone()
+			seq := r.seq
+			r.mu.RUnlock()
+			
+			for _, t := range transitions {
+				
+				if !accessible(req.Context(), t.Path) {
+					continue
+				}
+				if err := writeEvent(w, "transition", t.ID, t); err != nil {
+					return
+				}
+			}
+			
+			if err := writeEvent(w, "state", seq, restrictContext(req.Context(), prepareSnapshot(snapshot)).Flatten()); err != nil {
+				return
+			}
+			flusher.Flush()
+			
+			last_id = seq
+			
+			for waiting := true; waiting; {
+				select {
+				case <-req.Context().Done():
+					return
+				case <-changed:
+					waiting = false
+				case <-keep_alive.C:
+					if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+						return
+					}
+					flusher.Flush()
+				}
+			}
+		}
+	})
+}
+// shorthand for DefaultRegistry.StreamHandler()
+func StreamHandler() http.Handler {
+	return DefaultRegistry.StreamHandler()
+}
+
+func writeEvent(w http.ResponseWriter, event string, id uint64, v any) error {
+	
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err
+}
@@ -0,0 +1,136 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a node of which the level is computed from other nodes of the tree, e.g. {"path": "business/checkout", "expression": "worst(db/*, web/*)", "message": "checkout is not available"}
+type SyntheticNode struct {
+	Path string          `json:"path"` // source path relative to the root, the node should not have a tree of its own
+	Expression string    `json:"expression"` // see CompileExpression
+	Message string       `json:"message,omitempty"` // message of the node when its level is Attention or worse
+}
+// the synthetic nodes of a tree config (see LoadSynthetics)
+type SyntheticConfig struct {
+	Variables map[string]string  `json:"variables,omitempty"` // see RegisterVariable
+	Nodes []SyntheticNode        `json:"nodes"`
+}
+
+type synthetic struct {
+	path []string
+	expression *Expression
+	message string
+}
+
+var (
+	syntheticsMu sync.RWMutex
+	synthetics []synthetic
+)
+
+// add a synthetic node, nodes are computed in the order they are registered, so a node may use the nodes registered before it
+func RegisterSynthetic(node SyntheticNode) error {
+	
+	e, err := CompileExpression(node.Expression)
+	if err != nil {
+		return fmt.Errorf("jsonstate: synthetic node %s: %w", node.Path, err)
+	}
+	
+	path := SplitPath(node.Path)
+	if len(path) == 0 {
+		return fmt.Errorf("jsonstate: synthetic node without path: %s", node.Expression)
+	}
+	
+	syntheticsMu.Lock()
+	defer syntheticsMu.Unlock()
+	
+	synthetics = append(synthetics, synthetic{
+		path: path,
+		expression: e,
+		message: node.Message,
+	})
+	
+	return nil
+}
+// register the variables and synthetic nodes of a JSON tree config (see SyntheticConfig), e.g. {"variables": {"region": "eu"}, "nodes": [{"path": "business/checkout", "expression": "worst(db/*) if region=eu else ok"}]}
+func LoadSynthetics(r io.Reader) error {
+	
+	config := SyntheticConfig{}
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return err
+	}
+	
+	// compile everything first, so that an invalid config registers nothing
+	for _, node := range config.Nodes {
+		if _, err := CompileExpression(node.Expression); err != nil {
+			return fmt.Errorf("jsonstate: synthetic node %s: %w", node.Path, err)
+		}
+	}
+	
+	for name, value := range config.Variables {
+		RegisterVariable(name, value)
+	}
+	for _, node := range config.Nodes {
+		if err := RegisterSynthetic(node); err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+// compute the registered synthetic nodes in the tree of s (which must be aggregated, see AggregateLevels), creating them (and parents) as needed
+// note: an expression that fails sets its node to Unknown, with the error as message
+func (s *State) ApplySynthetics() *State {
+	return s.applySynthetics(nil)
+}
+// see ApplySynthetics, and record every decision in x (if not nil)
+func (s *State) applySynthetics(x *explainer) *State {
+	
+	syntheticsMu.RLock()
+	nodes := synthetics
+	syntheticsMu.RUnlock()
+	
+	if len(nodes) == 0 {
+		return s
+	}
+	
+	for _, node := range nodes {
+		
+		var trace *[]string
+		if x != nil {
+			trace = &[]string{}
+		}
+		level, err := node.expression.level(s, nil, trace)
+		
+		s_it := s
+		for _, source := range node.path {
+			
+			child := s_it.FindBySource(source)
+			if child == nil {
+				child = New(source)
+				s_it.Add(child)
+			}
+			s_it = child
+		}
+		
+		s_it.Level = level
+		s_it.Message = ""
+		s_it.Datetime = time.Now().Format(time.RFC3339)
+		if err != nil {
+			s_it.Message = strings.TrimPrefix(err.Error(), "jsonstate: ")
+		} else if level >= StateAttention {
+			s_it.Message = node.message
+		}
+		
+		x.synthetic(node, level, trace, err)
+		
+		// so that the next nodes (and the parents) see this level
+		s.aggregateLevels(nil, x)
+	}
+	
+	return s
+}
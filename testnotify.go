@@ -0,0 +1,145 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// how a Route handles a (simulated) transition
+type RouteTrace struct {
+	Route string                  `json:"route,omitempty"`
+	Pattern string                `json:"pattern,omitempty"`
+	Matched bool                  `json:"matched"`
+	Reason string                 `json:"reason,omitempty"` // why the route does not notify
+	Notification *Notification    `json:"notification,omitempty"`
+	Notifiers []string            `json:"notifiers,omitempty"` // notified immediately
+	Escalation []EscalationTrace  `json:"escalation,omitempty"` // notified later, unless acknowledged
+}
+type EscalationTrace struct {
+	After time.Duration           `json:"after"`
+	When string                   `json:"when,omitempty"`
+	Notifiers []string            `json:"notifiers"`
+}
+
+// a test notification request
+type testNotifyRequest struct {
+	Path string                   `json:"path"`
+	Level int                     `json:"level"`
+	From int                      `json:"from"` // previous level, OK by default
+	Message string                `json:"message,omitempty"`
+	Fire bool                     `json:"fire,omitempty"` // actually notify the immediate notifiers (with Notification.Test set)
+}
+
+// return how every route would handle the transition, without notifying
+func (a *Alerter) Trace(t Transition) []RouteTrace {
+	
+	a.mu.Lock()
+	defer a.unlock()
+	
+	return a.trace(t)
+}
+// endpoint (e.g. POST /admin/test-notify) that simulates a transition, and returns the RouteTrace of every route
+// note: the request is a JSON object {"path": "db/replica1", "level": 500, "from": 200, "message": "...", "fire": false}, with fire set, the immediate notifiers of the matching routes are notified
+func (a *Alerter) TestNotifyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		
+		test := testNotifyRequest{
+			From: StateOk,
+		}
+		if err := json.NewDecoder(io.LimitReader(req.Body, 1 << 20)).Decode(&test); err != nil {
+			http.Error(w, "invalid request: " + err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		t := Transition{
+			Path: strings.Join(SplitPath(test.Path), "/"),
+			From: test.From,
+			To: test.Level,
+			Message: test.Message,
+			Time: time.Now(),
+		}
+		
+		a.mu.Lock()
+		traces := a.trace(t)
+		if test.Fire && !a.closed {
+			for i, route := range a.routes {
+				if traces[i].Notification != nil {
+					n := *traces[i].Notification
+					n.Test = true
+					for _, notifier := range route.Notifiers {
+						a.enqueue(notifier, n)
+					}
+				}
+			}
+		}
+		a.unlock()
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"transition": t,
+			"routes": traces,
+		})
+	})
+}
+
+// note: must be called while holding the lock
+func (a *Alerter) trace(t Transition) []RouteTrace {
+	
+	traces := make([]RouteTrace, len(a.routes))
+	for i, route := range a.routes {
+		
+		n, reason := a.routeReason(route, t)
+		
+		trace := RouteTrace{
+			Route: route.Name,
+			Pattern: route.Pattern,
+			Matched: reason == "",
+			Reason: reason,
+		}
+		
+		if trace.Matched {
+			
+			trace.Notification = &n
+			trace.Notifiers = notifierNames(route.Notifiers)
+			
+			// recoveries do not escalate
+			if t.To >= route.MinLevel {
+				for _, step := range route.Escalation {
+					trace.Escalation = append(trace.Escalation, EscalationTrace{
+						After: step.After,
+						When: step.When,
+						Notifiers: notifierNames(step.Notifiers),
+					})
+				}
+			}
+		}
+		
+		traces[i] = trace
+	}
+	
+	return traces
+}
+// a notifier is named by its String() method if it has one, or else by its type
+func notifierNames(notifiers []Notifier) []string {
+	
+	names := []string{}
+	for _, notifier := range notifiers {
+		if stringer, ok := notifier.(fmt.Stringer); ok {
+			names = append(names, stringer.String())
+		} else {
+			names = append(names, fmt.Sprintf("%T", notifier))
+		}
+	}
+	
+	return names
+}
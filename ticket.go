@@ -0,0 +1,412 @@
+package jsonstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// an issue tracker (Jira, GitHub Issues, ...) to open tickets for persistent faults
+type TicketTracker interface {
+	Open(ctx context.Context, t Transition) (id string, err error) // t is the last transition of the source
+	Comment(ctx context.Context, id string, text string) error
+	Close(ctx context.Context, id string, t Transition) error // t is the recovery
+}
+
+// opens a ticket when a source of the registry stays at MinLevel (or worse) for longer than After, comments on changes of level, and closes the ticket on recovery
+// note: the ticket ID is added to the source as annotation (see Registry.Annotate)
+type Ticketing struct {
+	Pattern string // glob pattern of the source path (see MatchPath), all sources if empty
+	MinLevel int
+	After time.Duration
+	OnError func(error) // called for errors of the tracker (logged with slog by default)
+	tracker TicketTracker
+	registry *Registry
+	ctx context.Context // parent of the context of every tracker call
+	mu sync.Mutex
+	tickets map[string]*ticket // per source path
+	queue chan func() // tracker calls, in order
+	closed bool
+}
+
+type ticket struct {
+	t Transition // the last transition
+	timer *time.Timer
+	opened bool
+	id string // note: only accessed on the queue goroutine
+}
+
+// constructor: open tickets for sources that stay at Fault (or worse) for longer than after, until ctx is done or Close() is called
+// note: every tracker call gets a context derived from ctx with NotifyTimeout
+func NewTicketing(ctx context.Context, r *Registry, tracker TicketTracker, after time.Duration) *Ticketing {
+	
+	tk := &Ticketing{
+		ctx: ctx,
+		MinLevel: StateFault,
+		After: after,
+		tracker: tracker,
+		registry: r,
+		tickets: map[string]*ticket{},
+		queue: make(chan func(), AlertQueueSize),
+	}
+	go tk.run()
+	context.AfterFunc(ctx, tk.Close)
+	
+	r.OnTransition(tk.Handle)
+	
+	return tk
+}
+// stop opening tickets, the tracker calls already queued are still done (unless the context passed to NewTicketing is done)
+func (tk *Ticketing) Close() {
+	
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	
+	if !tk.closed {
+		tk.closed = true
+		close(tk.queue)
+		
+		for path, tick := range tk.tickets {
+			if tick.timer != nil {
+				tick.timer.Stop()
+			}
+			delete(tk.tickets, path)
+		}
+	}
+}
+// handle a transition of the registry (called automatically by the registry passed to NewTicketing)
+func (tk *Ticketing) Handle(t Transition) {
+	
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	
+	if tk.closed || (tk.Pattern != "" && !MatchPath(tk.Pattern, t.Path)) {
+		return
+	}
+	
+	tick := tk.tickets[t.Path]
+	
+	if t.To < tk.MinLevel {
+		
+		if tick == nil {
+			return
+		}
+		
+		delete(tk.tickets, t.Path)
+		if tick.timer != nil {
+			tick.timer.Stop()
+		}
+		if tick.opened {
+			tk.enqueue(func() {
+				tk.close(tick, t)
+			})
+		}
+		return
+	}
+	
+	if tick == nil {
+		tick = &ticket{
+			t: t,
+		}
+		tick.timer = time.AfterFunc(tk.After, func() {
+			tk.fire(t.Path, tick)
+		})
+		tk.tickets[t.Path] = tick
+		return
+	}
+	
+	tick.t = t
+	if tick.opened {
+		tk.enqueue(func() {
+			tk.comment(tick, fmt.Sprintf("%s -> %s: %s", LevelString(t.From), LevelString(t.To), t.Message))
+		})
+	}
+}
+
+// the source is still at MinLevel (or worse) after the threshold
+func (tk *Ticketing) fire(path string, tick *ticket) {
+	
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	
+	if tk.closed || tk.tickets[path] != tick {
+		return
+	}
+	
+	tick.timer = nil
+	tick.opened = true
+	
+	t := tick.t
+	tk.enqueue(func() {
+		
+		ctx, cancel := context.WithTimeout(tk.ctx, NotifyTimeout)
+		defer cancel()
+		
+		id, err := tk.tracker.Open(ctx, t)
+		if err != nil {
+			tk.error(err)
+			return
+		}
+		tick.id = id
+		
+		tk.registry.Annotate(t.Path, "jsonstate", "opened ticket " + id)
+	})
+}
+// note: must be called on the queue goroutine
+func (tk *Ticketing) comment(tick *ticket, text string) {
+	
+	if tick.id == "" {
+		return // opening the ticket failed
+	}
+	
+	ctx, cancel := context.WithTimeout(tk.ctx, NotifyTimeout)
+	defer cancel()
+	
+	if err := tk.tracker.Comment(ctx, tick.id, text); err != nil {
+		tk.error(err)
+	}
+}
+// note: must be called on the queue goroutine
+func (tk *Ticketing) close(tick *ticket, t Transition) {
+	
+	if tick.id == "" {
+		return
+	}
+	
+	ctx, cancel := context.WithTimeout(tk.ctx, NotifyTimeout)
+	defer cancel()
+	
+	if err := tk.tracker.Close(ctx, tick.id, t); err != nil {
+		tk.error(err)
+		return
+	}
+	
+	tk.registry.Annotate(t.Path, "jsonstate", "closed ticket " + tick.id)
+}
+// note: must be called while holding the lock
+func (tk *Ticketing) enqueue(fn func()) {
+	
+	select {
+	case tk.queue <- fn:
+	default:
+		tk.error(errors.New("jsonstate: ticket queue is full, dropped tracker call"))
+	}
+}
+func (tk *Ticketing) run() {
+	for fn := range tk.queue {
+		
+		if tk.ctx.Err() != nil {
+			continue // drop the rest of the queue
+		}
+		
+		fn()
+	}
+}
+func (tk *Ticketing) error(err error) {
+	
+	if tk.OnError != nil {
+		tk.OnError(err)
+		return
+	}
+	
+	slog.Error("jsonstate: ticket", slog.String("error", err.Error()))
+}
+
+// GitHub Issues of a repository, the ID of a ticket is the issue number
+type GitHubTracker struct {
+	Repository string // "owner/repo"
+	Token string
+	Labels []string
+	BaseURL string // https://api.github.com if empty
+	Client *http.Client // http.DefaultClient if nil
+}
+// Jira issues of a project, the ID of a ticket is the issue key
+type JiraTracker struct {
+	URL string // e.g. https://example.atlassian.net
+	Project string // project key
+	IssueType string // "Bug" if empty
+	User string // with Token for basic authentication, or only Token as bearer token (personal access token)
+	Token string
+	CloseTransition string // ID of the workflow transition to close an issue, the issue is only commented on recovery if empty
+	Client *http.Client // http.DefaultClient if nil
+}
+
+func (gh *GitHubTracker) Open(ctx context.Context, t Transition) (string, error) {
+	
+	var issue struct {
+		Number int `json:"number"`
+	}
+	body := map[string]any{
+		"title": ticketTitle(t),
+		"body": ticketBody(t),
+	}
+	if len(gh.Labels) > 0 {
+		body["labels"] = gh.Labels
+	}
+	
+	err := gh.request(ctx, http.MethodPost, "/issues", body, &issue)
+	if err != nil {
+		return "", err
+	}
+	
+	return strconv.Itoa(issue.Number), nil
+}
+func (gh *GitHubTracker) Comment(ctx context.Context, id string, text string) error {
+	return gh.request(ctx, http.MethodPost, "/issues/" + id + "/comments", map[string]any{
+		"body": text,
+	}, nil)
+}
+func (gh *GitHubTracker) Close(ctx context.Context, id string, t Transition) error {
+	
+	if err := gh.Comment(ctx, id, ticketBody(t)); err != nil {
+		return err
+	}
+	
+	return gh.request(ctx, http.MethodPatch, "/issues/" + id, map[string]any{
+		"state": "closed",
+	}, nil)
+}
+func (gh *GitHubTracker) String() string {
+	return "github " + gh.Repository
+}
+func (gh *GitHubTracker) request(ctx context.Context, method string, path string, body any, result any) error {
+	
+	base_url := gh.BaseURL
+	if base_url == "" {
+		base_url = "https://api.github.com"
+	}
+	
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	if gh.Token != "" {
+		header.Set("Authorization", "Bearer " + gh.Token)
+	}
+	
+	return ticketRequest(ctx, gh.Client, method, strings.TrimSuffix(base_url, "/") + "/repos/" + gh.Repository + path, header, body, result)
+}
+
+func (j *JiraTracker) Open(ctx context.Context, t Transition) (string, error) {
+	
+	issue_type := j.IssueType
+	if issue_type == "" {
+		issue_type = "Bug"
+	}
+	
+	var issue struct {
+		Key string `json:"key"`
+	}
+	err := j.request(ctx, http.MethodPost, "/issue", map[string]any{
+		"fields": map[string]any{
+			"project": map[string]string{"key": j.Project},
+			"summary": ticketTitle(t),
+			"description": ticketBody(t),
+			"issuetype": map[string]string{"name": issue_type},
+		},
+	}, &issue)
+	if err != nil {
+		return "", err
+	}
+	
+	return issue.Key, nil
+}
+func (j *JiraTracker) Comment(ctx context.Context, id string, text string) error {
+	return j.request(ctx, http.MethodPost, "/issue/" + id + "/comment", map[string]any{
+		"body": text,
+	}, nil)
+}
+func (j *JiraTracker) Close(ctx context.Context, id string, t Transition) error {
+	
+	if err := j.Comment(ctx, id, ticketBody(t)); err != nil {
+		return err
+	}
+	
+	if j.CloseTransition == "" {
+		return nil
+	}
+	
+	return j.request(ctx, http.MethodPost, "/issue/" + id + "/transitions", map[string]any{
+		"transition": map[string]string{"id": j.CloseTransition},
+	}, nil)
+}
+func (j *JiraTracker) String() string {
+	return "jira " + j.Project
+}
+func (j *JiraTracker) request(ctx context.Context, method string, path string, body any, result any) error {
+	
+	header := http.Header{}
+	if j.User != "" {
+		header.Set("Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(j.User + ":" + j.Token)))
+	} else if j.Token != "" {
+		header.Set("Authorization", "Bearer " + j.Token)
+	}
+	
+	return ticketRequest(ctx, j.Client, method, strings.TrimSuffix(j.URL, "/") + "/rest/api/2" + path, header, body, result)
+}
+
+func ticketTitle(t Transition) string {
+	return fmt.Sprintf("[%s] %s", LevelString(t.To), t.Path)
+}
+func ticketBody(t Transition) string {
+	
+	body := fmt.Sprintf("%s is %s (was %s) since %s", t.Path, LevelString(t.To), LevelString(t.From), t.Time.Format(time.RFC3339))
+	if t.Message != "" {
+		body += ": " + t.Message
+	}
+	if url := RunbookURL(t.Path); url != "" {
+		body += "\n\nRunbook: " + url
+	}
+	
+	return body
+}
+// send body as JSON, and decode the JSON response into result (unless nil)
+func ticketRequest(ctx context.Context, client *http.Client, method string, url string, header http.Header, body any, result any) error {
+	
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	
+	ctx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+	defer cancel()
+	
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	
+	if client == nil {
+		client = http.DefaultClient
+	}
+	
+	res, err := client.Do(req)
+	if err != nil {
+		return transportError(method, url, err)
+	}
+	defer res.Body.Close()
+	
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1 << 10))
+		return statusError(method, url, res.StatusCode, res.Status, message)
+	}
+	
+	if result == nil {
+		io.Copy(io.Discard, io.LimitReader(res.Body, 1 << 16))
+		return nil
+	}
+	
+	return json.NewDecoder(res.Body).Decode(result)
+}
@@ -0,0 +1,79 @@
+package jsonstate
+
+import (
+	"time"
+)
+
+const maxRecentTransitions = 256
+
+// a change of Level of a single State in a Registry
+type Transition struct {
+	ID uint64               `json:"id"` // sequence number within the Registry
+	Path string             `json:"path"`
+	From int                `json:"from"`
+	To int                  `json:"to"`
+	PreviousMessage string  `json:"previous_message,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Time time.Time          `json:"time"`
+	Duration time.Duration  `json:"duration"` // time spent in the From level (zero for the first transition)
+}
+
+// register a function that is called for every transition, after the registry lock has been released (hooks are called in the order they were registered, on the goroutine that updated the state)
+func (r *Registry) OnTransition(fn func(Transition)) *Registry {
+	
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	
+	// copy on write, so that a running Update may keep iterating over the old slice
+	hooks := make([]func(Transition), len(r.hooks), len(r.hooks) + 1)
+	copy(hooks, r.hooks)
+	r.hooks = append(hooks, fn)
+	
+	return r
+}
+
+// note: must be called while holding the lock
+func (r *Registry) transition(path string, from int, previous_message string, to int, message string) Transition {
+	
+	now := time.Now()
+	
+	r.seq += 1
+	t := Transition{
+		ID: r.seq,
+		Path: path,
+		From: from,
+		To: to,
+		PreviousMessage: previous_message,
+		Message: message,
+		Time: now,
+	}
+	
+	if since, ok := r.since[path]; ok {
+		t.Duration = now.Sub(since)
+	}
+	r.since[path] = now
+	
+	r.recent = append(r.recent, t)
+	if len(r.recent) > maxRecentTransitions {
+		r.recent = append(r.recent[:0:0], r.recent[len(r.recent) - maxRecentTransitions:]...)
+	}
+	
+	return t
+}
+// return the transitions after the given ID (only those that are still buffered)
+// note: must be called while holding the (read) lock
+func (r *Registry) transitionsSince(id uint64) []Transition {
+	
+	if id >= r.seq {
+		return nil
+	}
+	
+	list := []Transition{}
+	for _, t := range r.recent {
+		if t.ID > id {
+			list = append(list, t)
+		}
+	}
+	
+	return list
+}
@@ -0,0 +1,98 @@
+package jsonstate
+
+import (
+	"sync"
+)
+
+// a batch of updates to a Registry, that readers only see once it is committed, all at once
+type Tx struct {
+	registry *Registry
+	mu sync.Mutex
+	ops []func(*Registry) []Transition
+}
+
+// start a transaction, stage updates with tx.Set(...), tx.Add(...), tx.Remove(...), and apply them with tx.Commit()
+func (r *Registry) Begin() *Tx {
+	return &Tx{
+		registry: r,
+	}
+}
+// stage State.Set for the given source path
+func (tx *Tx) Set(path string, level int, message string) *Tx {
+	return tx.Update(path, func(s *State) {
+		s.Set(level, message)
+	})
+}
+// stage State.SetError for the given source path
+func (tx *Tx) SetError(path string, err error) *Tx {
+	return tx.Update(path, func(s *State) {
+		s.SetError(err)
+	})
+}
+// stage adding states to the tree of the given source path
+func (tx *Tx) Add(path string, s_list ...*State) *Tx {
+	return tx.Update(path, func(s *State) {
+		s.Add(s_list...)
+	})
+}
+// stage removing the state with the given source path
+func (tx *Tx) Remove(path string) *Tx {
+	
+	source_path := SplitPath(path)
+	
+	return tx.stage(func(r *Registry) []Transition {
+		transitions, _ := r.remove(source_path)
+		return transitions
+	})
+}
+// stage running fn on the State for the given source path (see Registry.Update)
+func (tx *Tx) Update(path string, fn func(*State)) *Tx {
+	
+	source_path := SplitPath(path)
+	
+	return tx.stage(func(r *Registry) []Transition {
+		return r.update(source_path, fn)
+	})
+}
+// apply the staged updates while holding the lock, then notify readers (and call the transition hooks) once
+func (tx *Tx) Commit() {
+	
+	tx.mu.Lock()
+	ops := tx.ops
+	tx.ops = nil
+	tx.mu.Unlock()
+	
+	if len(ops) == 0 {
+		return
+	}
+	
+	r := tx.registry
+	
+	r.mu.Lock()
+	
+	transitions := []Transition{}
+	for _, op := range ops {
+		transitions = append(transitions, op(r)...)
+	}
+	r.notify()
+	
+	r.release(transitions)
+}
+// discard the staged updates
+func (tx *Tx) Rollback() {
+	
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	
+	tx.ops = nil
+}
+
+func (tx *Tx) stage(op func(*Registry) []Transition) *Tx {
+	
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	
+	tx.ops = append(tx.ops, op)
+	
+	return tx
+}
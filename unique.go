@@ -0,0 +1,160 @@
+package jsonstate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// also lowercase sources when they are normalized (they are always trimmed), which makes source matching case-insensitive
+var NormalizeLowercase = false
+
+// normalize a source: surrounding whitespace is trimmed, and it is lowercased if NormalizeLowercase is set
+func NormalizeSource(source string) string {
+	
+	source = strings.TrimSpace(source)
+	if NormalizeLowercase {
+		source = strings.ToLower(source)
+	}
+	
+	return source
+}
+// normalize the sources in the recursive tree (see NormalizeSource), e.g. after decoding a document
+func (s *State) Normalize() *State {
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		s_it.Source = NormalizeSource(s_it.Source)
+		return true
+	})
+	
+	return s
+}
+// add states to the tree, replacing the first existing state with the same source (in its position), and removing any further duplicates of it
+func (s *State) Upsert(s_list ...*State) *State {
+	
+	for _, s_it := range s_list {
+		
+		if s_it == nil {
+			continue
+		}
+		
+		s_it.Source = NormalizeSource(s_it.Source)
+		
+		replaced := false
+		newTree := make([]*State, 0, len(s.Tree) + 1)
+		for _, s_old := range s.Tree {
+			
+			if s_old == nil {
+				continue
+			}
+			if NormalizeSource(s_old.Source) != s_it.Source {
+				newTree = append(newTree, s_old)
+			} else if !replaced {
+				newTree = append(newTree, s_it)
+				replaced = true
+			}
+		}
+		if !replaced {
+			newTree = append(newTree, s_it)
+		}
+		
+		s.Tree = newTree
+	}
+	
+	return s
+}
+// add states to the tree, merging into an existing state with the same source: its fields are replaced, and the trees are merged recursively (states only in the existing tree are kept)
+func (s *State) Merge(s_list ...*State) *State {
+	
+	for _, s_it := range s_list {
+		
+		if s_it == nil || s_it == s {
+			continue
+		}
+		
+		existing := s.FindBySource(s_it.Source)
+		if existing == nil {
+			s.Add(s_it)
+			continue
+		}
+		
+		tree := s_it.Tree
+		existing_tree := existing.Tree
+		
+		*existing = *s_it
+		existing.Source = NormalizeSource(existing.Source)
+		existing.Tree = existing_tree
+		
+		existing.Merge(tree...)
+	}
+	
+	return s
+}
+// check the recursive tree for duplicate sources within a tree, empty sources among siblings (an empty source refers to the parent, which is only unambiguous for a single child), and negative levels
+// note: the returned error joins an error per problem, each wrapping ErrDuplicateSource, ErrEmptySource or ErrInvalidLevel
+func (s *State) Validate() error {
+	
+	// the other checks need a well-formed tree
+	if err := s.CheckTree(); err != nil {
+		return err
+	}
+	
+	errs := []error{}
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		path := strings.Join(source_path, "/")
+		
+		if s_it.Level < StateUnknown {
+			errs = append(errs, fmt.Errorf("%w: %d in /%s", ErrInvalidLevel, s_it.Level, path))
+		}
+		
+		seen := map[string]bool{}
+		for _, s_child := range s_it.Tree {
+			
+			source := NormalizeSource(s_child.Source)
+			
+			if seen[source] {
+				errs = append(errs, fmt.Errorf("%w: %q in /%s", ErrDuplicateSource, source, path))
+				continue
+			}
+			seen[source] = true
+			
+			if source == "" && len(s_it.Tree) > 1 {
+				errs = append(errs, fmt.Errorf("%w: in /%s, among %d states", ErrEmptySource, path, len(s_it.Tree)))
+			}
+		}
+		
+		return true
+	})
+	
+	return errors.Join(errs...)
+}
+// check that no leaf of the recursive tree is older than max_age (by its Datetime, states without one are not checked)
+// note: the returned error joins an error per stale state, each wrapping ErrStale
+func (s *State) ValidateAge(max_age time.Duration) error {
+	
+	errs := []error{}
+	now := time.Now()
+	
+	s.Walk(func(source_path []string, s_it *State) bool {
+		
+		if len(s_it.Tree) > 0 || s_it.Datetime == "" {
+			return true
+		}
+		
+		datetime, err := time.Parse(time.RFC3339, s_it.Datetime)
+		if err != nil {
+			return true
+		}
+		
+		if age := now.Sub(datetime); age > max_age {
+			errs = append(errs, fmt.Errorf("%w: /%s was updated %s ago", ErrStale, strings.Join(source_path, "/"), age.Round(time.Second)))
+		}
+		
+		return true
+	})
+	
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package jsonstate
+
+import (
+	"testing"
+)
+
+func TestEnsureTreeNormalizesSources(t *testing.T) {
+	
+	s := New("web")
+	get_source := func(a any) string {
+		return a.(string)
+	}
+	
+	s.EnsureTree(0, []any{" web1 "}, get_source)
+	s.Tree[0].Set(StateFault, "down")
+	
+	s.EnsureTree(0, []any{" web1 "}, get_source)
+	if len(s.Tree) != 1 || s.Tree[0].Source != "web1" || s.Tree[0].Level != StateFault {
+		t.Errorf("EnsureTree recreated the state: %+v", s.Tree[0])
+	}
+}
+func TestRemoveNormalizesSources(t *testing.T) {
+	
+	// e.g. decoded without Normalize
+	s := &State{Tree: []*State{{Source: " db "}, {Source: "web"}}}
+	
+	if !s.Remove("db") || len(s.Tree) != 1 || s.Tree[0].Source != "web" {
+		t.Errorf("Remove did not match the source: %+v", s.Tree)
+	}
+	if !s.Remove(" web ") || len(s.Tree) != 0 {
+		t.Errorf("Remove did not match the source: %+v", s.Tree)
+	}
+}
+func TestApplyNormalizesSources(t *testing.T) {
+	
+	s := &State{Tree: []*State{{Source: " db ", Level: StateOk}}}
+	s.Apply(&State{Tree: []*State{{Source: "db", Level: StateError, Mode: OverrideReplace}}})
+	
+	if s.Tree[0].Level != StateError {
+		t.Errorf("override of the source not applied: level %d", s.Tree[0].Level)
+	}
+	if err := s.ApplyChecked(&State{Tree: []*State{{Source: "db ", Level: StateOk, Mode: OverrideReplace}}}); err != nil || s.Tree[0].Level != StateOk {
+		t.Errorf("checked override of the source: level %d, %v", s.Tree[0].Level, err)
+	}
+	if items := NewFilter().Source(" db").Apply(s); len(items) != 1 {
+		t.Errorf("Filter.Source matched %d states, want 1", len(items))
+	}
+}
@@ -0,0 +1,832 @@
+package jsonstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the tree as a YAML document (with the same field names as the JSON encoding)
+func (s *State) ToYAML() ([]byte, error) {
+	
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	
+	return JSONToYAML(data)
+}
+// convert a JSON document to the equivalent YAML document, keeping the order of object keys
+func JSONToYAML(data []byte) ([]byte, error) {
+	
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+	
+	var buf bytes.Buffer
+	writeYAML(&buf, v, 0)
+	
+	return buf.Bytes(), nil
+}
+
+// JSON object that keeps the order of its keys
+type orderedObject struct {
+	keys []string
+	values []any
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	
+	switch token {
+	
+	case json.Delim('{'):
+		
+		obj := &orderedObject{}
+		for dec.More() {
+			
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			
+			obj.keys = append(obj.keys, key.(string))
+			obj.values = append(obj.values, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+		
+	case json.Delim('['):
+		
+		list := []any{}
+		for dec.More() {
+			
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			
+			list = append(list, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return list, nil
+		
+	}
+	
+	return token, nil
+}
+
+func writeYAML(buf *bytes.Buffer, v any, indent int) {
+	
+	prefix := strings.Repeat("  ", indent)
+	
+	switch v := v.(type) {
+	
+	case *orderedObject:
+		
+		if len(v.keys) == 0 {
+			buf.WriteString(prefix + "{}\n")
+			return
+		}
+		
+		for i, key := range v.keys {
+			
+			buf.WriteString(prefix + yamlScalar(key) + ":")
+			
+			if isYAMLCollection(v.values[i]) {
+				buf.WriteString("\n")
+				writeYAML(buf, v.values[i], indent + 1)
+			} else {
+				buf.WriteString(" " + yamlScalar(v.values[i]) + "\n")
+			}
+		}
+		
+	case []any:
+		
+		if len(v) == 0 {
+			buf.WriteString(prefix + "[]\n")
+			return
+		}
+		
+		for _, item := range v {
+			
+			if !isYAMLCollection(item) {
+				buf.WriteString(prefix + "- " + yamlScalar(item) + "\n")
+				continue
+			}
+			
+			// write the item one level deeper, then replace its indentation by the "- " marker
+			var item_buf bytes.Buffer
+			writeYAML(&item_buf, item, indent + 1)
+			buf.WriteString(prefix + "- ")
+			buf.Write(item_buf.Bytes()[len(prefix) + 2:])
+		}
+		
+	default:
+		
+		buf.WriteString(prefix + yamlScalar(v) + "\n")
+		
+	}
+}
+
+func isYAMLCollection(v any) bool {
+	
+	switch v := v.(type) {
+	case *orderedObject:
+		return len(v.keys) > 0
+	case []any:
+		return len(v) > 0
+	}
+	
+	return false
+}
+
+func yamlScalar(v any) string {
+	
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if yamlNeedsQuotes(v) {
+			
+			// a JSON string is a valid YAML double-quoted scalar
+			var quoted bytes.Buffer
+			enc := json.NewEncoder(&quoted)
+			enc.SetEscapeHTML(false)
+			enc.Encode(v)
+			
+			return strings.TrimSuffix(quoted.String(), "\n")
+		}
+		return v
+	case *orderedObject:
+		return "{}"
+	case []any:
+		return "[]"
+	}
+	
+	return fmt.Sprint(v)
+}
+
+func yamlNeedsQuotes(s string) bool {
+	
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	
+	// anything that would be read back as something else than a plain string
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	
+	return false
+}
+
+// constructor: read a tree from a YAML document (see YAMLToJSON), e.g. one written by ToYAML
+func ParseYAML(data []byte) (*State, error) {
+	
+	data, err := YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	
+	return Parse(data)
+}
+// convert a YAML document to the equivalent JSON document, keeping the order of mapping keys
+// note: only a subset of YAML is supported, which covers the output of JSONToYAML and typical configuration files: block mappings and sequences, flow collections ([a, b], {a: 1}, and so any JSON document), plain, quoted and block (| and >) scalars, and comments, but no anchors, aliases, tags, complex keys or multiple documents
+// note: plain scalars are resolved like YAML 1.2 (only true and false are booleans, "yes" is a string)
+func YAMLToJSON(data []byte) ([]byte, error) {
+	
+	p := &yamlParser{
+		lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"),
+	}
+	
+	// a single document, optionally started with ---
+	if _, text, ok, err := p.peek(); err != nil {
+		return nil, err
+	} else if ok && text == "---" {
+		p.advance()
+	}
+	
+	v, err := p.parseNode(-1)
+	if err != nil {
+		return nil, err
+	}
+	
+	if _, text, ok, err := p.peek(); err != nil {
+		return nil, err
+	} else if ok && text == "..." {
+		p.advance()
+	}
+	if _, text, ok, _ := p.peek(); ok {
+		return nil, p.errorf("unexpected %q (wrong indentation, or a second document)", text)
+	}
+	
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v); err != nil {
+		return nil, err
+	}
+	
+	return buf.Bytes(), nil
+}
+
+type yamlParser struct {
+	lines []string
+	i int // current line
+	col int // column at which the current line starts, after the "- " of a sequence item on the same line
+}
+
+// the indentation and text (without comment) of the current line, skipping lines without content
+func (p *yamlParser) peek() (int, string, bool, error) {
+	
+	for ; p.i < len(p.lines); p.i, p.col = p.i + 1, 0 {
+		
+		line := p.lines[p.i][p.col:]
+		text := strings.TrimLeft(line, " ")
+		indent := p.col + len(line) - len(text)
+		
+		text = strings.TrimRight(stripYAMLComment(text), " \t")
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return 0, "", false, p.errorf("tab in indentation")
+		}
+		
+		return indent, text, true, nil
+	}
+	
+	return 0, "", false, nil
+}
+func (p *yamlParser) advance() {
+	p.i += 1
+	p.col = 0
+}
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("jsonstate: yaml: line %d: %s", p.i + 1, fmt.Sprintf(format, args...))
+}
+
+// the value of the lines indented deeper than parent_indent, null if there are none
+func (p *yamlParser) parseNode(parent_indent int) (any, error) {
+	
+	indent, text, ok, err := p.peek()
+	if err != nil || !ok || indent <= parent_indent {
+		return nil, err
+	}
+	
+	if isYAMLSequenceItem(text) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(text); ok {
+		return p.parseMapping(indent)
+	}
+	
+	return p.parseInline(text)
+}
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	
+	list := []any{}
+	for {
+		
+		line_indent, text, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || line_indent < indent || (line_indent == indent && !isYAMLSequenceItem(text)) {
+			return list, nil
+		}
+		if line_indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if !isYAMLSequenceItem(text) {
+			return nil, p.errorf("expected a sequence item")
+		}
+		
+		rest := strings.TrimLeft(text[1:], " ")
+		if rest == "" {
+			p.advance()
+		} else {
+			p.col = line_indent + len(text) - len(rest) // the item starts after "- " (e.g. a mapping of which the next keys are indented to the same column)
+		}
+		
+		v, err := p.parseNode(indent)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+}
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	
+	obj := &orderedObject{}
+	seen := map[string]bool{}
+	for {
+		
+		line_indent, text, ok, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || line_indent < indent {
+			return obj, nil
+		}
+		if line_indent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		
+		raw_key, rest, ok := splitYAMLKey(text)
+		if !ok {
+			if isYAMLSequenceItem(text) {
+				return obj, nil // e.g. the next item of a sequence of mappings
+			}
+			return nil, p.errorf("expected a key: %q", text)
+		}
+		
+		key, err := parseYAMLScalar(raw_key, true)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if seen[key.(string)] {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		seen[key.(string)] = true
+		
+		var v any
+		switch {
+		case rest == "":
+			
+			p.advance()
+			
+			// a sequence may be indented as deep as its key
+			if next_indent, next_text, ok, _ := p.peek(); ok && next_indent == indent && isYAMLSequenceItem(next_text) {
+				v, err = p.parseSequence(indent)
+			} else {
+				v, err = p.parseNode(indent)
+			}
+			
+		case rest[0] == '|' || rest[0] == '>':
+			v, err = p.parseBlockScalar(indent, rest)
+		default:
+			v, err = p.parseInline(rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		
+		obj.keys = append(obj.keys, key.(string))
+		obj.values = append(obj.values, v)
+	}
+}
+// a value on the current line: a scalar, or a flow collection (which may continue on the next lines)
+func (p *yamlParser) parseInline(text string) (any, error) {
+	
+	if strings.ContainsAny(text[:1], "&*!?%@`") {
+		return nil, p.errorf("unsupported YAML: %q", text)
+	}
+	
+	if text[0] != '[' && text[0] != '{' {
+		
+		v, err := parseYAMLScalar(text, false)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.advance()
+		
+		return v, nil
+	}
+	
+	for !yamlFlowClosed(text) {
+		
+		p.advance()
+		if p.i >= len(p.lines) {
+			return nil, p.errorf("unterminated flow collection")
+		}
+		text += " " + strings.TrimSpace(stripYAMLComment(strings.TrimLeft(p.lines[p.i], " ")))
+	}
+	
+	f := &yamlFlow{text: text}
+	v, err := f.parseValue()
+	if err == nil && f.skipSpaces() < len(f.text) {
+		err = fmt.Errorf("unexpected %q after flow collection", f.text[f.pos:])
+	}
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	p.advance()
+	
+	return v, nil
+}
+// a literal (|) or folded (>) block scalar, with clip (default), strip (-) or keep (+) chomping
+func (p *yamlParser) parseBlockScalar(indent int, header string) (any, error) {
+	
+	style, chomping := header[0], strings.TrimSpace(header[1:])
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return nil, p.errorf("unsupported block scalar header %q", header)
+	}
+	p.advance()
+	
+	lines := []string{}
+	block_indent := -1
+	for ; p.i < len(p.lines); p.i += 1 {
+		
+		line := strings.TrimRight(p.lines[p.i], " \t")
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		
+		line_indent := len(line) - len(text)
+		if line_indent <= indent {
+			break
+		}
+		if block_indent < 0 {
+			block_indent = line_indent
+		}
+		if line_indent < block_indent {
+			return nil, p.errorf("less indented line in block scalar")
+		}
+		lines = append(lines, line[block_indent:])
+	}
+	p.col = 0
+	
+	// trailing empty lines are only kept with +
+	content := len(lines)
+	for content > 0 && lines[content - 1] == "" {
+		content -= 1
+	}
+	trailing := len(lines) - content
+	lines = lines[:content]
+	
+	var sb strings.Builder
+	for i, line := range lines {
+		
+		if i > 0 {
+			// folded: lines are joined with a space, and a line break for every empty line (more indented lines are kept as is)
+			if style == '>' && line != "" && lines[i - 1] != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(lines[i - 1], " ") {
+				sb.WriteString(" ")
+			} else if style != '>' || line != "" || lines[i - 1] == "" {
+				sb.WriteString("\n")
+			}
+		}
+		sb.WriteString(line)
+	}
+	
+	switch {
+	case len(lines) == 0:
+	case chomping == "-":
+	case chomping == "+":
+		sb.WriteString(strings.Repeat("\n", 1 + trailing))
+	default:
+		sb.WriteString("\n")
+	}
+	
+	return sb.String(), nil
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+// split "key: value" (or "key:") into its key and value, outside of quotes, false if the text is not a mapping entry
+func splitYAMLKey(text string) (string, string, bool) {
+	
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	
+	i := 0
+	if text[0] == '"' || text[0] == '\'' {
+		i = yamlQuotedEnd(text)
+		if i < 0 {
+			return "", "", false
+		}
+	}
+	
+	for ; i < len(text); i += 1 {
+		if text[i] == ':' && (i + 1 == len(text) || text[i + 1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i + 1:]), true
+		}
+	}
+	
+	return "", "", false
+}
+// the index after the closing quote of the quoted scalar at the start of text, or -1
+func yamlQuotedEnd(text string) int {
+	
+	quote := text[0]
+	for i := 1; i < len(text); i += 1 {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i += 1
+		case text[i] == quote && quote == '\'' && i + 1 < len(text) && text[i + 1] == '\'':
+			i += 1 // '' is an escaped '
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	
+	return -1
+}
+// text without its comment, a # at the start or after whitespace that is not in a quoted scalar
+func stripYAMLComment(text string) string {
+	
+	for i := 0; i < len(text); i += 1 {
+		
+		// quoted scalars start at the start of a value
+		if (text[i] == '"' || text[i] == '\'') && (i == 0 || strings.ContainsRune(" [{,:", rune(text[i - 1]))) {
+			if end := yamlQuotedEnd(text[i:]); end > 0 {
+				i += end - 1
+				continue
+			}
+		}
+		if text[i] == '#' && (i == 0 || text[i - 1] == ' ' || text[i - 1] == '\t') {
+			return text[:i]
+		}
+	}
+	
+	return text
+}
+// whether the brackets of a flow collection are balanced (outside of quoted scalars)
+func yamlFlowClosed(text string) bool {
+	
+	depth := 0
+	for i := 0; i < len(text); i += 1 {
+		
+		switch text[i] {
+		case '[', '{':
+			depth += 1
+		case ']', '}':
+			depth -= 1
+		case '"', '\'':
+			if i == 0 || strings.ContainsRune(" [{,:", rune(text[i - 1])) {
+				end := yamlQuotedEnd(text[i:])
+				if end < 0 {
+					return false
+				}
+				i += end - 1
+			}
+		}
+	}
+	
+	return depth <= 0
+}
+// a quoted or plain scalar (a key is always a string)
+func parseYAMLScalar(text string, key bool) (any, error) {
+	
+	switch text[0] {
+	case '"':
+		
+		if yamlQuotedEnd(text) != len(text) {
+			return nil, fmt.Errorf("invalid double-quoted scalar: %s", text)
+		}
+		
+		// the common escapes of YAML are those of JSON
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("unsupported double-quoted scalar: %s", text)
+		}
+		return s, nil
+		
+	case '\'':
+		
+		if yamlQuotedEnd(text) != len(text) {
+			return nil, fmt.Errorf("invalid single-quoted scalar: %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text) - 1], "''", "'"), nil
+	}
+	
+	if key {
+		return text, nil
+	}
+	
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	
+	if n, err := strconv.ParseInt(strings.TrimPrefix(text, "+"), 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(n, 10)), nil
+	}
+	if strings.ContainsAny(text[:1], "+-.0123456789") && !strings.ContainsAny(text, "xXoO_:") {
+		if f, err := strconv.ParseFloat(text, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+		}
+	}
+	
+	return text, nil
+}
+
+// a flow collection, e.g. [a, "b", {c: 1}]
+type yamlFlow struct {
+	text string
+	pos int
+}
+
+func (f *yamlFlow) skipSpaces() int {
+	
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos += 1
+	}
+	
+	return f.pos
+}
+func (f *yamlFlow) parseValue() (any, error) {
+	
+	if f.skipSpaces() >= len(f.text) {
+		return nil, fmt.Errorf("unterminated flow collection")
+	}
+	
+	switch f.text[f.pos] {
+	case '[':
+		
+		f.pos += 1
+		list := []any{}
+		for {
+			
+			if f.skipSpaces() < len(f.text) && f.text[f.pos] == ']' {
+				f.pos += 1
+				return list, nil
+			}
+			
+			v, err := f.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+		
+	case '{':
+		
+		f.pos += 1
+		obj := &orderedObject{}
+		for {
+			
+			if f.skipSpaces() < len(f.text) && f.text[f.pos] == '}' {
+				f.pos += 1
+				return obj, nil
+			}
+			
+			key, err := f.parseScalar(true)
+			if err != nil {
+				return nil, err
+			}
+			if f.skipSpaces() >= len(f.text) || f.text[f.pos] != ':' {
+				return nil, fmt.Errorf("expected : after key %q", key)
+			}
+			f.pos += 1
+			
+			v, err := f.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key.(string))
+			obj.values = append(obj.values, v)
+			
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+	
+	return f.parseScalar(false)
+}
+// skip a "," between items, but not the closing bracket
+func (f *yamlFlow) separator(closing byte) error {
+	
+	if f.skipSpaces() >= len(f.text) {
+		return fmt.Errorf("unterminated flow collection")
+	}
+	
+	switch f.text[f.pos] {
+	case ',':
+		f.pos += 1
+		return nil
+	case closing:
+		return nil
+	}
+	
+	return fmt.Errorf("expected , or %c at %q", closing, f.text[f.pos:])
+}
+func (f *yamlFlow) parseScalar(key bool) (any, error) {
+	
+	start := f.skipSpaces()
+	if start < len(f.text) && (f.text[start] == '"' || f.text[start] == '\'') {
+		
+		end := yamlQuotedEnd(f.text[start:])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated quoted scalar")
+		}
+		f.pos = start + end
+		
+		return parseYAMLScalar(f.text[start:f.pos], key)
+	}
+	
+	// a plain scalar ends at an indicator of the collection, or at ": " in a key
+	for ; f.pos < len(f.text); f.pos += 1 {
+		if c := f.text[f.pos]; c == ',' || c == ']' || c == '}' || (key && c == ':') || (c == ':' && f.pos + 1 < len(f.text) && f.text[f.pos + 1] == ' ') {
+			break
+		}
+	}
+	
+	text := strings.TrimSpace(f.text[start:f.pos])
+	if text == "" {
+		return nil, fmt.Errorf("empty value at %q", f.text[start:])
+	}
+	
+	return parseYAMLScalar(text, key)
+}
+
+// write a value of decodeOrdered (or YAMLToJSON) as JSON
+func writeJSON(buf *bytes.Buffer, v any) error {
+	
+	switch v := v.(type) {
+	case *orderedObject:
+		
+		buf.WriteString("{")
+		for i, key := range v.keys {
+			
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeJSON(buf, key); err != nil {
+				return err
+			}
+			buf.WriteString(":")
+			if err := writeJSON(buf, v.values[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+		
+	case []any:
+		
+		buf.WriteString("[")
+		for i, item := range v {
+			
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+		
+	default:
+		
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // the newline of Encode
+		
+	}
+	
+	return nil
+}
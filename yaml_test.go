@@ -0,0 +1,95 @@
+package jsonstate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	
+	for yaml, want := range map[string]string{
+		"a: 1\nb: text # comment\nc: \"quoted # not a comment\"\nd: 'it''s'\n": `{"a":1,"b":"text","c":"quoted # not a comment","d":"it's"}`,
+		"---\nlist:\n- 1\n- two\n-\n  nested: true\n- key: v\n  other: ~\n": `{"list":[1,"two",{"nested":true},{"key":"v","other":null}]}`,
+		"list:\n  - a\n  - [b, \"c\", {d: 1.5}]\nempty: []\n": `{"list":["a",["b","c",{"d":1.5}]],"empty":[]}`,
+		"flow: {a: [1,\n  2], b: yes}\n": `{"flow":{"a":[1,2],"b":"yes"}}`,
+		"text: |\n  line 1\n  line 2\nfolded: >-\n  a\n  b\n\n  c\nnext: 1\n": `{"text":"line 1\nline 2\n","folded":"a b\nc","next":1}`,
+		"{\"source\": \"json\", \"tree\": []}": `{"source":"json","tree":[]}`,
+		"- 1\n- -2\n- 1e3\n- 0x10\n- 10:30\n- .inf\n": `[1,-2,1000,"0x10","10:30",".inf"]`,
+		"# only a comment\n": `null`,
+	} {
+		got, err := YAMLToJSON([]byte(yaml))
+		if err != nil {
+			t.Errorf("YAMLToJSON(%q): %v", yaml, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("YAMLToJSON(%q) = %s, want %s", yaml, got, want)
+		}
+	}
+}
+func TestYAMLToJSONErrors(t *testing.T) {
+	
+	for _, yaml := range []string{
+		"a: 1\na: 2\n",
+		"a: &anchor 1\nb: *anchor\n",
+		"a: !!str 1\n",
+		"a: 1\n  b: 2\n",
+		"a:\n\t- 1\n",
+		"a: [1, 2\n",
+		"a: \"unterminated\n",
+		"a: 1\n---\nb: 2\n",
+	} {
+		if _, err := YAMLToJSON([]byte(yaml)); err == nil || !strings.HasPrefix(err.Error(), "jsonstate: yaml: line ") {
+			t.Errorf("YAMLToJSON(%q): error %v", yaml, err)
+		}
+	}
+}
+func TestYAMLRoundTrip(t *testing.T) {
+	
+	s := New("root")
+	s.Set(StateWarning, "yes: 'quoted' #1\nsecond line")
+	s.Tree = []*State{New("true"), New("007"), New("")}
+	s.Tree[0].Set(StateError, "- not a list")
+	
+	yaml, err := s.ToYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseYAML(yaml)
+	if err != nil {
+		t.Fatalf("ParseYAML: %v\n%s", err, yaml)
+	}
+	
+	want_json, _ := json.Marshal(s)
+	got_json, _ := json.Marshal(got)
+	if string(got_json) != string(want_json) {
+		t.Errorf("round trip through YAML:\n%s\ngot  %s\nwant %s", yaml, got_json, want_json)
+	}
+}
+func TestYAMLProbeConfig(t *testing.T) {
+	
+	data, err := YAMLToJSON([]byte(`
+probes:
+- {path: web, type: http, url: "http://localhost:8080/health"}
+- path: queue
+  type: gauge
+  name: queue depth
+  command: [/usr/local/bin/queue-depth]
+  rates: [{rate: 100, for: 5m, level: warning}]
+  interval: 10s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	
+	config := struct {
+		Probes []ProbeConfig `json:"probes"`
+	}{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("%v: %s", err, data)
+	}
+	if len(config.Probes) != 2 || config.Probes[0].URL != "http://localhost:8080/health" || config.Probes[1].Name != "queue depth" || config.Probes[1].Command[0] != "/usr/local/bin/queue-depth" || config.Probes[1].Rates[0].Rate != 100 || config.Probes[1].Rates[0].Level != "warning" || config.Probes[1].Interval != "10s" {
+		t.Errorf("probes: %+v", config.Probes)
+	}
+}